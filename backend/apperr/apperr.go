@@ -0,0 +1,156 @@
+package apperr
+
+import (
+	"crypto-tracker/types"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Error is an error with a stable code for the clients and the HTTP status it
+// maps to. Domain packages declare their sentinel errors with New and wrap
+// them with fmt.Errorf("%w: ...") to add details.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func New(status int, code, message string) *Error {
+	return &Error{
+		Status:  status,
+		Code:    code,
+		Message: message,
+	}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+var (
+	ErrBadRequest   = New(http.StatusBadRequest, "bad_request", "bad request")
+	ErrValidation   = New(http.StatusBadRequest, "validation_failed", "validation failed")
+	ErrUnauthorized = New(http.StatusUnauthorized, "unauthorized", "unauthorized")
+	ErrForbidden    = New(http.StatusForbidden, "permission_denied", "permission denied")
+	ErrNotFound     = New(http.StatusNotFound, "not_found", "not found")
+	ErrConflict     = New(http.StatusConflict, "conflict", "conflict")
+	ErrTooMany      = New(http.StatusTooManyRequests, "rate_limited", "too many requests")
+	ErrInternal     = New(http.StatusInternalServerError, "internal_error", "internal server error")
+	ErrUnavailable  = New(http.StatusServiceUnavailable, "service_unavailable", "service unavailable")
+)
+
+// ValidationError carries the field level details of a failed validation
+type ValidationError struct {
+	Fields []types.FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		messages = append(messages, f.Message)
+	}
+
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
+
+// Validation builds a ValidationError from field errors
+func Validation(fields ...types.FieldError) error {
+	return &ValidationError{Fields: fields}
+}
+
+// FromValidator converts the errors of go-playground/validator into a
+// ValidationError, other errors are returned as they are
+func FromValidator(err error) error {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return err
+	}
+
+	fields := make([]types.FieldError, 0, len(validationErrors))
+	for _, fe := range validationErrors {
+		fields = append(fields, types.FieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Message: fieldMessage(fe),
+		})
+	}
+
+	return &ValidationError{Fields: fields}
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", fe.Field())
+	case "email":
+		return fmt.Sprintf("%s must be a valid email", fe.Field())
+	case "min":
+		return fmt.Sprintf("%s must be at least %s", fe.Field(), fe.Param())
+	case "gt":
+		return fmt.Sprintf("%s must be greater than %s", fe.Field(), fe.Param())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s", fe.Field(), fe.Param())
+	case "oneof":
+		return fmt.Sprintf("%s must be one of %s", fe.Field(), fe.Param())
+	default:
+		return fmt.Sprintf("%s is invalid (%s)", fe.Field(), fe.Tag())
+	}
+}
+
+// Resolve is the one mapping from an error to the status and code of the
+// response. Errors that are not an *Error are internal errors.
+func Resolve(err error) *Error {
+	if errors.As(err, new(validator.ValidationErrors)) {
+		return ErrValidation
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	return ErrInternal
+}
+
+// FieldErrors returns the field level details of err, if any
+func FieldErrors(err error) []types.FieldError {
+	var ve *ValidationError
+	if errors.As(FromValidator(err), &ve) {
+		return ve.Fields
+	}
+
+	return nil
+}
+
+// ForStatus returns the generic error of an HTTP status
+func ForStatus(status int) *Error {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrBadRequest
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusConflict:
+		return ErrConflict
+	case http.StatusTooManyRequests:
+		return ErrTooMany
+	case http.StatusServiceUnavailable:
+		return ErrUnavailable
+	default:
+		if status >= 400 && status < 500 {
+			return ErrBadRequest
+		}
+		return ErrInternal
+	}
+}
@@ -1,17 +1,43 @@
 package background
 
-import "log"
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
 
 type JobFunc func()
 
+var wg sync.WaitGroup
+
 func Go(fn func()) {
+	wg.Add(1)
+
 	go func() {
+		defer wg.Done()
 		defer func() {
 			if r := recover(); r != nil {
-				log.Println("Recovered from panic:", r)
+				slog.Error("Recovered from panic", "panic", r)
 			}
 		}()
 
 		fn()
 	}()
 }
+
+// Wait blocks until every goroutine started with Go has returned or ctx is done.
+func Wait(ctx context.Context) error {
+	done := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -2,72 +2,318 @@ package api
 
 import (
 	"context"
-	"crypto-tracker/background"
 	"crypto-tracker/config"
+	"crypto-tracker/health"
 	"crypto-tracker/jobs"
+	"crypto-tracker/leader"
+	"crypto-tracker/metrics"
 	"crypto-tracker/middlewares"
+	"crypto-tracker/openapi"
+	"crypto-tracker/ratelimit"
+	"crypto-tracker/scheduler"
+	"crypto-tracker/service/alerts"
 	"crypto-tracker/service/auth"
 	"crypto-tracker/service/chat"
 	"crypto-tracker/service/currency"
+	"crypto-tracker/service/dca"
 	"crypto-tracker/service/deals"
+	"crypto-tracker/service/notifications"
+	"crypto-tracker/service/performance"
+	"crypto-tracker/service/portfolios"
+	"crypto-tracker/service/reports"
+	"crypto-tracker/service/tax"
 	"crypto-tracker/service/user"
+	"crypto-tracker/service/watchlists"
 	"database/sql"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
+// jobsLockKey is the Postgres advisory lock held by the instance running the jobs
+const jobsLockKey = 7_210_401
+
 type Server struct {
-	addr string
-	db   *sql.DB
+	addr       string
+	db         *sql.DB
+	httpServer *http.Server
+	scheduler  *scheduler.Scheduler
+	rateLimits ratelimit.Store
 }
 
 func NewServer(addr string, db *sql.DB) *Server {
+	var rateLimits ratelimit.Store = ratelimit.NewMemoryStore()
+	if config.Envs.RateLimitBackend == "postgres" {
+		rateLimits = ratelimit.NewPostgresStore(db)
+	}
+
 	return &Server{
-		addr: addr,
-		db:   db,
+		addr:       addr,
+		db:         db,
+		httpServer: &http.Server{Addr: addr},
+		scheduler:  scheduler.New(),
+		rateLimits: rateLimits,
 	}
 }
 
-func (s *Server) Run() error {
-	router := mux.NewRouter()
-	corsRouter := middlewares.CORS(router)
+// Run serves the API until Shutdown is called. Background jobs are stopped
+// when ctx is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	router, startJobs, err := s.routes()
+	if err != nil {
+		return err
+	}
+
+	corsRouter := middlewares.CORS(router, middlewares.CORSOptions{
+		AllowedOrigins:   config.Envs.CORSAllowedOrigins,
+		AllowCredentials: config.Envs.CORSAllowCredentials,
+		MaxAge:           config.Envs.CORSMaxAge,
+	})
+	metrics.RegisterDB(s.db, "postgres")
+
+	// The spec is checked by the tests, this only catches a build without them
+	if missing, err := openapi.MissingRoutes(router); err != nil {
+		return err
+	} else if len(missing) > 0 {
+		slog.Error("Routes missing from the OpenAPI spec", "routes", missing)
+	}
+
+	if err := startJobs(ctx); err != nil {
+		return err
+	}
+
+	slog.Info("Listening", "addr", s.addr)
+
+	s.httpServer.Handler = middlewares.RequestID(middlewares.AccessLog(corsRouter))
+	if err := s.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// routes builds the router of the API and its services, startJobs registers
+// and starts the background jobs of the services
+func (s *Server) routes() (router *mux.Router, startJobs func(ctx context.Context) error, err error) {
+	router = mux.NewRouter()
+	router.Use(metrics.Middleware)
+
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	ipResolver, err := ratelimit.NewIPResolver(config.Envs.TrustedProxies)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	subrouter := router.PathPrefix("/api/v1").Subrouter()
+	subrouter.Use(ratelimit.New("api", config.Envs.RateLimitAPI, s.rateLimits, ratelimit.ByIP(ipResolver)).Middleware)
 
 	userStore := user.NewRepository(s.db)
-	userService := user.NewHandler(userStore)
-	userService.RegisterRoutes(subrouter)
+	requireAuth := func(next http.Handler) http.Handler {
+		return auth.AuthMiddleware(next.ServeHTTP, userStore)
+	}
+
+	// Login and register share a stricter limit per client address
+	authSubrouter := subrouter.NewRoute().Subrouter()
+	authSubrouter.Use(ratelimit.New("auth", config.Envs.RateLimitAuth, s.rateLimits, ratelimit.ByIP(ipResolver)).Middleware)
 
-	chatService, _ := chat.NewHandler(config.Envs, userStore)
-	chatService.RegisterRoutes(subrouter)
+	notificationService := notifications.NewService(notifications.NewRepository(s.db), userStore, notifications.NewMailer(config.Envs), config.Envs)
+
+	userService := user.NewHandler(userStore, notificationService, ipResolver.ClientIP)
+	userService.RegisterRoutes(authSubrouter)
 
 	currencyService := currency.NewService(config.Envs)
 	currencyHandler := currency.NewHandler(currencyService)
+	metrics.RegisterDataAge(currencyService)
 	currencyHandler.RegisterRoutes(subrouter)
 
+	healthHandler := health.NewHandler(s.db, currencyService, config.Envs)
+	healthHandler.RegisterRoutes(router)
+
+	portfolioStore := portfolios.NewRepository(s.db)
 	dealStore := deals.NewRepository(s.db)
-	dealService := deals.NewDealService(dealStore)
+	dealService := deals.NewDealService(dealStore, portfolioStore)
 
-	dealSubrouter := subrouter.PathPrefix("/deals").Subrouter()
+	chatService, err := chat.NewHandler(config.Envs, userStore, dealService)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	dealSubrouter.Use(func(next http.Handler) http.Handler {
-		return auth.AuthMiddleware(next.ServeHTTP, userStore)
-	})
+	chatSubrouter := subrouter.PathPrefix("/chat").Subrouter()
+	chatSubrouter.Use(requireAuth)
+	chatSubrouter.Use(ratelimit.New("chat", config.Envs.RateLimitChat, s.rateLimits, ratelimit.ByUser(ipResolver)).Middleware)
+	chatService.RegisterRoutes(chatSubrouter)
+
+	dealSubrouter := subrouter.PathPrefix("/deals").Subrouter()
+	dealSubrouter.Use(requireAuth)
 
-	dealRoutes := deals.NewHandler(dealService, userStore)
+	rateHistory := tax.NewRepository(s.db)
+	dealRoutes := deals.NewHandler(dealService, userStore, deals.NewImporter(dealService, currencyService, rateHistory))
 	dealRoutes.RegisterRoutes(dealSubrouter)
 
-	s.startBackgroundJobs(currencyService)
+	portfolioSubrouter := subrouter.PathPrefix("/portfolios").Subrouter()
+	portfolioSubrouter.Use(requireAuth)
+
+	portfolioHandler := portfolios.NewHandler(portfolios.NewService(portfolioStore, dealService, currencyService))
+	portfolioHandler.RegisterRoutes(portfolioSubrouter)
+
+	reportService := reports.NewService(dealService, dealService, currencyService, notificationService)
+	reportHandler := reports.NewHandler(reportService)
+	reportHandler.RegisterRoutes(dealSubrouter)
+
+	priceHistory := performance.NewRepository(s.db)
+	performanceService := performance.NewService(priceHistory, dealService, dealService, currencyService)
+	performanceHandler := performance.NewHandler(performanceService)
+	performanceHandler.RegisterRoutes(dealSubrouter)
+
+	taxSubrouter := subrouter.PathPrefix("/tax").Subrouter()
+	taxSubrouter.Use(requireAuth)
+
+	taxService := tax.NewService(rateHistory, dealService, currencyService)
+	taxHandler := tax.NewHandler(taxService)
+	taxHandler.RegisterRoutes(taxSubrouter)
+
+	alertSubrouter := subrouter.PathPrefix("/alerts").Subrouter()
+	alertSubrouter.Use(requireAuth)
+
+	alertService := alerts.NewService(alerts.NewRepository(s.db), currencyService, notificationService, config.Envs)
+	alertHandler := alerts.NewHandler(alertService)
+	alertHandler.RegisterRoutes(alertSubrouter)
+
+	dcaSubrouter := subrouter.PathPrefix("/dca").Subrouter()
+	dcaSubrouter.Use(requireAuth)
+
+	dcaService := dca.NewService(dca.NewRepository(s.db), dealService, currencyService, priceHistory, rateHistory)
+	dcaHandler := dca.NewHandler(dcaService)
+	dcaHandler.RegisterRoutes(dcaSubrouter)
+
+	notificationSubrouter := subrouter.PathPrefix("/notifications").Subrouter()
+	notificationSubrouter.Use(requireAuth)
+
+	notificationHandler := notifications.NewHandler(notificationService)
+	notificationHandler.RegisterRoutes(notificationSubrouter)
+
+	watchlistService := watchlists.NewService(watchlists.NewRepository(s.db), currencyService)
+	watchlistHandler := watchlists.NewHandler(watchlistService)
+	watchlistHandler.RegisterPublicRoutes(subrouter)
+
+	watchlistSubrouter := subrouter.PathPrefix("/watchlists").Subrouter()
+	watchlistSubrouter.Use(requireAuth)
+	watchlistHandler.RegisterRoutes(watchlistSubrouter)
+
+	adminSubrouter := subrouter.PathPrefix("/admin").Subrouter()
+	adminSubrouter.Use(middlewares.AdminOnly(config.Envs.AdminToken))
 
-	log.Println("Listening on", s.addr)
+	schedulerHandler := scheduler.NewHandler(s.scheduler)
+	schedulerHandler.RegisterRoutes(adminSubrouter)
+	notificationHandler.RegisterAdminRoutes(adminSubrouter)
+	taxHandler.RegisterAdminRoutes(adminSubrouter)
+	performanceHandler.RegisterAdminRoutes(adminSubrouter)
 
-	return http.ListenAndServe(s.addr, corsRouter)
+	openapiHandler := openapi.NewHandler()
+	openapiHandler.RegisterRoutes(subrouter)
+
+	startJobs = func(ctx context.Context) error {
+		return s.startBackgroundJobs(ctx, currencyService, alertService, notificationService, reportService, taxService, performanceService, dcaService)
+	}
+
+	return router, startJobs, nil
 }
 
-func (s *Server) startBackgroundJobs(currencyService *currency.Service) {
-	j := jobs.NewJobs(currencyService)
+// Shutdown stops accepting connections and waits for in-flight requests
+// until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
+}
+
+func (s *Server) startBackgroundJobs(
+	ctx context.Context,
+	currencyService *currency.Service,
+	alertService *alerts.Service,
+	notificationService *notifications.Service,
+	reportService *reports.Service,
+	taxService *tax.Service,
+	performanceService *performance.Service,
+	dcaService *dca.Service,
+) error {
+	elector := leader.NewElector(s.db, jobsLockKey, config.Envs.LeaderCheckInterval)
+	currencyService.SetSharedCache(currency.NewCacheRepository(s.db), elector.IsLeader)
+	currencyService.OnRefresh(alertService.OnRefresh)
+	alertService.Start(ctx, elector.IsLeader)
+
+	j := jobs.NewJobs(config.Envs, currencyService, elector.IsLeader)
+	if err := j.Register(s.scheduler); err != nil {
+		return err
+	}
+
+	reportSpec, err := scheduler.ParseSpec(config.Envs.PortfolioReportSchedule)
+	if err != nil {
+		return fmt.Errorf("invalid PORTFOLIO_REPORT_SCHEDULE: %w", err)
+	}
+
+	err = errors.Join(
+		s.scheduler.Register(scheduler.Job{
+			Name:    "webhook-deliveries",
+			Spec:    scheduler.Every(15 * time.Second),
+			Timeout: time.Minute,
+			Enabled: elector.IsLeader,
+			Run:     notificationService.DeliverPending,
+		}),
+		s.scheduler.Register(scheduler.Job{
+			Name:    "portfolio-report",
+			Spec:    reportSpec,
+			Jitter:  time.Minute,
+			Timeout: 10 * time.Minute,
+			Enabled: elector.IsLeader,
+			Run:     reportService.SendPortfolioReports,
+		}),
+		s.scheduler.Register(scheduler.Job{
+			Name:    "fx-rates",
+			Spec:    scheduler.Every(time.Hour),
+			Timeout: time.Minute,
+			Enabled: elector.IsLeader,
+			Run:     taxService.RecordRates,
+		}),
+		s.scheduler.Register(scheduler.Job{
+			Name:    "price-history",
+			Spec:    scheduler.Every(time.Hour),
+			Timeout: time.Minute,
+			Enabled: elector.IsLeader,
+			Run:     performanceService.RecordPrices,
+		}),
+		s.scheduler.Register(scheduler.Job{
+			Name:    "dca-plans",
+			Spec:    scheduler.Every(time.Minute),
+			Timeout: time.Minute,
+			Enabled: elector.IsLeader,
+			Run:     dcaService.RunDue,
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	if store, ok := s.rateLimits.(*ratelimit.PostgresStore); ok {
+		err := s.scheduler.Register(scheduler.Job{
+			Name:    "rate-limit-cleanup",
+			Spec:    scheduler.Every(time.Hour),
+			Timeout: time.Minute,
+			Enabled: elector.IsLeader,
+			Run: func(ctx context.Context) error {
+				return store.Cleanup(ctx, 24*time.Hour)
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	elector.Start(ctx)
+	s.scheduler.Start(ctx)
 
-	background.Go(j.GetCurrencies(context.Background()))
+	return nil
 }
@@ -1,33 +1,60 @@
 package main
 
 import (
+	"context"
+	"crypto-tracker/background"
 	"crypto-tracker/cmd/api"
 	"crypto-tracker/config"
 	"crypto-tracker/database"
+	"crypto-tracker/lifecycle"
+	"crypto-tracker/logging"
 	"database/sql"
-	"log"
+	"log/slog"
+	"os"
 )
 
 func main() {
+	if err := logging.Setup(config.Envs.LogLevel, config.Envs.LogFormat); err != nil {
+		fatal("Invalid logging configuration", err)
+	}
+
+	if err := config.Envs.Validate(); err != nil {
+		fatal("Invalid configuration", err)
+	}
+
+	lc := lifecycle.New(config.Envs.ShutdownTimeout)
+
 	db, err := database.NewPostgresDB(config.Envs.DatabaseURL)
 
 	if err != nil {
-		log.Fatal(err)
+		fatal("Failed to connect to the database", err)
 	}
 
 	initDB(db)
 
-	server := api.NewServer(":8080", db)
-	if err := server.Run(); err != nil {
-		log.Fatal(err)
+	lc.OnShutdown("database", func(context.Context) error {
+		return db.Close()
+	})
+	lc.OnShutdown("background jobs", background.Wait)
+
+	server := api.NewServer(":"+config.Envs.Port, db)
+	lc.OnShutdown("http server", server.Shutdown)
+
+	if err := lc.Run(server.Run); err != nil {
+		fatal("Server failed", err)
 	}
 }
 
 func initDB(db *sql.DB) {
 	err := db.Ping()
 	if err != nil {
-		log.Fatal(err)
+		fatal("Failed to ping the database", err)
 	}
 
-	log.Println("Connected to the database")
+	slog.Info("Connected to the database")
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS currency_cache (
+    key VARCHAR(50) PRIMARY KEY,
+    data JSONB NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS alert_triggers;
+DROP TABLE IF EXISTS price_alerts;
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS price_alerts (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    coin_id VARCHAR(100) NOT NULL,
+    fiat VARCHAR(10) NOT NULL,
+    condition VARCHAR(20) NOT NULL,
+    threshold NUMERIC(30, 8) NOT NULL,
+    mode VARCHAR(20) NOT NULL DEFAULT 'once',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    armed BOOLEAN NOT NULL DEFAULT TRUE,
+    last_triggered_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS price_alerts_user_id_idx ON price_alerts (user_id);
+CREATE INDEX IF NOT EXISTS price_alerts_active_fiat_idx ON price_alerts (fiat) WHERE active;
+
+CREATE TABLE IF NOT EXISTS alert_triggers (
+    id SERIAL PRIMARY KEY,
+    alert_id INTEGER NOT NULL REFERENCES price_alerts (id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL,
+    coin_id VARCHAR(100) NOT NULL,
+    fiat VARCHAR(10) NOT NULL,
+    condition VARCHAR(20) NOT NULL,
+    threshold NUMERIC(30, 8) NOT NULL,
+    price NUMERIC(30, 8) NOT NULL,
+    change_24h NUMERIC(12, 4) NOT NULL,
+    triggered_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS alert_triggers_user_id_idx ON alert_triggers (user_id, triggered_at DESC);
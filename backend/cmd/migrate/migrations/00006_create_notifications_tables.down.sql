@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS webhook_dead_letters;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS notification_webhooks;
+DROP TABLE IF EXISTS notification_preferences;
+DROP TABLE IF EXISTS notifications;
@@ -0,0 +1 @@
+ALTER TABLE deals ALTER COLUMN currency_id TYPE VARCHAR(10);
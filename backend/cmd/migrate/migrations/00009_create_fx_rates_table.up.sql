@@ -0,0 +1,8 @@
+-- rate is the amount of currency for 1 USD at the end of date
+CREATE TABLE IF NOT EXISTS fx_rates (
+    currency VARCHAR(10) NOT NULL,
+    date DATE NOT NULL,
+    rate DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (currency, date)
+);
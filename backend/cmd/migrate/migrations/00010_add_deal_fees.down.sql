@@ -0,0 +1,2 @@
+ALTER TABLE deals DROP COLUMN IF EXISTS fee_currency;
+ALTER TABLE deals DROP COLUMN IF EXISTS fee;
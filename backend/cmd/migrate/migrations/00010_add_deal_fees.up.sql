@@ -0,0 +1,4 @@
+-- fee_currency is usd for a fee paid in fiat or the currency_id of the deal
+-- for a fee paid in the coin itself
+ALTER TABLE deals ADD COLUMN IF NOT EXISTS fee NUMERIC(20, 8) NOT NULL DEFAULT 0;
+ALTER TABLE deals ADD COLUMN IF NOT EXISTS fee_currency VARCHAR(100) NOT NULL DEFAULT 'usd';
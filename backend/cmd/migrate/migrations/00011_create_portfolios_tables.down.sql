@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS deals_portfolio_id_idx;
+ALTER TABLE deals DROP COLUMN IF EXISTS transfer_id;
+ALTER TABLE deals DROP COLUMN IF EXISTS portfolio_id;
+DROP TABLE IF EXISTS portfolio_transfers;
+DROP TABLE IF EXISTS portfolios;
@@ -0,0 +1,42 @@
+CREATE TABLE IF NOT EXISTS portfolios (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+-- Deals created without a portfolio go to the default portfolio of the user
+CREATE UNIQUE INDEX IF NOT EXISTS portfolios_user_default_idx ON portfolios (user_id) WHERE is_default;
+
+-- cost is the average cost of the coins in the source portfolio, carried
+-- over to the target portfolio
+CREATE TABLE IF NOT EXISTS portfolio_transfers (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    from_portfolio_id INTEGER NOT NULL REFERENCES portfolios (id),
+    to_portfolio_id INTEGER NOT NULL REFERENCES portfolios (id),
+    currency_id VARCHAR(100) NOT NULL,
+    count NUMERIC(20, 8) NOT NULL,
+    cost NUMERIC(20, 8) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS portfolio_transfers_user_id_idx ON portfolio_transfers (user_id);
+
+INSERT INTO portfolios (user_id, name, is_default)
+SELECT DISTINCT user_id, 'Main', TRUE FROM deals
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE deals ADD COLUMN IF NOT EXISTS portfolio_id INTEGER REFERENCES portfolios (id);
+ALTER TABLE deals ADD COLUMN IF NOT EXISTS transfer_id INTEGER REFERENCES portfolio_transfers (id) ON DELETE CASCADE;
+
+UPDATE deals SET portfolio_id = portfolios.id
+FROM portfolios
+WHERE portfolios.user_id = deals.user_id AND portfolios.is_default AND deals.portfolio_id IS NULL;
+
+ALTER TABLE deals ALTER COLUMN portfolio_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS deals_portfolio_id_idx ON deals (portfolio_id);
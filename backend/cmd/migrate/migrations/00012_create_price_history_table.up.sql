@@ -0,0 +1,9 @@
+-- price is the USD price of the coin at the end of date, the row of the
+-- current day is updated until the day is over
+CREATE TABLE IF NOT EXISTS price_history (
+    currency_id VARCHAR(100) NOT NULL,
+    date DATE NOT NULL,
+    price DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (currency_id, date)
+);
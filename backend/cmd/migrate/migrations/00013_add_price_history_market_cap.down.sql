@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_price_history_date_market_cap;
+ALTER TABLE price_history DROP COLUMN IF EXISTS market_cap;
@@ -0,0 +1,4 @@
+-- market_cap is the USD market cap of the coin at the end of date, it weighs
+-- the coins of the top 10 benchmark and is null for prices given without one
+ALTER TABLE price_history ADD COLUMN IF NOT EXISTS market_cap DOUBLE PRECISION;
+CREATE INDEX IF NOT EXISTS idx_price_history_date_market_cap ON price_history (date, market_cap DESC) WHERE market_cap IS NOT NULL;
@@ -0,0 +1,9 @@
+-- weight is the target share of the coin in the value of the portfolio, in
+-- percent, the weights of a portfolio add up to 100
+CREATE TABLE IF NOT EXISTS portfolio_targets (
+    portfolio_id INTEGER NOT NULL REFERENCES portfolios (id) ON DELETE CASCADE,
+    currency_id VARCHAR(100) NOT NULL,
+    weight NUMERIC(7, 4) NOT NULL CHECK (weight > 0 AND weight <= 100),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (portfolio_id, currency_id)
+);
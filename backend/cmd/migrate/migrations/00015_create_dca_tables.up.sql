@@ -0,0 +1,42 @@
+-- A plan buys amount of fiat worth of the coin every interval from start_at,
+-- runs counts the purchases already scheduled
+CREATE TABLE IF NOT EXISTS dca_plans (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    portfolio_id INTEGER NOT NULL REFERENCES portfolios (id) ON DELETE CASCADE,
+    currency_id VARCHAR(100) NOT NULL,
+    amount NUMERIC(20, 2) NOT NULL,
+    fiat VARCHAR(10) NOT NULL DEFAULT 'usd',
+    interval VARCHAR(20) NOT NULL,
+    mode VARCHAR(20) NOT NULL DEFAULT 'confirm',
+    start_at TIMESTAMP NOT NULL,
+    next_run_at TIMESTAMP NOT NULL,
+    runs INTEGER NOT NULL DEFAULT 0,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS dca_plans_user_id_idx ON dca_plans (user_id);
+CREATE INDEX IF NOT EXISTS dca_plans_next_run_at_idx ON dca_plans (next_run_at) WHERE active;
+
+-- status is pending until the user confirms or dismisses the purchase,
+-- executed when the deal was created by the job and failed when it could not
+-- be. count and price are in USD at the time of the run.
+CREATE TABLE IF NOT EXISTS dca_executions (
+    id SERIAL PRIMARY KEY,
+    plan_id INTEGER NOT NULL REFERENCES dca_plans (id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL,
+    currency_id VARCHAR(100) NOT NULL,
+    scheduled_at TIMESTAMP NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    count NUMERIC(20, 8) NOT NULL DEFAULT 0,
+    price NUMERIC(20, 8) NOT NULL DEFAULT 0,
+    deal_id INTEGER REFERENCES deals (id) ON DELETE SET NULL,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (plan_id, scheduled_at)
+);
+
+CREATE INDEX IF NOT EXISTS dca_executions_user_id_status_idx ON dca_executions (user_id, status);
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate is a number of requests per period, written like "10/1m" or "5/s".
+// A zero limit disables rate limiting.
+type Rate struct {
+	Limit  int
+	Period time.Duration
+}
+
+func (r *Rate) UnmarshalText(text []byte) error {
+	value := strings.TrimSpace(string(text))
+
+	if value == "" || value == "0" || value == "off" {
+		*r = Rate{}
+		return nil
+	}
+
+	count, period, ok := strings.Cut(value, "/")
+	if !ok {
+		return fmt.Errorf("invalid rate %q: expected <count>/<period>", value)
+	}
+
+	limit, err := strconv.Atoi(count)
+	if err != nil || limit < 0 {
+		return fmt.Errorf("invalid rate %q: bad count", value)
+	}
+
+	// "10/m" is read as "10/1m"
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("invalid rate %q: bad period", value)
+	}
+
+	*r = Rate{Limit: limit, Period: d}
+	return nil
+}
+
+func (r Rate) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r Rate) String() string {
+	if r.Disabled() {
+		return "off"
+	}
+
+	return fmt.Sprintf("%d/%s", r.Limit, r.Period)
+}
+
+func (r Rate) Disabled() bool {
+	return r.Limit <= 0
+}
+
+// PerSecond is the refill speed of a token bucket with this rate
+func (r Rate) PerSecond() float64 {
+	if r.Period <= 0 {
+		return 0
+	}
+
+	return float64(r.Limit) / r.Period.Seconds()
+}
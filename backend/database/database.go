@@ -2,7 +2,6 @@ package database
 
 import (
 	"database/sql"
-	"log"
 
 	_ "github.com/lib/pq"
 )
@@ -10,11 +9,12 @@ import (
 func NewPostgresDB(cfg string) (*sql.DB, error) {
 	db, err := sql.Open("postgres", cfg)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	if err := db.Ping(); err != nil {
-		log.Fatal(err)
+		db.Close()
+		return nil, err
 	}
 
 	return db, nil
@@ -0,0 +1,155 @@
+package health
+
+import (
+	"context"
+	"crypto-tracker/config"
+	"crypto-tracker/service/currency"
+	"crypto-tracker/types"
+	"crypto-tracker/utils"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	pingTimeout = 2 * time.Second
+
+	// The KZT conversion refuses rates older than a day
+	ratesAgeFailed = 24 * time.Hour
+)
+
+type Handler struct {
+	db              *sql.DB
+	currencyService *currency.Service
+	config          *config.Config
+}
+
+func NewHandler(db *sql.DB, currencyService *currency.Service, cfg *config.Config) *Handler {
+	return &Handler{
+		db:              db,
+		currencyService: currencyService,
+		config:          cfg,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/healthz", h.Liveness).Methods("GET")
+	router.HandleFunc("/readyz", h.Readiness).Methods("GET")
+}
+
+// Liveness only tells that the process serves requests
+func (h *Handler) Liveness(w http.ResponseWriter, r *http.Request) {
+	utils.WriteJSON(w, http.StatusOK, types.HealthReport{
+		Status:    types.HealthOK,
+		CheckedAt: time.Now(),
+	})
+}
+
+// Readiness checks the dependencies. A degraded component still serves
+// traffic, a failed one makes the instance not ready.
+func (h *Handler) Readiness(w http.ResponseWriter, r *http.Request) {
+	checks := []types.HealthCheck{h.checkDatabase(r.Context())}
+
+	for _, currencyCode := range h.currencyService.GetAllSupportedCurrencies() {
+		checks = append(checks, h.checkPrices(currencyCode))
+	}
+
+	checks = append(checks, h.checkExchangeRates(), h.checkChat())
+
+	report := types.HealthReport{
+		Status:    types.HealthOK,
+		Checks:    checks,
+		CheckedAt: time.Now(),
+	}
+
+	for _, check := range checks {
+		if check.Status == types.HealthFailed {
+			report.Status = types.HealthFailed
+			break
+		}
+
+		if check.Status == types.HealthDegraded {
+			report.Status = types.HealthDegraded
+		}
+	}
+
+	status := http.StatusOK
+	if report.Status == types.HealthFailed {
+		status = http.StatusServiceUnavailable
+	}
+
+	utils.WriteJSON(w, status, report)
+}
+
+func (h *Handler) checkDatabase(ctx context.Context) types.HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	check := types.HealthCheck{Name: "database", Status: types.HealthOK}
+
+	if err := h.db.PingContext(ctx); err != nil {
+		check.Status = types.HealthFailed
+		check.Message = err.Error()
+	}
+
+	return check
+}
+
+func (h *Handler) checkPrices(currencyCode string) types.HealthCheck {
+	check := types.HealthCheck{Name: "prices_" + currencyCode}
+
+	age, ok := h.currencyService.CacheAge(currencyCode)
+	if !ok {
+		check.Status = types.HealthFailed
+		check.Message = "no data fetched yet"
+		return check
+	}
+
+	// A missed refresh only degrades, many missed refreshes fail
+	refresh := h.config.PriceRefreshInterval
+	check.Status = ageStatus(age, 2*refresh, 10*refresh)
+	check.Message = fmt.Sprintf("updated %s ago", age.Round(time.Second))
+
+	return check
+}
+
+func (h *Handler) checkExchangeRates() types.HealthCheck {
+	check := types.HealthCheck{Name: "exchange_rates"}
+
+	age, ok := h.currencyService.RatesAge()
+	if !ok {
+		check.Status = types.HealthFailed
+		check.Message = "no rates fetched yet"
+		return check
+	}
+
+	check.Status = ageStatus(age, 2*h.config.RatesRefreshInterval, ratesAgeFailed)
+	check.Message = fmt.Sprintf("updated %s ago", age.Round(time.Second))
+
+	return check
+}
+
+func (h *Handler) checkChat() types.HealthCheck {
+	check := types.HealthCheck{Name: "chat_provider", Status: types.HealthOK}
+
+	if !h.config.ChatProviderConfigured() {
+		check.Status = types.HealthDegraded
+		check.Message = "Azure OpenAI is not configured"
+	}
+
+	return check
+}
+
+func ageStatus(age, degraded, failed time.Duration) types.HealthStatus {
+	switch {
+	case age >= failed:
+		return types.HealthFailed
+	case age >= degraded:
+		return types.HealthDegraded
+	default:
+		return types.HealthOK
+	}
+}
@@ -2,75 +2,88 @@ package jobs
 
 import (
 	"context"
-	"crypto-tracker/background"
+	"crypto-tracker/config"
+	"crypto-tracker/scheduler"
 	"crypto-tracker/service/currency"
-	"log"
+	"errors"
+	"fmt"
 	"time"
 )
 
 type Jobs struct {
+	config          *config.Config
 	currencyService *currency.Service
+	isLeader        func() bool
 }
 
-func NewJobs(currencyService *currency.Service) *Jobs {
+func NewJobs(cfg *config.Config, currencyService *currency.Service, isLeader func() bool) *Jobs {
 	return &Jobs{
+		config:          cfg,
 		currencyService: currencyService,
+		isLeader:        isLeader,
 	}
 }
 
-// GetCurrencies is Background Job for getting in the all currencies every 60 seconds or 1 minute
-func (j *Jobs) GetCurrencies(ctx context.Context) background.JobFunc {
-	return func() {
-
-		err := j.currencyService.FetchExchangeRates()
-		if err != nil {
-			log.Printf("Initial exchange rate fetch failed: %v", err)
-		}
+func (j *Jobs) isFollower() bool {
+	return !j.isLeader()
+}
 
-		currencyTicker := time.NewTicker(60 * time.Second)
-		exchangeRateTicker := time.NewTicker(1 * time.Hour)
+// Register adds the background jobs to the scheduler. Exchange rates are
+// registered first, so on start they are fetched before the derived
+// currencies are calculated from the prices. Only the leader calls the
+// upstream APIs, the other instances sync the data published by the leader.
+func (j *Jobs) Register(s *scheduler.Scheduler) error {
+	return errors.Join(
+		s.Register(scheduler.Job{
+			Name:       "exchange-rates",
+			Spec:       scheduler.Every(j.config.RatesRefreshInterval),
+			Jitter:     time.Minute,
+			RunAtStart: true,
+			Timeout:    30 * time.Second,
+			Enabled:    j.isLeader,
+			Run:        j.UpdateExchangeRates,
+		}),
+		s.Register(scheduler.Job{
+			Name:       "currency-prices",
+			Spec:       scheduler.Every(j.config.PriceRefreshInterval),
+			Jitter:     2 * time.Second,
+			RunAtStart: true,
+			Timeout:    45 * time.Second,
+			Enabled:    j.isLeader,
+			Run:        j.UpdateCurrencies,
+		}),
+		s.Register(scheduler.Job{
+			Name:       "currency-sync",
+			Spec:       scheduler.Every(j.config.CacheSyncInterval),
+			RunAtStart: true,
+			Timeout:    15 * time.Second,
+			Enabled:    j.isFollower,
+			Run:        j.currencyService.SyncSharedCache,
+		}),
+	)
+}
 
-		defer currencyTicker.Stop()
-		defer exchangeRateTicker.Stop()
+// UpdateExchangeRates refreshes the rates used for the derived currencies
+func (j *Jobs) UpdateExchangeRates(ctx context.Context) error {
+	return j.currencyService.FetchExchangeRates(ctx)
+}
 
-		// Initial fetching data, after that will fetch in background every 60 second
-		supportedCurrencies := j.currencyService.GetSupportedDirectCurrencies()
+// UpdateCurrencies fetches the prices of every directly supported currency
+// and recalculates the derived ones
+func (j *Jobs) UpdateCurrencies(ctx context.Context) error {
+	var errs []error
 
-		for _, currencyCode := range supportedCurrencies {
-			err := j.currencyService.FetchCurrencyData(currencyCode)
-			if err != nil {
-				log.Printf("Error fetching %s data: %v\n", currencyCode, err)
-			}
-		}
-
-		err = j.currencyService.UpdateDerivedCurrencies()
+	for _, currencyCode := range j.currencyService.GetSupportedDirectCurrencies() {
+		err := j.currencyService.FetchCurrencyData(ctx, currencyCode)
 		if err != nil {
-			log.Printf("Error updating derived currencies: %v\n", err)
+			errs = append(errs, fmt.Errorf("error fetching %s data: %w", currencyCode, err))
 		}
+	}
 
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-currencyTicker.C:
-				for _, currencyCode := range supportedCurrencies {
-					err := j.currencyService.FetchCurrencyData(currencyCode)
-					if err != nil {
-						log.Printf("Error fetching %s data: %v\n", currencyCode, err)
-					}
-				}
-
-				err = j.currencyService.UpdateDerivedCurrencies()
-				if err != nil {
-					log.Printf("Error updating derived currencies: %v\n", err)
-				}
-
-			case <-exchangeRateTicker.C:
-				err := j.currencyService.FetchExchangeRates()
-				if err != nil {
-					log.Printf("Error fetching exchange rates: %v\n", err)
-				}
-			}
-		}
+	err := j.currencyService.UpdateDerivedCurrencies(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("error updating derived currencies: %w", err))
 	}
+
+	return errors.Join(errs...)
 }
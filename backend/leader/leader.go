@@ -0,0 +1,118 @@
+package leader
+
+import (
+	"context"
+	"crypto-tracker/background"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Elector elects one leader among the instances sharing the database. The
+// leader holds a session level Postgres advisory lock on a dedicated
+// connection, so when the leader dies its session ends, the lock is released
+// and another instance takes over on its next attempt.
+type Elector struct {
+	db       *sql.DB
+	key      int64
+	interval time.Duration
+
+	mu     sync.RWMutex
+	conn   *sql.Conn
+	leader bool
+}
+
+func NewElector(db *sql.DB, key int64, interval time.Duration) *Elector {
+	return &Elector{
+		db:       db,
+		key:      key,
+		interval: interval,
+	}
+}
+
+func (e *Elector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.leader
+}
+
+// Start makes the first attempt synchronously, so the role is known before
+// the jobs start, and keeps checking the lock until ctx is done.
+func (e *Elector) Start(ctx context.Context) {
+	e.check(ctx)
+
+	background.Go(func() {
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				e.release()
+				return
+			case <-ticker.C:
+				e.check(ctx)
+			}
+		}
+	})
+}
+
+func (e *Elector) check(ctx context.Context) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.leader {
+		// The lock lives as long as the session, a broken connection means
+		// the lock is gone as well
+		if err := e.conn.PingContext(ctx); err != nil {
+			slog.Warn("Lost leadership", "error", err)
+			e.conn.Close()
+			e.conn = nil
+			e.leader = false
+		}
+		return
+	}
+
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		slog.Error("Leader election failed", "error", err)
+		return
+	}
+
+	var acquired bool
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", e.key).Scan(&acquired)
+	if err != nil || !acquired {
+		if err != nil {
+			slog.Error("Leader election failed", "error", err)
+		}
+		conn.Close()
+		return
+	}
+
+	e.conn = conn
+	e.leader = true
+	slog.Info("Became the leader for background jobs")
+}
+
+func (e *Elector) release() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.leader {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := e.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", e.key); err != nil {
+		slog.Error("Failed to release leadership", "error", err)
+	}
+
+	e.conn.Close()
+	e.conn = nil
+	e.leader = false
+	slog.Info("Released leadership")
+}
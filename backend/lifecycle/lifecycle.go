@@ -0,0 +1,100 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Manager owns the root context of the application. The context is cancelled
+// on SIGINT or SIGTERM, after that the registered shutdown hooks run in
+// reverse order of registration within the shutdown timeout.
+type Manager struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timeout time.Duration
+	mu      sync.Mutex
+	hooks   []hook
+}
+
+func New(timeout time.Duration) *Manager {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	return &Manager{
+		ctx:     ctx,
+		cancel:  cancel,
+		timeout: timeout,
+	}
+}
+
+// Context is cancelled as soon as the shutdown starts.
+func (m *Manager) Context() context.Context {
+	return m.ctx
+}
+
+// OnShutdown registers fn to run on shutdown. Hooks run last in, first out,
+// so resources should be registered before the components that use them.
+func (m *Manager) OnShutdown(name string, fn func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.hooks = append(m.hooks, hook{name: name, fn: fn})
+}
+
+// Run calls start in its own goroutine and blocks until a signal arrives or
+// start returns, then shuts everything down.
+func (m *Manager) Run(start func(ctx context.Context) error) error {
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- start(m.ctx)
+	}()
+
+	var runErr error
+	select {
+	case <-m.ctx.Done():
+		slog.Info("Shutdown signal received")
+	case runErr = <-errCh:
+		if runErr != nil {
+			slog.Error("Server stopped", "error", runErr)
+		}
+	}
+
+	return errors.Join(runErr, m.Shutdown())
+}
+
+func (m *Manager) Shutdown() error {
+	m.cancel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	m.mu.Lock()
+	hooks := m.hooks
+	m.hooks = nil
+	m.mu.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		h := hooks[i]
+
+		slog.Info("Shutting down", "component", h.name)
+		if err := h.fn(ctx); err != nil {
+			slog.Error("Error shutting down", "component", h.name, "error", err)
+			errs = append(errs, err)
+		}
+	}
+
+	slog.Info("Shutdown complete")
+	return errors.Join(errs...)
+}
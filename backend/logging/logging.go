@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+type contextKey string
+
+const requestIDKey contextKey = "requestId"
+
+// RequestIDHeader carries the request ID in requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are never written to the logs, whatever group they are in
+var sensitiveKeys = map[string]bool{
+	"password":      true,
+	"token":         true,
+	"authorization": true,
+	"secret":        true,
+	"api_key":       true,
+	"content":       true,
+	"prompt":        true,
+	"system_prompt": true,
+	"messages":      true,
+}
+
+// Setup installs the default slog logger. The standard log package writes
+// through it as well. Level is one of debug, info, warn or error and format
+// is text or json.
+func Setup(level, format string) error {
+	return setup(os.Stdout, level, format)
+}
+
+func setup(w io.Writer, level, format string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	opts := &slog.HandlerOptions{
+		Level:       lvl,
+		ReplaceAttr: redact,
+	}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	case "text", "":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid log format %q", format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redacted)
+	}
+
+	return a
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// FromContext returns the default logger annotated with the request ID of ctx
+func FromContext(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+
+	if id := RequestID(ctx); id != "" {
+		logger = logger.With("request_id", id)
+	}
+
+	return logger
+}
@@ -0,0 +1,185 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "crypto_tracker"
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	UpstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_request_duration_seconds",
+		Help:      "Latency of calls to upstream providers.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"provider"})
+
+	UpstreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_errors_total",
+		Help:      "Failed calls to upstream providers.",
+	}, []string{"provider"})
+
+	CacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "currency_cache_requests_total",
+		Help:      "Currency cache lookups by currency and result (hit or miss).",
+	}, []string{"currency", "result"})
+
+	JobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_run_duration_seconds",
+		Help:      "Duration of background job runs by job and result.",
+		Buckets:   []float64{.1, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"job", "result"})
+
+	ChatTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "chat_tokens_total",
+		Help:      "Tokens used by the AI chat by type (prompt or completion).",
+	}, []string{"type"})
+
+	RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Requests rejected by the rate limiter by route group.",
+	}, []string{"group"})
+
+	Notifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_total",
+		Help:      "Notifications by event, channel and result.",
+	}, []string{"event", "channel", "result"})
+)
+
+// ObserveUpstream records the latency and the error of an upstream call
+// started at start.
+func ObserveUpstream(provider string, start time.Time, err error) {
+	UpstreamDuration.WithLabelValues(provider).Observe(time.Since(start).Seconds())
+	if err != nil {
+		UpstreamErrors.WithLabelValues(provider).Inc()
+	}
+}
+
+func ObserveJob(job string, duration time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+
+	JobDuration.WithLabelValues(job, result).Observe(duration.Seconds())
+}
+
+// RegisterDB exposes the pool statistics of db
+func RegisterDB(db *sql.DB, name string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// DataAgeSource reports how old the cached data is, see currency.Service
+type DataAgeSource interface {
+	GetAllSupportedCurrencies() []string
+	CacheAge(currencyCode string) (time.Duration, bool)
+	RatesAge() (time.Duration, bool)
+}
+
+type dataAgeCollector struct {
+	source   DataAgeSource
+	dataAge  *prometheus.Desc
+	ratesAge *prometheus.Desc
+}
+
+// RegisterDataAge exposes the age of the cached prices per currency and of
+// the exchange rates, the gauges alert on stale prices.
+func RegisterDataAge(source DataAgeSource) {
+	prometheus.MustRegister(&dataAgeCollector{
+		source: source,
+		dataAge: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "currency_data_age_seconds"),
+			"Seconds since the cached prices of the currency were fetched.",
+			[]string{"currency"}, nil,
+		),
+		ratesAge: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "exchange_rates_age_seconds"),
+			"Seconds since the exchange rates were fetched.",
+			nil, nil,
+		),
+	})
+}
+
+func (c *dataAgeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.dataAge
+	ch <- c.ratesAge
+}
+
+func (c *dataAgeCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, currencyCode := range c.source.GetAllSupportedCurrencies() {
+		if age, ok := c.source.CacheAge(currencyCode); ok {
+			ch <- prometheus.MustNewConstMetric(c.dataAge, prometheus.GaugeValue, age.Seconds(), currencyCode)
+		}
+	}
+
+	if age, ok := c.source.RatesAge(); ok {
+		ch <- prometheus.MustNewConstMetric(c.ratesAge, prometheus.GaugeValue, age.Seconds())
+	}
+}
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Middleware counts requests and observes their latency per mux route
+// template, so paths with ids do not explode the label cardinality.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+
+		next.ServeHTTP(recorder, r)
+
+		HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(recorder.status)).Inc()
+		HTTPDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,25 @@
+package middlewares
+
+import (
+	"crypto-tracker/utils"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+)
+
+// AdminOnly lets through only requests carrying the configured admin token in
+// the X-Admin-Token header. An empty token disables the admin routes.
+func AdminOnly(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provided := r.Header.Get("X-Admin-Token")
+
+			if token == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				utils.WriteError(w, http.StatusForbidden, fmt.Errorf("permission denied"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -1,19 +1,120 @@
 package middlewares
 
-import "net/http"
+import (
+	"crypto-tracker/apperr"
+	"crypto-tracker/utils"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	ErrOriginNotAllowed = apperr.New(http.StatusForbidden, "origin_not_allowed", "origin not allowed")
+	ErrMethodNotAllowed = apperr.New(http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+)
+
+var (
+	corsMethods        = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	corsAllowedHeaders = "Authorization, Content-Type, X-Request-ID, X-Admin-Token"
+	corsExposedHeaders = "X-Request-ID, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy, Retry-After, Content-Disposition"
+)
+
+type CORSOptions struct {
+	// AllowedOrigins are full origins like "https://example.com", "*" allows any
+	AllowedOrigins   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// CORS reflects the Origin header only for the allowed origins and answers
+// the preflight requests itself. The allowed methods of a preflight are the
+// methods of the routes of router that match the path.
+func CORS(router *mux.Router, opts CORSOptions) http.Handler {
+	anyOrigin := slices.Contains(opts.AllowedOrigins, "*")
 
-func CORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		header := w.Header()
+		header.Add("Vary", "Origin")
+
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+		if origin == "" {
+			router.ServeHTTP(w, r)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		allowed := anyOrigin || slices.Contains(opts.AllowedOrigins, origin)
+		if !allowed {
+			if preflight {
+				utils.WriteServiceError(w, ErrOriginNotAllowed)
+				return
+			}
+
+			// The browser blocks the response without the CORS headers
+			router.ServeHTTP(w, r)
+			return
+		}
+
+		if anyOrigin && !opts.AllowCredentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if opts.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			header.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			router.ServeHTTP(w, r)
+			return
+		}
+
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+
+		methods := routeMethods(router, r)
+		if len(methods) == 0 {
+			utils.WriteServiceError(w, apperr.ErrNotFound)
+			return
+		}
+
+		allow := strings.Join(methods, ", ")
+		if !slices.Contains(methods, r.Header.Get("Access-Control-Request-Method")) {
+			header.Set("Allow", allow)
+			utils.WriteServiceError(w, ErrMethodNotAllowed)
+			return
+		}
+
+		header.Set("Access-Control-Allow-Methods", allow)
+		header.Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+		if opts.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+		}
+
+		w.WriteHeader(http.StatusNoContent)
 	})
 }
+
+// routeMethods returns the methods a route of router accepts for the path of r
+func routeMethods(router *mux.Router, r *http.Request) []string {
+	var methods []string
+
+	for _, method := range corsMethods {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+
+		var match mux.RouteMatch
+		if router.Match(probe, &match) && match.MatchErr == nil {
+			methods = append(methods, method)
+		}
+	}
+
+	return methods
+}
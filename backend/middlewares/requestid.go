@@ -0,0 +1,49 @@
+package middlewares
+
+import (
+	"crypto-tracker/logging"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestID takes the request ID from the X-Request-ID header or generates
+// one, stores it in the request context and echoes it in the response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(logging.RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(logging.RequestIDHeader, id)
+
+		ctx := logging.WithRequestID(r.Context(), id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts only short IDs of safe characters, so clients can
+// not inject anything into the logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
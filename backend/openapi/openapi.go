@@ -0,0 +1,111 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// BasePath is the prefix of the API routes, the paths of the spec are relative to it
+const BasePath = "/api/v1"
+
+//go:embed openapi.json
+var spec []byte
+
+const swaggerUI = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <title>Crypto Tracker API</title>
+    <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>
+    window.onload = () => {
+        window.ui = SwaggerUIBundle({url: "` + BasePath + `/openapi.json", dom_id: "#swagger-ui"});
+    };
+</script>
+</body>
+</html>
+`
+
+type Handler struct{}
+
+func NewHandler() *Handler {
+	return &Handler{}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/openapi.json", h.GetSpec).Methods("GET")
+	router.HandleFunc("/docs", h.GetDocs).Methods("GET")
+}
+
+func (h *Handler) GetSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(spec)
+}
+
+func (h *Handler) GetDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(swaggerUI))
+}
+
+// pathVariable matches mux variables with a pattern such as {id:[0-9]+}
+var pathVariable = regexp.MustCompile(`\{([^}:]+):[^}]*\}`)
+
+// MissingRoutes walks the router and returns "METHOD /path" for every API
+// route that the spec does not document.
+func MissingRoutes(router *mux.Router) ([]string, error) {
+	var document struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+
+	if err := json.Unmarshal(spec, &document); err != nil {
+		return nil, fmt.Errorf("error parsing openapi spec: %w", err)
+	}
+
+	var missing []string
+
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(template, BasePath) {
+			return nil
+		}
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Subrouters and routes without methods are not endpoints
+			return nil
+		}
+
+		path := pathVariable.ReplaceAllString(strings.TrimPrefix(template, BasePath), "{$1}")
+
+		for _, method := range methods {
+			if method == http.MethodOptions {
+				continue
+			}
+
+			if _, ok := document.Paths[path][strings.ToLower(method)]; !ok {
+				missing = append(missing, method+" "+path)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(missing)
+	return missing, nil
+}
@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"crypto-tracker/service/auth"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// IPResolver finds the client address of a request. X-Forwarded-For is read
+// only when the request comes from a trusted proxy, and then from the right,
+// skipping the trusted proxies, so that a client cannot spoof its address.
+type IPResolver struct {
+	trusted []netip.Prefix
+}
+
+// NewIPResolver accepts addresses and CIDRs of the trusted proxies
+func NewIPResolver(proxies []string) (*IPResolver, error) {
+	resolver := &IPResolver{}
+
+	for _, proxy := range proxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+
+		resolver.trusted = append(resolver.trusted, prefix.Masked())
+	}
+
+	return resolver, nil
+}
+
+func (res *IPResolver) ClientIP(r *http.Request) string {
+	remote := parseAddr(r.RemoteAddr)
+	if !remote.IsValid() {
+		return r.RemoteAddr
+	}
+
+	if !res.isTrusted(remote) {
+		return remote.String()
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr := parseAddr(strings.TrimSpace(hops[i]))
+		if !addr.IsValid() {
+			break
+		}
+
+		client = addr
+		if !res.isTrusted(addr) {
+			break
+		}
+	}
+
+	return client.String()
+}
+
+func (res *IPResolver) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range res.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseAddr accepts "ip" and "ip:port"
+func parseAddr(value string) netip.Addr {
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}
+	}
+
+	return addr.Unmap()
+}
+
+// ByIP keys the requests by client address
+func ByIP(res *IPResolver) KeyFunc {
+	return func(r *http.Request) string {
+		return "ip:" + res.ClientIP(r)
+	}
+}
+
+// ByUser keys the requests by the authenticated user and falls back to the
+// client address. It must run after auth.AuthMiddleware.
+func ByUser(res *IPResolver) KeyFunc {
+	return func(r *http.Request) string {
+		if userID := auth.GetUserIDFromContext(r.Context()); userID > 0 {
+			return "user:" + strconv.Itoa(userID)
+		}
+
+		return "ip:" + res.ClientIP(r)
+	}
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto-tracker/config"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often the memory store drops the full buckets
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	period  time.Duration
+}
+
+// MemoryStore keeps the buckets of a single instance.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *MemoryStore) Take(ctx context.Context, key string, rate config.Rate) (Result, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastSweep) > sweepInterval {
+		m.sweep(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rate.Limit), updated: now}
+		m.buckets[key] = b
+	}
+
+	tokens, result := take(b.tokens, now.Sub(b.updated), rate)
+	b.tokens = tokens
+	b.updated = now
+	b.period = rate.Period
+
+	return result, nil
+}
+
+// sweep drops the buckets that had the time to refill completely, they are
+// the same as a new bucket
+func (m *MemoryStore) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if now.Sub(b.updated) > b.period {
+			delete(m.buckets, key)
+		}
+	}
+
+	m.lastSweep = now
+}
@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto-tracker/config"
+	"database/sql"
+	"time"
+)
+
+// PostgresStore keeps the buckets in the rate_limits table, so that every
+// instance shares the same limits. The clock of the database is used, the
+// clocks of the instances may differ.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (p *PostgresStore) Take(ctx context.Context, key string, rate config.Rate) (Result, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO rate_limits (key, tokens, updated_at) VALUES ($1, $2, clock_timestamp())
+		ON CONFLICT (key) DO NOTHING`,
+		key, rate.Limit)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var tokens, elapsed float64
+	err = tx.QueryRowContext(ctx,
+		`SELECT tokens, EXTRACT(EPOCH FROM clock_timestamp() - updated_at)
+		FROM rate_limits WHERE key = $1 FOR UPDATE`,
+		key).Scan(&tokens, &elapsed)
+	if err != nil {
+		return Result{}, err
+	}
+
+	tokens, result := take(tokens, seconds(elapsed), rate)
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE rate_limits SET tokens = $2, updated_at = clock_timestamp() WHERE key = $1`,
+		key, tokens)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return result, tx.Commit()
+}
+
+// Cleanup deletes the buckets not used for olderThan
+func (p *PostgresStore) Cleanup(ctx context.Context, olderThan time.Duration) error {
+	_, err := p.db.ExecContext(ctx,
+		`DELETE FROM rate_limits WHERE updated_at < clock_timestamp() - $1 * INTERVAL '1 second'`,
+		olderThan.Seconds())
+
+	return err
+}
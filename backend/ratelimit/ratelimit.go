@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto-tracker/apperr"
+	"crypto-tracker/config"
+	"crypto-tracker/logging"
+	"crypto-tracker/metrics"
+	"crypto-tracker/utils"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Result is the state of a bucket after a request took, or failed to take, a token.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is the time until the next token, set when not allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps the token buckets. Take refills the bucket of key and takes one
+// token from it when there is one.
+type Store interface {
+	Take(ctx context.Context, key string, rate config.Rate) (Result, error)
+}
+
+// take is the token bucket shared by the stores. The bucket holds up to
+// rate.Limit tokens and refills at rate.Limit per rate.Period.
+func take(tokens float64, elapsed time.Duration, rate config.Rate) (float64, Result) {
+	perSecond := rate.PerSecond()
+	capacity := float64(rate.Limit)
+
+	if elapsed > 0 {
+		tokens = math.Min(capacity, tokens+elapsed.Seconds()*perSecond)
+	}
+
+	result := Result{Limit: rate.Limit}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - tokens) / perSecond)
+	}
+
+	result.Remaining = int(math.Floor(tokens))
+	result.Reset = seconds((capacity - tokens) / perSecond)
+
+	return tokens, result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// KeyFunc returns the key of the bucket a request counts against
+type KeyFunc func(r *http.Request) string
+
+// Limiter limits one group of routes.
+type Limiter struct {
+	group string
+	rate  config.Rate
+	store Store
+	key   KeyFunc
+}
+
+func New(group string, rate config.Rate, store Store, key KeyFunc) *Limiter {
+	return &Limiter{
+		group: group,
+		rate:  rate,
+		store: store,
+		key:   key,
+	}
+}
+
+// Middleware sets the RateLimit-* headers and answers 429 once the bucket is
+// empty. When the store fails the request is let through, so that an outage
+// of the database does not take the API down with it.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	if l.rate.Disabled() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := l.group + ":" + l.key(r)
+
+		result, err := l.store.Take(r.Context(), key, l.rate)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("Rate limit check failed", "group", l.group, "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := w.Header()
+		header.Set("RateLimit-Policy", strconv.Itoa(l.rate.Limit)+";w="+strconv.Itoa(ceilSeconds(l.rate.Period)))
+		header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+		if !result.Allowed {
+			metrics.RateLimited.WithLabelValues(l.group).Inc()
+			header.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			utils.WriteServiceError(w, apperr.ErrTooMany)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
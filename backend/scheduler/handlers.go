@@ -0,0 +1,38 @@
+package scheduler
+
+import (
+	"crypto-tracker/utils"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	scheduler *Scheduler
+}
+
+func NewHandler(scheduler *Scheduler) *Handler {
+	return &Handler{
+		scheduler: scheduler,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/jobs", h.GetJobs).Methods("GET")
+	router.HandleFunc("/jobs/{name}/run", h.RunJob).Methods("POST")
+}
+
+func (h *Handler) GetJobs(w http.ResponseWriter, r *http.Request) {
+	utils.WriteJSON(w, http.StatusOK, h.scheduler.Statuses())
+}
+
+func (h *Handler) RunJob(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	if err := h.scheduler.Trigger(name); err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusAccepted, map[string]string{"result": "scheduled"})
+}
@@ -0,0 +1,262 @@
+package scheduler
+
+import (
+	"context"
+	"crypto-tracker/apperr"
+	"crypto-tracker/background"
+	"crypto-tracker/metrics"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrJobNotFound = apperr.New(http.StatusNotFound, "job_not_found", "job not found")
+	ErrJobRunning  = apperr.New(http.StatusConflict, "job_running", "job is already running")
+	ErrNotStarted  = apperr.New(http.StatusServiceUnavailable, "scheduler_not_started", "scheduler is not started")
+)
+
+// Job is a named unit of periodic work.
+type Job struct {
+	Name string
+	Spec Spec
+	// Jitter delays every scheduled run by a random duration up to Jitter
+	Jitter time.Duration
+	// RunAtStart runs the job once when the scheduler starts. Such jobs run
+	// one after another in the order of registration before any periodic
+	// run begins.
+	RunAtStart bool
+	// Timeout cancels the context passed to Run, zero means no timeout
+	Timeout time.Duration
+	// Enabled is checked before every run, a nil Enabled means always
+	Enabled func() bool
+	Run     func(ctx context.Context) error
+}
+
+type Status struct {
+	Name         string     `json:"name"`
+	Schedule     string     `json:"schedule"`
+	Running      bool       `json:"running"`
+	LastRun      *time.Time `json:"last_run,omitempty"`
+	LastDuration string     `json:"last_duration,omitempty"`
+	LastSuccess  *time.Time `json:"last_success,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	NextRun      *time.Time `json:"next_run,omitempty"`
+	Runs         int64      `json:"runs"`
+	Failures     int64      `json:"failures"`
+	Skipped      int64      `json:"skipped"`
+}
+
+type entry struct {
+	job     Job
+	mu      sync.Mutex
+	running bool
+	status  Status
+}
+
+type Scheduler struct {
+	mu      sync.RWMutex
+	entries []*entry
+	byName  map[string]*entry
+	ctx     context.Context
+}
+
+func New() *Scheduler {
+	return &Scheduler{
+		byName: make(map[string]*entry),
+	}
+}
+
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" || job.Spec == nil || job.Run == nil {
+		return fmt.Errorf("job requires a name, a spec and a run function")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.byName[job.Name]; exists {
+		return fmt.Errorf("job %s is already registered", job.Name)
+	}
+
+	e := &entry{
+		job: job,
+		status: Status{
+			Name:     job.Name,
+			Schedule: job.Spec.String(),
+		},
+	}
+
+	s.entries = append(s.entries, e)
+	s.byName[job.Name] = e
+
+	// Jobs registered after Start are scheduled right away
+	if s.ctx != nil {
+		ctx := s.ctx
+		background.Go(func() { s.loop(ctx, e) })
+	}
+
+	return nil
+}
+
+// Start runs the start-up jobs and then schedules every job until ctx is done.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.ctx = ctx
+	entries := append([]*entry(nil), s.entries...)
+	s.mu.Unlock()
+
+	background.Go(func() {
+		for _, e := range entries {
+			if ctx.Err() != nil {
+				return
+			}
+
+			if e.job.RunAtStart {
+				s.run(ctx, e)
+			}
+		}
+
+		for _, e := range entries {
+			background.Go(func() { s.loop(ctx, e) })
+		}
+	})
+}
+
+// Trigger runs the job immediately in the background unless it is running.
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.RLock()
+	e, ok := s.byName[name]
+	ctx := s.ctx
+	s.mu.RUnlock()
+
+	if !ok {
+		return ErrJobNotFound
+	}
+
+	if ctx == nil {
+		return ErrNotStarted
+	}
+
+	e.mu.Lock()
+	running := e.running
+	e.mu.Unlock()
+
+	if running {
+		return ErrJobRunning
+	}
+
+	background.Go(func() { s.run(ctx, e) })
+
+	return nil
+}
+
+func (s *Scheduler) Statuses() []Status {
+	s.mu.RLock()
+	entries := append([]*entry(nil), s.entries...)
+	s.mu.RUnlock()
+
+	statuses := make([]Status, 0, len(entries))
+	for _, e := range entries {
+		e.mu.Lock()
+		status := e.status
+		status.Running = e.running
+		e.mu.Unlock()
+
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	return statuses
+}
+
+func (s *Scheduler) loop(ctx context.Context, e *entry) {
+	for {
+		next := e.job.Spec.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+
+		if e.job.Jitter > 0 {
+			next = next.Add(rand.N(e.job.Jitter))
+		}
+
+		e.mu.Lock()
+		e.status.NextRun = &next
+		e.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.run(ctx, e)
+	}
+}
+
+// run executes the job once. A run that is due while the previous one is
+// still in progress is skipped, so runs of the same job never overlap. Runs
+// of a disabled job are skipped as well.
+func (s *Scheduler) run(ctx context.Context, e *entry) {
+	e.mu.Lock()
+	if e.running || (e.job.Enabled != nil && !e.job.Enabled()) {
+		e.status.Skipped++
+		e.mu.Unlock()
+		return
+	}
+
+	start := time.Now()
+	e.running = true
+	e.status.LastRun = &start
+	e.mu.Unlock()
+
+	runCtx := ctx
+	if e.job.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, e.job.Timeout)
+		defer cancel()
+	}
+
+	err := safeRun(runCtx, e.job.Run)
+	end := time.Now()
+
+	metrics.ObserveJob(e.job.Name, end.Sub(start), err)
+
+	e.mu.Lock()
+	e.running = false
+	e.status.Runs++
+	e.status.LastDuration = end.Sub(start).String()
+	if err != nil {
+		e.status.Failures++
+		e.status.LastError = err.Error()
+	} else {
+		e.status.LastError = ""
+		e.status.LastSuccess = &end
+	}
+	e.mu.Unlock()
+
+	if err != nil {
+		slog.Error("Job failed", "job", e.job.Name, "error", err)
+	}
+}
+
+func safeRun(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return fn(ctx)
+}
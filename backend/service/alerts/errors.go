@@ -0,0 +1,13 @@
+package alerts
+
+import (
+	"crypto-tracker/apperr"
+	"net/http"
+)
+
+var (
+	ErrAlertNotFound   = apperr.New(http.StatusNotFound, "alert_not_found", "alert not found")
+	ErrInvalidAlertID  = apperr.New(http.StatusBadRequest, "invalid_alert_id", "invalid alert id")
+	ErrTooManyAlerts   = apperr.New(http.StatusConflict, "too_many_alerts", "too many alerts")
+	ErrUnsupportedFiat = apperr.New(http.StatusBadRequest, "unsupported_currency", "unsupported currency")
+)
@@ -0,0 +1,153 @@
+package alerts
+
+import (
+	"crypto-tracker/service/auth"
+	"crypto-tracker/types"
+	"crypto-tracker/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// RegisterRoutes expects an /alerts router that requires authentication
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("", h.ListAlerts).Methods("GET")
+	router.HandleFunc("", h.CreateAlert).Methods("POST")
+	router.HandleFunc("/triggers", h.ListTriggers).Methods("GET")
+	router.HandleFunc("/{id:[0-9]+}", h.GetAlert).Methods("GET")
+	router.HandleFunc("/{id:[0-9]+}", h.UpdateAlert).Methods("PUT")
+	router.HandleFunc("/{id:[0-9]+}", h.DeleteAlert).Methods("DELETE")
+	router.HandleFunc("/{id:[0-9]+}/triggers", h.ListTriggers).Methods("GET")
+}
+
+func alertID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return 0, ErrInvalidAlertID
+	}
+
+	return id, nil
+}
+
+func (h *Handler) ListAlerts(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	alerts, err := h.service.List(r.Context(), userID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, alerts)
+}
+
+func (h *Handler) CreateAlert(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	var payload types.PriceAlertPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	alert, err := h.service.Create(r.Context(), userID, payload)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, alert)
+}
+
+func (h *Handler) GetAlert(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := alertID(r)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	alert, err := h.service.Get(r.Context(), userID, id)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, alert)
+}
+
+func (h *Handler) UpdateAlert(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := alertID(r)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	var payload types.PriceAlertPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	alert, err := h.service.Update(r.Context(), userID, id, payload)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, alert)
+}
+
+func (h *Handler) DeleteAlert(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := alertID(r)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), userID, id); err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+// ListTriggers returns the trigger history of all the alerts of the user or,
+// under /alerts/{id}/triggers, of one alert
+func (h *Handler) ListTriggers(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	var id int64
+	if _, ok := mux.Vars(r)["id"]; ok {
+		var err error
+		if id, err = alertID(r); err != nil {
+			utils.WriteServiceError(w, err)
+			return
+		}
+	}
+
+	triggers, err := h.service.Triggers(r.Context(), userID, id)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, triggers)
+}
@@ -0,0 +1,260 @@
+package alerts
+
+import (
+	"context"
+	"crypto-tracker/types"
+	"database/sql"
+	"errors"
+)
+
+const alertColumns = `id, user_id, coin_id, fiat, condition, threshold, mode, active, armed, last_triggered_at, created_at, updated_at`
+
+type Repository struct {
+	DB *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{DB: db}
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAlert(row scanner) (*types.PriceAlert, error) {
+	var alert types.PriceAlert
+	var lastTriggeredAt sql.NullTime
+
+	err := row.Scan(
+		&alert.Id,
+		&alert.UserId,
+		&alert.CoinId,
+		&alert.Fiat,
+		&alert.Condition,
+		&alert.Threshold,
+		&alert.Mode,
+		&alert.Active,
+		&alert.Armed,
+		&lastTriggeredAt,
+		&alert.CreatedAt,
+		&alert.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if lastTriggeredAt.Valid {
+		alert.LastTriggeredAt = &lastTriggeredAt.Time
+	}
+
+	return &alert, nil
+}
+
+func (r *Repository) queryAlerts(ctx context.Context, query string, args ...any) ([]*types.PriceAlert, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := make([]*types.PriceAlert, 0)
+	for rows.Next() {
+		alert, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		alerts = append(alerts, alert)
+	}
+
+	return alerts, rows.Err()
+}
+
+func (r *Repository) Create(ctx context.Context, alert *types.PriceAlert) error {
+	query := `
+		INSERT INTO price_alerts (user_id, coin_id, fiat, condition, threshold, mode, active, armed, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, TRUE, NOW(), NOW())
+		RETURNING id, armed, created_at, updated_at
+	`
+
+	return r.DB.QueryRowContext(ctx, query,
+		alert.UserId,
+		alert.CoinId,
+		alert.Fiat,
+		alert.Condition,
+		alert.Threshold,
+		alert.Mode,
+		alert.Active,
+	).Scan(&alert.Id, &alert.Armed, &alert.CreatedAt, &alert.UpdatedAt)
+}
+
+// GetByID returns the alert of the user, ErrAlertNotFound when the alert
+// does not exist or belongs to someone else
+func (r *Repository) GetByID(ctx context.Context, userID int, id int64) (*types.PriceAlert, error) {
+	query := `SELECT ` + alertColumns + ` FROM price_alerts WHERE id = $1 AND user_id = $2`
+
+	alert, err := scanAlert(r.DB.QueryRowContext(ctx, query, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAlertNotFound
+	}
+
+	return alert, err
+}
+
+func (r *Repository) GetByUserID(ctx context.Context, userID int) ([]*types.PriceAlert, error) {
+	query := `SELECT ` + alertColumns + ` FROM price_alerts WHERE user_id = $1 ORDER BY created_at DESC`
+
+	return r.queryAlerts(ctx, query, userID)
+}
+
+func (r *Repository) CountByUserID(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := r.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM price_alerts WHERE user_id = $1`, userID).Scan(&count)
+
+	return count, err
+}
+
+// GetActiveByFiat returns the active alerts of every user in the currency
+func (r *Repository) GetActiveByFiat(ctx context.Context, fiat string) ([]*types.PriceAlert, error) {
+	query := `SELECT ` + alertColumns + ` FROM price_alerts WHERE fiat = $1 AND active ORDER BY id`
+
+	return r.queryAlerts(ctx, query, fiat)
+}
+
+// Update saves the settings of the alert and arms it again
+func (r *Repository) Update(ctx context.Context, alert *types.PriceAlert) error {
+	query := `
+		UPDATE price_alerts
+		SET coin_id = $3, fiat = $4, condition = $5, threshold = $6, mode = $7, active = $8, armed = TRUE, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+		RETURNING armed, updated_at
+	`
+
+	err := r.DB.QueryRowContext(ctx, query,
+		alert.Id,
+		alert.UserId,
+		alert.CoinId,
+		alert.Fiat,
+		alert.Condition,
+		alert.Threshold,
+		alert.Mode,
+		alert.Active,
+	).Scan(&alert.Armed, &alert.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrAlertNotFound
+	}
+
+	return err
+}
+
+func (r *Repository) Delete(ctx context.Context, userID int, id int64) error {
+	result, err := r.DB.ExecContext(ctx, `DELETE FROM price_alerts WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrAlertNotFound
+	}
+
+	return nil
+}
+
+// Fire records the trigger and disarms the alert, a one-shot alert is
+// deactivated as well. The alert is updated only while it is still armed, so
+// that two evaluations racing each other fire it once.
+func (r *Repository) Fire(ctx context.Context, trigger *types.AlertTrigger, deactivate bool) (bool, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE price_alerts
+		SET armed = FALSE, active = active AND NOT $2, last_triggered_at = NOW()
+		WHERE id = $1 AND armed AND active
+	`, trigger.AlertId, deactivate)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		return false, err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO alert_triggers (alert_id, user_id, coin_id, fiat, condition, threshold, price, change_24h, triggered_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
+		RETURNING id, triggered_at
+	`,
+		trigger.AlertId,
+		trigger.UserId,
+		trigger.CoinId,
+		trigger.Fiat,
+		trigger.Condition,
+		trigger.Threshold,
+		trigger.Price,
+		trigger.Change24h,
+	).Scan(&trigger.Id, &trigger.TriggeredAt)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func (r *Repository) Rearm(ctx context.Context, id int64) error {
+	_, err := r.DB.ExecContext(ctx, `UPDATE price_alerts SET armed = TRUE WHERE id = $1 AND active`, id)
+
+	return err
+}
+
+// GetTriggers returns the trigger history of the user, of one alert when
+// alertID is not zero, newest first
+func (r *Repository) GetTriggers(ctx context.Context, userID int, alertID int64, limit int) ([]*types.AlertTrigger, error) {
+	query := `
+		SELECT id, alert_id, user_id, coin_id, fiat, condition, threshold, price, change_24h, triggered_at
+		FROM alert_triggers
+		WHERE user_id = $1 AND ($2 = 0 OR alert_id = $2)
+		ORDER BY triggered_at DESC, id DESC
+		LIMIT $3
+	`
+
+	rows, err := r.DB.QueryContext(ctx, query, userID, alertID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	triggers := make([]*types.AlertTrigger, 0)
+	for rows.Next() {
+		var trigger types.AlertTrigger
+
+		err := rows.Scan(
+			&trigger.Id,
+			&trigger.AlertId,
+			&trigger.UserId,
+			&trigger.CoinId,
+			&trigger.Fiat,
+			&trigger.Condition,
+			&trigger.Threshold,
+			&trigger.Price,
+			&trigger.Change24h,
+			&trigger.TriggeredAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		triggers = append(triggers, &trigger)
+	}
+
+	return triggers, rows.Err()
+}
@@ -0,0 +1,345 @@
+package alerts
+
+import (
+	"context"
+	"crypto-tracker/apperr"
+	"crypto-tracker/background"
+	"crypto-tracker/config"
+	"crypto-tracker/logging"
+	"crypto-tracker/metrics"
+	"crypto-tracker/types"
+	"crypto-tracker/utils"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ConditionAbove         = "above"
+	ConditionBelow         = "below"
+	ConditionPercentChange = "percent_change"
+
+	ModeOnce      = "once"
+	ModeRecurring = "recurring"
+
+	triggersLimit = 100
+)
+
+// CurrencyProvider is the part of currency.Service the alerts need
+type CurrencyProvider interface {
+	IsCurrencySupported(currency string) bool
+	Coin(ctx context.Context, currencyCode, coinID string) (*types.CurrencyResponse, error)
+}
+
+type Service struct {
+	repo       *Repository
+	currencies CurrencyProvider
+	notifier   types.Notifier
+	hysteresis float64
+	maxPerUser int
+
+	// pending holds the latest prices of every fiat refreshed since the last
+	// evaluation, wake tells the evaluator about them
+	mu      sync.Mutex
+	pending map[string][]types.CurrencyResponse
+	wake    chan struct{}
+}
+
+func NewService(repo *Repository, currencies CurrencyProvider, notifier types.Notifier, cfg *config.Config) *Service {
+	return &Service{
+		repo:       repo,
+		currencies: currencies,
+		notifier:   notifier,
+		hysteresis: cfg.AlertHysteresis,
+		maxPerUser: cfg.AlertMaxPerUser,
+		pending:    make(map[string][]types.CurrencyResponse),
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+func (s *Service) List(ctx context.Context, userID int) ([]*types.PriceAlert, error) {
+	return s.repo.GetByUserID(ctx, userID)
+}
+
+func (s *Service) Get(ctx context.Context, userID int, id int64) (*types.PriceAlert, error) {
+	return s.repo.GetByID(ctx, userID, id)
+}
+
+func (s *Service) Create(ctx context.Context, userID int, payload types.PriceAlertPayload) (*types.PriceAlert, error) {
+	alert, err := s.fromPayload(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := s.repo.CountByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if count >= s.maxPerUser {
+		return nil, fmt.Errorf("%w: at most %d alerts per user", ErrTooManyAlerts, s.maxPerUser)
+	}
+
+	alert.UserId = userID
+	if err := s.repo.Create(ctx, alert); err != nil {
+		return nil, err
+	}
+
+	return alert, nil
+}
+
+// Update replaces the settings of the alert and arms it again
+func (s *Service) Update(ctx context.Context, userID int, id int64, payload types.PriceAlertPayload) (*types.PriceAlert, error) {
+	existing, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	alert, err := s.fromPayload(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	alert.Id = existing.Id
+	alert.UserId = existing.UserId
+	alert.CreatedAt = existing.CreatedAt
+	alert.LastTriggeredAt = existing.LastTriggeredAt
+
+	if err := s.repo.Update(ctx, alert); err != nil {
+		return nil, err
+	}
+
+	return alert, nil
+}
+
+func (s *Service) Delete(ctx context.Context, userID int, id int64) error {
+	return s.repo.Delete(ctx, userID, id)
+}
+
+// Triggers returns the latest triggers of the user, of one alert when alertID
+// is not zero
+func (s *Service) Triggers(ctx context.Context, userID int, alertID int64) ([]*types.AlertTrigger, error) {
+	if alertID != 0 {
+		if _, err := s.repo.GetByID(ctx, userID, alertID); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.repo.GetTriggers(ctx, userID, alertID, triggersLimit)
+}
+
+func (s *Service) fromPayload(ctx context.Context, payload types.PriceAlertPayload) (*types.PriceAlert, error) {
+	if err := utils.Validate.Struct(payload); err != nil {
+		return nil, apperr.FromValidator(err)
+	}
+
+	alert := &types.PriceAlert{
+		CoinId:    strings.ToLower(strings.TrimSpace(payload.CoinId)),
+		Fiat:      strings.ToLower(strings.TrimSpace(payload.Fiat)),
+		Condition: payload.Condition,
+		Threshold: payload.Threshold,
+		Mode:      payload.Mode,
+		Active:    true,
+	}
+
+	if alert.Mode == "" {
+		alert.Mode = ModeOnce
+	}
+
+	if payload.Active != nil {
+		alert.Active = *payload.Active
+	}
+
+	if !s.currencies.IsCurrencySupported(alert.Fiat) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFiat, alert.Fiat)
+	}
+
+	if _, err := s.currencies.Coin(ctx, alert.Fiat, alert.CoinId); err != nil {
+		return nil, err
+	}
+
+	return alert, nil
+}
+
+// OnRefresh is the listener of the price refreshes, see
+// currency.Service.OnRefresh. A refresh can happen on a request, so it only
+// queues the prices for the evaluator started by Start. The prices of a fiat
+// not evaluated yet are replaced by the newer ones.
+func (s *Service) OnRefresh(ctx context.Context, fiat string, data []types.CurrencyResponse) {
+	s.mu.Lock()
+	s.pending[fiat] = data
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start evaluates the alerts against the queued prices until ctx is done,
+// like the scheduler jobs it runs with background.Go so that the shutdown
+// waits for it. Only the leader evaluates, so that an alert is not fired by
+// every instance.
+func (s *Service) Start(ctx context.Context, isLeader func() bool) {
+	background.Go(func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.wake:
+			}
+
+			s.mu.Lock()
+			pending := s.pending
+			s.pending = make(map[string][]types.CurrencyResponse, len(pending))
+			s.mu.Unlock()
+
+			if !isLeader() {
+				continue
+			}
+
+			for fiat, data := range pending {
+				start := time.Now()
+				err := s.safeEvaluate(ctx, fiat, data)
+				metrics.ObserveJob("price-alerts", time.Since(start), err)
+
+				if err != nil {
+					logging.FromContext(ctx).Error("Error evaluating price alerts", "fiat", fiat, "error", err)
+				}
+			}
+		}
+	})
+}
+
+// safeEvaluate is Evaluate with a panic returned as an error, so that the
+// evaluator keeps running for the next refreshes
+func (s *Service) safeEvaluate(ctx context.Context, fiat string, data []types.CurrencyResponse) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return s.Evaluate(ctx, fiat, data)
+}
+
+// Evaluate checks the active alerts in the currency against data. An alert
+// fires when its condition is met while it is armed. After that it stays
+// disarmed until the price moves back past the threshold by the hysteresis,
+// so that a price hovering around the threshold does not fire it again and
+// again. An alert that cannot be fired or re-armed is logged and the others
+// are still evaluated, the errors are returned together.
+func (s *Service) Evaluate(ctx context.Context, fiat string, data []types.CurrencyResponse) error {
+	alerts, err := s.repo.GetActiveByFiat(ctx, fiat)
+	if err != nil {
+		return err
+	}
+
+	if len(alerts) == 0 {
+		return nil
+	}
+
+	coins := make(map[string]*types.CurrencyResponse, len(data))
+	for i := range data {
+		coins[data[i].Id] = &data[i]
+	}
+
+	logger := logging.FromContext(ctx)
+
+	var errs []error
+	for _, alert := range alerts {
+		coin, ok := coins[alert.CoinId]
+		if !ok {
+			continue
+		}
+
+		met, cleared := s.check(alert, coin)
+
+		switch {
+		case alert.Armed && met:
+			trigger := &types.AlertTrigger{
+				AlertId:   alert.Id,
+				UserId:    alert.UserId,
+				CoinId:    alert.CoinId,
+				Fiat:      alert.Fiat,
+				Condition: alert.Condition,
+				Threshold: alert.Threshold,
+				Price:     coin.CurrentPrice,
+				Change24h: coin.PriceChangePercentage24Hour,
+			}
+
+			fired, err := s.repo.Fire(ctx, trigger, alert.Mode == ModeOnce)
+			if err != nil {
+				logger.Error("Error firing price alert", "alert_id", alert.Id, "error", err)
+				errs = append(errs, fmt.Errorf("error firing alert %d: %w", alert.Id, err))
+				continue
+			}
+
+			if fired {
+				logger.Info("Price alert triggered",
+					"alert_id", alert.Id,
+					"user_id", alert.UserId,
+					"coin", alert.CoinId,
+					"condition", alert.Condition,
+					"price", coin.CurrentPrice,
+				)
+
+				if err := s.notifier.Notify(ctx, triggerMessage(trigger)); err != nil {
+					logger.Error("Error sending price alert notification", "alert_id", alert.Id, "error", err)
+				}
+			}
+		case !alert.Armed && cleared:
+			if err := s.repo.Rearm(ctx, alert.Id); err != nil {
+				logger.Error("Error re-arming price alert", "alert_id", alert.Id, "error", err)
+				errs = append(errs, fmt.Errorf("error re-arming alert %d: %w", alert.Id, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// check reports whether the condition of the alert is met and whether it is
+// cleared, that is the value is back on the other side of the threshold by
+// more than the hysteresis
+func (s *Service) check(alert *types.PriceAlert, coin *types.CurrencyResponse) (met, cleared bool) {
+	threshold := alert.Threshold
+
+	switch alert.Condition {
+	case ConditionAbove:
+		return coin.CurrentPrice >= threshold, coin.CurrentPrice < threshold*(1-s.hysteresis)
+	case ConditionBelow:
+		return coin.CurrentPrice <= threshold, coin.CurrentPrice > threshold*(1+s.hysteresis)
+	case ConditionPercentChange:
+		change := math.Abs(coin.PriceChangePercentage24Hour)
+		return change >= threshold, change < threshold*(1-s.hysteresis)
+	default:
+		return false, false
+	}
+}
+
+func triggerMessage(trigger *types.AlertTrigger) types.NotificationMessage {
+	coin := strings.ToUpper(trigger.CoinId)
+	fiat := strings.ToUpper(trigger.Fiat)
+
+	var title string
+	switch trigger.Condition {
+	case ConditionAbove:
+		title = fmt.Sprintf("%s is above %g %s", coin, trigger.Threshold, fiat)
+	case ConditionBelow:
+		title = fmt.Sprintf("%s is below %g %s", coin, trigger.Threshold, fiat)
+	default:
+		title = fmt.Sprintf("%s moved %.2f%% in 24h", coin, trigger.Change24h)
+	}
+
+	return types.NotificationMessage{
+		UserId: trigger.UserId,
+		Event:  types.EventPriceAlert,
+		Title:  title,
+		Body:   fmt.Sprintf("%s is at %g %s, %+.2f%% in the last 24 hours.", coin, trigger.Price, fiat, trigger.Change24h),
+		Data:   trigger,
+	}
+}
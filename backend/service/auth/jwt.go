@@ -3,10 +3,10 @@ package auth
 import (
 	"context"
 	"crypto-tracker/config"
+	"crypto-tracker/logging"
 	"crypto-tracker/types"
 	"crypto-tracker/utils"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 	"time"
@@ -20,17 +20,18 @@ const UserKey contextKey = "userId"
 
 func AuthMiddleware(next http.HandlerFunc, store types.UserStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		logger := logging.FromContext(r.Context())
 		tokenString := utils.GetTokenFromRequest(r)
 
 		token, err := ValidateJWT(tokenString)
 		if err != nil {
-			log.Printf("failed to validate token: %v", err)
+			logger.Warn("failed to validate token", "error", err)
 			PermissionDenied(w)
 			return
 		}
 
 		if !token.Valid {
-			log.Println("invalid token")
+			logger.Warn("invalid token")
 			PermissionDenied(w)
 			return
 		}
@@ -40,14 +41,13 @@ func AuthMiddleware(next http.HandlerFunc, store types.UserStore) http.HandlerFu
 
 		userId, err := strconv.Atoi(str)
 		if err != nil {
-			log.Printf("failed to convert userId to int: %v", err)
+			logger.Warn("failed to convert userId to int", "error", err)
 			PermissionDenied(w)
 			return
 		}
-		log.Printf("claims: %v, %T, %d", store, store, userId)
 		u, err := store.GetUserById(userId)
 		if err != nil {
-			log.Printf("failed to get user by id: %v", err)
+			logger.Warn("failed to get user by id", "user_id", userId, "error", err)
 			PermissionDenied(w)
 			return
 		}
@@ -61,7 +61,7 @@ func AuthMiddleware(next http.HandlerFunc, store types.UserStore) http.HandlerFu
 }
 
 func CreateJWT(secret []byte, userId int) (string, error) {
-	expiration := time.Second * time.Duration(config.Envs.JWTExpiration)
+	expiration := config.Envs.JWTExpiration
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"userId":    strconv.Itoa(userId),
@@ -0,0 +1,12 @@
+package chat
+
+import (
+	"crypto-tracker/apperr"
+	"net/http"
+)
+
+var (
+	ErrUnknownTemplate  = apperr.New(http.StatusBadRequest, "unknown_template", "unknown chat template")
+	ErrContentFiltered  = apperr.New(http.StatusBadRequest, "content_filtered", "Be a decent person.")
+	ErrModelUnavailable = apperr.New(http.StatusBadGateway, "model_unavailable", "no response from the AI model")
+)
@@ -0,0 +1,160 @@
+package chat
+
+import (
+	"bytes"
+	"crypto-tracker/types"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const DefaultTemplate = "market_explainer"
+
+// PromptTemplate is a server-side system prompt. Content is a text/template
+// rendered with PromptData, so templates can refer to {{.User.FirstName}},
+// {{.Date}} or range over {{.Portfolio}}.
+type PromptTemplate struct {
+	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Content     string `json:"content"`
+
+	tmpl *template.Template
+}
+
+type PromptData struct {
+	User      *types.User
+	Portfolio []*types.Portfolio
+	Date      string
+}
+
+// PortfolioProvider lets the chat templates include the holdings of the user.
+type PortfolioProvider interface {
+	GetUserPortfolio(userID string, portfolioID int64) (map[string]*types.Portfolio, error)
+}
+
+var defaultTemplates = []PromptTemplate{
+	{
+		Name:        "market_explainer",
+		Title:       "Market explainer",
+		Description: "Explains crypto market moves, coins and terminology.",
+		Content: `You are the assistant of Crypto Tracker, an application for tracking crypto currencies and portfolios.
+You help {{.User.FirstName}} with questions connected with crypto currencies and markets. Today is {{.Date}}.
+Explain market moves, coins and terminology clearly and neutrally. Do not give financial advice.
+If the user asks about sexual, racist or other offensive topics, refuse to continue the theme.`,
+	},
+	{
+		Name:        "portfolio_review",
+		Title:       "Portfolio review",
+		Description: "Reviews the holdings of the user and discusses allocation and risk.",
+		Content: `You are the assistant of Crypto Tracker and review the crypto portfolio of {{.User.FirstName}} {{.User.LastName}}. Today is {{.Date}}.
+{{if .Portfolio}}Current holdings (average price and cost in USD):
+{{range .Portfolio}}- {{.CurrencyID}}: {{printf "%.8f" .TotalCount}} at {{printf "%.2f" .AvgPrice}}, cost {{printf "%.2f" .TotalCost}}
+{{end}}{{else}}The user has no holdings yet.
+{{end}}Discuss diversification, concentration and risk. Do not give financial advice.
+If the user asks about sexual, racist or other offensive topics, refuse to continue the theme.`,
+	},
+	{
+		Name:        "beginner_tutor",
+		Title:       "Beginner tutor",
+		Description: "Teaches crypto basics step by step without jargon.",
+		Content: `You are a patient tutor who teaches {{.User.FirstName}} the basics of crypto currencies.
+Assume no prior knowledge, avoid jargon, use short examples and check understanding with simple questions.
+Do not give financial advice.
+If the user asks about sexual, racist or other offensive topics, refuse to continue the theme.`,
+	},
+}
+
+// PromptRegistry holds the prompt templates selectable by name.
+type PromptRegistry struct {
+	templates map[string]*PromptTemplate
+}
+
+// NewPromptRegistry returns the built-in templates, overridden or extended by
+// the templates from the JSON file at path when path is not empty.
+func NewPromptRegistry(path string) (*PromptRegistry, error) {
+	registry := &PromptRegistry{templates: make(map[string]*PromptTemplate)}
+
+	for _, t := range defaultTemplates {
+		if err := registry.add(t); err != nil {
+			return nil, err
+		}
+	}
+
+	if path == "" {
+		return registry, nil
+	}
+
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading chat prompts file: %w", err)
+	}
+
+	var templates []PromptTemplate
+	if err := json.Unmarshal(file, &templates); err != nil {
+		return nil, fmt.Errorf("error parsing chat prompts file: %w", err)
+	}
+
+	for _, t := range templates {
+		if err := registry.add(t); err != nil {
+			return nil, err
+		}
+	}
+
+	return registry, nil
+}
+
+func (p *PromptRegistry) add(t PromptTemplate) error {
+	if t.Name == "" {
+		return fmt.Errorf("chat prompt template without name")
+	}
+
+	tmpl, err := template.New(t.Name).Option("missingkey=zero").Parse(t.Content)
+	if err != nil {
+		return fmt.Errorf("error parsing chat prompt template %s: %w", t.Name, err)
+	}
+
+	t.tmpl = tmpl
+	p.templates[t.Name] = &t
+
+	return nil
+}
+
+func (p *PromptRegistry) Get(name string) (*PromptTemplate, bool) {
+	t, ok := p.templates[name]
+	return t, ok
+}
+
+func (p *PromptRegistry) List() []*PromptTemplate {
+	templates := make([]*PromptTemplate, 0, len(p.templates))
+	for _, t := range p.templates {
+		templates = append(templates, t)
+	}
+
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+
+	return templates
+}
+
+func (t *PromptTemplate) Render(data PromptData) (string, error) {
+	if data.Date == "" {
+		data.Date = time.Now().Format("2006-01-02")
+	}
+
+	if data.User == nil {
+		data.User = &types.User{}
+	}
+
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("error rendering chat prompt template %s: %w", t.Name, err)
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
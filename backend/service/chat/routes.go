@@ -3,24 +3,43 @@ package chat
 import (
 	"context"
 	"crypto-tracker/config"
+	"crypto-tracker/logging"
+	"crypto-tracker/metrics"
 	"crypto-tracker/service/auth"
 	"crypto-tracker/types"
+	"crypto-tracker/utils"
 	"encoding/json"
+	"fmt"
 	"github.com/Azure/azure-sdk-for-go/sdk/ai/azopenai"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/gorilla/mux"
-	"log"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Handler struct {
-	userStore       types.UserStore
-	client          *azopenai.Client
-	modelDeployment string
+	userStore         types.UserStore
+	portfolios        PortfolioProvider
+	prompts           *PromptRegistry
+	defaultTemplate   string
+	allowClientPrompt bool
+	client            *azopenai.Client
+	modelDeployment   string
 }
 
-func NewHandler(config *config.Config, userStore types.UserStore) (*Handler, error) {
+func NewHandler(config *config.Config, userStore types.UserStore, portfolios PortfolioProvider) (*Handler, error) {
+	prompts, err := NewPromptRegistry(config.ChatPromptsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := prompts.Get(config.ChatDefaultTemplate); !ok {
+		return nil, fmt.Errorf("unknown default chat template: %s", config.ChatDefaultTemplate)
+	}
+
 	keyCredential := azcore.NewKeyCredential(config.AzureOpenAIKey)
 	client, err := azopenai.NewClientWithKeyCredential(config.AzureOpenAIEndpoint, keyCredential, nil)
 	if err != nil {
@@ -28,38 +47,110 @@ func NewHandler(config *config.Config, userStore types.UserStore) (*Handler, err
 	}
 
 	return &Handler{
-		client:          client,
-		modelDeployment: config.ModelDeploymentID,
-		userStore:       userStore,
+		client:            client,
+		modelDeployment:   config.ModelDeploymentID,
+		userStore:         userStore,
+		portfolios:        portfolios,
+		prompts:           prompts,
+		defaultTemplate:   config.ChatDefaultTemplate,
+		allowClientPrompt: config.ChatAllowClientSystemPrompt,
 	}, nil
 }
 
+// RegisterRoutes expects a /chat router that requires authentication
 func (h *Handler) RegisterRoutes(router *mux.Router) {
-	router.Handle("/chat", auth.AuthMiddleware(h.HandleChat, h.userStore)).Methods("POST", "OPTIONS")
+	router.HandleFunc("", h.HandleChat).Methods("POST")
+	router.HandleFunc("/templates", h.HandleTemplates).Methods("GET")
 }
 
-func (h *Handler) HandleChat(w http.ResponseWriter, r *http.Request) {
-	log.Println("handling chat")
+func (h *Handler) HandleTemplates(w http.ResponseWriter, r *http.Request) {
+	templates := make([]types.ChatTemplate, 0)
+	for _, t := range h.prompts.List() {
+		templates = append(templates, types.ChatTemplate{
+			Name:        t.Name,
+			Title:       t.Title,
+			Description: t.Description,
+		})
+	}
+
+	utils.WriteJSON(w, http.StatusOK, templates)
+}
+
+// systemPrompt renders the requested template for the user. The prompt sent by
+// the client is appended only when the policy allows it.
+func (h *Handler) systemPrompt(ctx context.Context, userId int, chatReq types.ChatRequest) (string, error) {
+	name := chatReq.Template
+	if name == "" {
+		name = h.defaultTemplate
+	}
+
+	tmpl, ok := h.prompts.Get(name)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+
+	data := PromptData{}
+
+	user, err := h.userStore.GetUserById(userId)
+	if err != nil {
+		return "", err
+	}
+	data.User = user
+
+	if h.portfolios != nil {
+		portfolio, err := h.portfolios.GetUserPortfolio(strconv.Itoa(userId), 0)
+		if err != nil {
+			logging.FromContext(ctx).Warn("failed to get portfolio for chat template", "error", err)
+		}
+
+		for _, entry := range portfolio {
+			data.Portfolio = append(data.Portfolio, entry)
+		}
+
+		sort.Slice(data.Portfolio, func(i, j int) bool {
+			return data.Portfolio[i].CurrencyID < data.Portfolio[j].CurrencyID
+		})
+	}
+
+	prompt, err := tmpl.Render(data)
+	if err != nil {
+		return "", err
+	}
+
+	if h.allowClientPrompt && chatReq.SystemPrompt != "" {
+		prompt += "\n\n" + chatReq.SystemPrompt
+	}
+
+	return prompt, nil
+}
 
+func (h *Handler) HandleChat(w http.ResponseWriter, r *http.Request) {
 	userId := auth.GetUserIDFromContext(r.Context())
 
 	var chatReq types.ChatRequest
 	if err := json.NewDecoder(r.Body).Decode(&chatReq); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request body"))
 		return
 	}
 
-	log.Printf("Received chat request: %+v", chatReq)
+	logging.FromContext(r.Context()).Info("Received chat request",
+		"user_id", userId,
+		"template", chatReq.Template,
+		"messages_count", len(chatReq.Messages),
+	)
+
+	systemPrompt, err := h.systemPrompt(r.Context(), userId, chatReq)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
 
 	azureMessages := make([]azopenai.ChatRequestMessageClassification, 0, len(chatReq.Messages)+1)
 
-	if chatReq.SystemPrompt != "" {
-		azureMessages = append(azureMessages,
-			&azopenai.ChatRequestSystemMessage{
-				Content: azopenai.NewChatRequestSystemMessageContent(chatReq.SystemPrompt),
-			})
-	}
-	log.Printf("Received chat request: %+v", chatReq)
+	azureMessages = append(azureMessages,
+		&azopenai.ChatRequestSystemMessage{
+			Content: azopenai.NewChatRequestSystemMessageContent(systemPrompt),
+		})
 
 	for _, msg := range chatReq.Messages {
 		switch msg.Role {
@@ -76,6 +167,7 @@ func (h *Handler) HandleChat(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	start := time.Now()
 	resp, err := h.client.GetChatCompletions(
 		context.TODO(),
 		azopenai.ChatCompletionsOptions{
@@ -84,28 +176,30 @@ func (h *Handler) HandleChat(w http.ResponseWriter, r *http.Request) {
 		},
 		nil,
 	)
-
-	w.Header().Set("Content-Type", "application/json")
+	metrics.ObserveUpstream("azure_openai", start, err)
 
 	if err != nil {
-		statusCode := http.StatusInternalServerError
-		errorMsg := err.Error()
-
-		if strings.Contains(strings.ToLower(errorMsg), "content_filter") {
-			statusCode = http.StatusBadRequest
-			errorMsg = "Be a decent person."
+		if strings.Contains(strings.ToLower(err.Error()), "content_filter") {
+			utils.WriteServiceError(w, ErrContentFiltered)
+			return
 		}
 
-		w.WriteHeader(statusCode)
-		json.NewEncoder(w).Encode(types.ChatResponse{
-			Error: errorMsg,
-		})
+		logging.FromContext(r.Context()).Error("Chat completion failed", "error", err)
+		utils.WriteServiceError(w, ErrModelUnavailable)
 		return
 	}
 
+	if resp.Usage != nil {
+		if resp.Usage.PromptTokens != nil {
+			metrics.ChatTokens.WithLabelValues("prompt").Add(float64(*resp.Usage.PromptTokens))
+		}
+		if resp.Usage.CompletionTokens != nil {
+			metrics.ChatTokens.WithLabelValues("completion").Add(float64(*resp.Usage.CompletionTokens))
+		}
+	}
+
 	if len(resp.Choices) == 0 {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(types.ChatResponse{Error: "No response from the AI model"})
+		utils.WriteServiceError(w, ErrModelUnavailable)
 		return
 	}
 
@@ -120,7 +214,7 @@ func (h *Handler) HandleChat(w http.ResponseWriter, r *http.Request) {
 		messageContent = *choice.Message.Content
 	}
 
-	json.NewEncoder(w).Encode(types.ChatResponse{
+	utils.WriteJSON(w, http.StatusOK, types.ChatResponse{
 		Message:      messageContent,
 		FinishReason: finishReason,
 		UserId:       userId,
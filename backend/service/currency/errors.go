@@ -0,0 +1,12 @@
+package currency
+
+import (
+	"crypto-tracker/apperr"
+	"net/http"
+)
+
+var (
+	ErrUnsupportedCurrency = apperr.New(http.StatusBadRequest, "unsupported_currency", "unsupported currency")
+	ErrUnknownCoin         = apperr.New(http.StatusBadRequest, "unknown_coin", "unknown coin")
+	ErrUpstreamUnavailable = apperr.New(http.StatusServiceUnavailable, "upstream_unavailable", "currency data is not available")
+)
@@ -4,7 +4,7 @@ import (
 	"crypto-tracker/utils"
 	"fmt"
 	"github.com/gorilla/mux"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 )
@@ -20,7 +20,7 @@ func NewHandler(service *Service) *Handler {
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
-	router.HandleFunc("/currency", h.HandleCurrencies).Methods("GET", "OPTIONS")
+	router.HandleFunc("/currency", h.HandleCurrencies).Methods("GET")
 }
 
 func (h *Handler) HandleCurrencies(w http.ResponseWriter, r *http.Request) {
@@ -32,21 +32,14 @@ func (h *Handler) HandleCurrencies(w http.ResponseWriter, r *http.Request) {
 
 	if !h.service.IsCurrencySupported(requestedCurrency) {
 		supportedList := strings.Join(h.service.GetAllSupportedCurrencies(), ", ")
-		utils.WriteError(
-			w,
-			http.StatusBadRequest,
-			fmt.Errorf("unsupported currency: %s (supported: %s)", requestedCurrency, supportedList))
+		utils.WriteServiceError(w, fmt.Errorf("%w: %s (supported: %s)", ErrUnsupportedCurrency, requestedCurrency, supportedList))
 		return
 	}
 
-	log.Printf("Getting data for %s\n", requestedCurrency)
-	currencyData, err := h.service.GetCurrencyData(requestedCurrency)
+	slog.DebugContext(r.Context(), "Getting currency data", "currency", requestedCurrency)
+	currencyData, err := h.service.GetCurrencyData(r.Context(), requestedCurrency)
 	if err != nil {
-		code := http.StatusInternalServerError
-		if strings.Contains(err.Error(), "not available") {
-			code = http.StatusServiceUnavailable
-		}
-		utils.WriteError(w, code, err)
+		utils.WriteServiceError(w, err)
 		return
 	}
 
@@ -0,0 +1,48 @@
+package currency
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// CacheRepository stores the fetched upstream data in the currency_cache
+// table, so instances that are not the leader serve the data fetched by the
+// leader instead of calling the upstream APIs themselves.
+type CacheRepository struct {
+	DB *sql.DB
+}
+
+func NewCacheRepository(db *sql.DB) *CacheRepository {
+	return &CacheRepository{DB: db}
+}
+
+func (r *CacheRepository) Save(ctx context.Context, key string, data []byte, updatedAt time.Time) error {
+	query := `
+		INSERT INTO currency_cache (key, data, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET data = EXCLUDED.data, updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := r.DB.ExecContext(ctx, query, key, data, updatedAt)
+	return err
+}
+
+// Load returns nil data when nothing is stored under the key
+func (r *CacheRepository) Load(ctx context.Context, key string) ([]byte, time.Time, error) {
+	query := `SELECT data, updated_at FROM currency_cache WHERE key = $1`
+
+	var data []byte
+	var updatedAt time.Time
+
+	err := r.DB.QueryRowContext(ctx, query, key).Scan(&data, &updatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, time.Time{}, nil
+		}
+		return nil, time.Time{}, err
+	}
+
+	return data, updatedAt, nil
+}
@@ -1,23 +1,39 @@
 package currency
 
 import (
+	"context"
 	"crypto-tracker/config"
+	"crypto-tracker/metrics"
 	"crypto-tracker/types"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 )
 
 const (
 	BASE_URL          = "https://api.coingecko.com/api/v3"
-	CACHE_EXPIRY      = time.Minute + time.Second*3
 	EXCHANGE_RATE_URL = "https://v6.exchangerate-api.com/v6/%s/latest/USD"
+
+	exchangeRatesKey = "exchange_rates"
 )
 
+// RefreshListener is called with the fresh data after the prices of a
+// currency were fetched or recalculated
+type RefreshListener func(ctx context.Context, currencyCode string, data []types.CurrencyResponse)
+
+// SharedCache persists fetched data for the other instances, see CacheRepository
+type SharedCache interface {
+	Save(ctx context.Context, key string, data []byte, updatedAt time.Time) error
+	Load(ctx context.Context, key string) ([]byte, time.Time, error)
+}
+
 type Service struct {
 	cache           map[string]CachedCurrencies
 	mu              sync.RWMutex
@@ -27,6 +43,9 @@ type Service struct {
 	baseURL         string
 	exchangeRateURL string
 	config          *config.Config
+	shared          SharedCache
+	isLeader        func() bool
+	listeners       []RefreshListener
 }
 
 type CachedCurrencies struct {
@@ -38,16 +57,16 @@ func NewService(cfg *config.Config) *Service {
 	return &Service{
 		cache:           make(map[string]CachedCurrencies),
 		exchangeRates:   make(map[string]float64),
-		httpClient:      &http.Client{Timeout: 10 * time.Second},
+		httpClient:      &http.Client{Timeout: cfg.UpstreamTimeout},
 		baseURL:         BASE_URL,
 		exchangeRateURL: EXCHANGE_RATE_URL,
 		config:          cfg,
 	}
 }
 
-func (s *Service) GetCurrencyData(currencyCode string) ([]types.CurrencyResponse, error) {
+func (s *Service) GetCurrencyData(ctx context.Context, currencyCode string) ([]types.CurrencyResponse, error) {
 	if !s.IsCurrencySupported(currencyCode) {
-		return nil, fmt.Errorf("unsupported currency: %s", currencyCode)
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, currencyCode)
 	}
 
 	cacheKey := "result_" + currencyCode
@@ -56,14 +75,22 @@ func (s *Service) GetCurrencyData(currencyCode string) ([]types.CurrencyResponse
 	cached, exists := s.cache[cacheKey]
 	s.mu.RUnlock()
 
-	if exists && time.Since(cached.Timestamp) < CACHE_EXPIRY {
-		log.Printf("Getting %s from cache\n", currencyCode)
+	if exists && time.Since(cached.Timestamp) < s.config.CacheExpiry {
+		metrics.CacheRequests.WithLabelValues(currencyCode, "hit").Inc()
+		slog.Debug("Getting currency data from cache", "currency", currencyCode)
 		return cached.Data, nil
 	}
 
+	metrics.CacheRequests.WithLabelValues(currencyCode, "miss").Inc()
+
 	// Fetching from gecko api directly supported currencies like eur and usd(kzt for my great sadness do not supported)
 	if s.IsCurrencyDirectlySupported(currencyCode) {
-		err := s.FetchCurrencyData(currencyCode)
+		var err error
+		if s.canFetchUpstream() {
+			err = s.FetchCurrencyData(ctx, currencyCode)
+		} else {
+			err = s.loadSharedCurrency(ctx, currencyCode)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -79,9 +106,9 @@ func (s *Service) GetCurrencyData(currencyCode string) ([]types.CurrencyResponse
 	if currencyCode == "kzt" {
 		// To get the kzt, we will use usd, and just using the exchange rate api, will convert usd to kzt
 		// because of this we should get firstly usd
-		_, err := s.GetCurrencyData("usd")
+		_, err := s.GetCurrencyData(ctx, "usd")
 		if err != nil {
-			return nil, fmt.Errorf("Failed to get USD data for KZT conversion: %w.", err)
+			return nil, fmt.Errorf("failed to get USD data for KZT conversion: %w", err)
 		}
 
 		s.mu.RLock()
@@ -90,10 +117,10 @@ func (s *Service) GetCurrencyData(currencyCode string) ([]types.CurrencyResponse
 		s.mu.RUnlock()
 
 		if !rateExists || rateAge > 24*time.Hour {
-			return nil, fmt.Errorf("KZT exchange rate data is not available or expired")
+			return nil, fmt.Errorf("%w: KZT exchange rate is missing or expired", ErrUpstreamUnavailable)
 		}
 
-		err = s.UpdateKZTData()
+		err = s.UpdateKZTData(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -105,15 +132,15 @@ func (s *Service) GetCurrencyData(currencyCode string) ([]types.CurrencyResponse
 		return kztData, nil
 	}
 
-	return nil, fmt.Errorf("unsupported currency handling for %s", currencyCode)
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, currencyCode)
 }
 
-func (s *Service) FetchCurrencyData(currencyCode string) error {
+func (s *Service) FetchCurrencyData(ctx context.Context, currencyCode string) error {
 	if !s.IsCurrencyDirectlySupported(currencyCode) {
-		return fmt.Errorf("currency %s is not directly supported", currencyCode)
+		return fmt.Errorf("%w: %s is not directly supported", ErrUnsupportedCurrency, currencyCode)
 	}
 
-	req, err := http.NewRequest("GET", s.baseURL+"/coins/markets?vs_currency="+currencyCode, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", s.baseURL+"/coins/markets?vs_currency="+currencyCode, nil)
 	if err != nil {
 		return err
 	}
@@ -122,17 +149,7 @@ func (s *Service) FetchCurrencyData(currencyCode string) error {
 		req.Header.Add("x-cg-pro-api-key", s.config.CoinGeckoKey)
 	}
 
-	response, err := s.httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer response.Body.Close()
-
-	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("API returned status code %d", response.StatusCode)
-	}
-
-	body, err := io.ReadAll(response.Body)
+	body, err := s.doUpstream("coingecko", req)
 	if err != nil {
 		return err
 	}
@@ -152,35 +169,28 @@ func (s *Service) FetchCurrencyData(currencyCode string) error {
 	}
 	s.mu.Unlock()
 
-	log.Printf("Updated cache for %s\n", currencyCode)
+	s.saveShared(ctx, cacheKey, currencies)
+	s.notifyRefresh(ctx, currencyCode, currencies)
+
+	slog.Debug("Updated currency cache", "currency", currencyCode)
 	return nil
 }
 
-func (s *Service) FetchExchangeRates() error {
-	log.Println("Fetching exchange rates...")
+func (s *Service) FetchExchangeRates(ctx context.Context) error {
+	slog.Debug("Fetching exchange rates")
 
 	// Because of Gecko API have not KZT, we should to convert usd to kzt, and for that
 	// I use Exchange-Rate API, there we get the exchange of dollar to every currency for that moment
 	query := fmt.Sprintf(s.exchangeRateURL, s.config.ExchangeRateKey)
-	req, err := http.NewRequest("GET", query, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", query, nil)
 	if err != nil {
 		return fmt.Errorf("error creating exchange rate request: %w", err)
 	}
 
-	response, err := s.httpClient.Do(req)
+	body, err := s.doUpstream("exchangerate", req)
 	if err != nil {
 		return fmt.Errorf("error fetching exchange rates: %w", err)
 	}
-	defer response.Body.Close()
-
-	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("exchange rate API returned status code %d", response.StatusCode)
-	}
-
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return fmt.Errorf("error reading exchange rate response: %w", err)
-	}
 
 	var rateResponse types.ExchangeRateResponse
 	err = json.Unmarshal(body, &rateResponse)
@@ -189,18 +199,16 @@ func (s *Service) FetchExchangeRates() error {
 	}
 
 	s.mu.Lock()
-	if rate, exists := rateResponse.Rates["EUR"]; exists {
-		s.exchangeRates["EUR"] = rate
-	}
-
-	if rate, exists := rateResponse.Rates["KZT"]; exists {
-		s.exchangeRates["KZT"] = rate
+	for code, rate := range rateResponse.Rates {
+		s.exchangeRates[code] = rate
 	}
 
 	s.ratesUpdateTime = time.Now()
 	s.mu.Unlock()
 
-	log.Printf("Exchange rates updated successfully")
+	s.saveShared(ctx, exchangeRatesKey, rateResponse.Rates)
+
+	slog.Info("Exchange rates updated")
 	return nil
 }
 
@@ -216,22 +224,52 @@ func (s *Service) GetExchangeRate(currency string) (float64, error) {
 	return rate, nil
 }
 
-func (s *Service) UpdateDerivedCurrencies() error {
-	return s.UpdateKZTData()
+// ExchangeRates returns a copy of the latest exchange rates, the amount of
+// each currency for 1 USD, and when they were fetched
+func (s *Service) ExchangeRates() (map[string]float64, time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rates := make(map[string]float64, len(s.exchangeRates))
+	for code, rate := range s.exchangeRates {
+		rates[code] = rate
+	}
+
+	return rates, s.ratesUpdateTime
 }
 
-func (s *Service) UpdateKZTData() error {
+// ToUSD converts an amount in a fiat currency such as "EUR" to USD with the
+// latest exchange rates
+func (s *Service) ToUSD(amount float64, currency string) (float64, error) {
+	currency = strings.ToUpper(currency)
+	if currency == "USD" {
+		return amount, nil
+	}
+
+	rate, err := s.GetExchangeRate(currency)
+	if err != nil {
+		return 0, err
+	}
+
+	return amount / rate, nil
+}
+
+func (s *Service) UpdateDerivedCurrencies(ctx context.Context) error {
+	return s.UpdateKZTData(ctx)
+}
+
+func (s *Service) UpdateKZTData(ctx context.Context) error {
 	s.mu.RLock()
 	cachedUSD, existsUSD := s.cache["result_usd"]
 	kztRate, rateExists := s.exchangeRates["KZT"]
 	s.mu.RUnlock()
 
 	if !existsUSD {
-		return fmt.Errorf("USD data not available for KZT conversion")
+		return fmt.Errorf("%w: USD data not available for KZT conversion", ErrUpstreamUnavailable)
 	}
 
 	if !rateExists {
-		return fmt.Errorf("KZT exchange rate not available")
+		return fmt.Errorf("%w: KZT exchange rate not available", ErrUpstreamUnavailable)
 	}
 
 	kztData := make([]types.CurrencyResponse, len(cachedUSD.Data))
@@ -246,11 +284,206 @@ func (s *Service) UpdateKZTData() error {
 	s.mu.Lock()
 	s.cache["result_kzt"] = CachedCurrencies{
 		Data:      kztData,
-		Timestamp: time.Now(),
+		Timestamp: cachedUSD.Timestamp,
+	}
+	s.mu.Unlock()
+
+	s.notifyRefresh(ctx, "kzt", kztData)
+
+	slog.Debug("Updated KZT data from USD conversion")
+	return nil
+}
+
+// OnRefresh registers fn to be called after every refresh of the prices.
+// Listeners run synchronously, so they should be quick.
+func (s *Service) OnRefresh(fn RefreshListener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.listeners = append(s.listeners, fn)
+}
+
+func (s *Service) notifyRefresh(ctx context.Context, currencyCode string, data []types.CurrencyResponse) {
+	s.mu.RLock()
+	listeners := s.listeners
+	s.mu.RUnlock()
+
+	for _, fn := range listeners {
+		fn(ctx, currencyCode, data)
+	}
+}
+
+// Coin returns the market data of coinID, a CoinGecko id such as "bitcoin",
+// in the currency
+func (s *Service) Coin(ctx context.Context, currencyCode, coinID string) (*types.CurrencyResponse, error) {
+	data, err := s.GetCurrencyData(ctx, currencyCode)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range data {
+		if data[i].Id == coinID {
+			return &data[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownCoin, coinID)
+}
+
+// doUpstream executes req against provider and returns the body of a
+// successful response
+func (s *Service) doUpstream(provider string, req *http.Request) (body []byte, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.ObserveUpstream(provider, start, err)
+	}()
+
+	response, err := s.httpClient.Do(req)
+	if err != nil {
+		// The URL of the exchange rate API contains the key, keep it out of
+		// the error that may reach the client
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("%w: %s request failed: %w", ErrUpstreamUnavailable, provider, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s API returned status code %d", ErrUpstreamUnavailable, provider, response.StatusCode)
+	}
+
+	return io.ReadAll(response.Body)
+}
+
+// CacheAge returns how long ago the cached data of the currency was fetched
+func (s *Service) CacheAge(currencyCode string) (time.Duration, bool) {
+	s.mu.RLock()
+	cached, exists := s.cache["result_"+currencyCode]
+	s.mu.RUnlock()
+
+	if !exists {
+		return 0, false
+	}
+
+	return time.Since(cached.Timestamp), true
+}
+
+// RatesAge returns how long ago the exchange rates were fetched
+func (s *Service) RatesAge() (time.Duration, bool) {
+	s.mu.RLock()
+	updated := s.ratesUpdateTime
+	s.mu.RUnlock()
+
+	if updated.IsZero() {
+		return 0, false
+	}
+
+	return time.Since(updated), true
+}
+
+// SetSharedCache makes the service publish fetched data to shared while it is
+// the leader, and read it from shared instead of the upstream APIs otherwise.
+func (s *Service) SetSharedCache(shared SharedCache, isLeader func() bool) {
+	s.shared = shared
+	s.isLeader = isLeader
+}
+
+// SyncSharedCache loads the data published by the leader into the local cache
+func (s *Service) SyncSharedCache(ctx context.Context) error {
+	if s.shared == nil {
+		return nil
+	}
+
+	var errs []error
+
+	for _, currencyCode := range s.GetSupportedDirectCurrencies() {
+		if err := s.loadSharedCurrency(ctx, currencyCode); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := s.loadSharedRates(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := s.UpdateDerivedCurrencies(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Service) canFetchUpstream() bool {
+	return s.shared == nil || s.isLeader == nil || s.isLeader()
+}
+
+func (s *Service) saveShared(ctx context.Context, key string, v any) {
+	if s.shared == nil {
+		return
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("Error encoding shared cache", "key", key, "error", err)
+		return
+	}
+
+	if err := s.shared.Save(ctx, key, data, time.Now()); err != nil {
+		slog.Error("Error saving shared cache", "key", key, "error", err)
+	}
+}
+
+func (s *Service) loadSharedCurrency(ctx context.Context, currencyCode string) error {
+	cacheKey := "result_" + currencyCode
+
+	data, updatedAt, err := s.shared.Load(ctx, cacheKey)
+	if err != nil {
+		return fmt.Errorf("error loading shared %s data: %w", currencyCode, err)
+	}
+
+	if data == nil {
+		return fmt.Errorf("%w: %s data is not available yet", ErrUpstreamUnavailable, currencyCode)
+	}
+
+	var currencies []types.CurrencyResponse
+	if err := json.Unmarshal(data, &currencies); err != nil {
+		return fmt.Errorf("error parsing shared %s data: %w", currencyCode, err)
+	}
+
+	s.mu.Lock()
+	s.cache[cacheKey] = CachedCurrencies{
+		Data:      currencies,
+		Timestamp: updatedAt,
+	}
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *Service) loadSharedRates(ctx context.Context) error {
+	data, updatedAt, err := s.shared.Load(ctx, exchangeRatesKey)
+	if err != nil {
+		return fmt.Errorf("error loading shared exchange rates: %w", err)
+	}
+
+	if data == nil {
+		return fmt.Errorf("%w: exchange rates are not available yet", ErrUpstreamUnavailable)
+	}
+
+	var rates map[string]float64
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return fmt.Errorf("error parsing shared exchange rates: %w", err)
+	}
+
+	s.mu.Lock()
+	for code, rate := range rates {
+		s.exchangeRates[code] = rate
 	}
+	s.ratesUpdateTime = updatedAt
 	s.mu.Unlock()
 
-	log.Println("Updated KZT data from USD conversion")
 	return nil
 }
 
@@ -0,0 +1,21 @@
+package dca
+
+import (
+	"crypto-tracker/apperr"
+	"net/http"
+)
+
+var (
+	ErrPlanNotFound           = apperr.New(http.StatusNotFound, "dca_plan_not_found", "recurring purchase plan not found")
+	ErrInvalidPlanID          = apperr.New(http.StatusBadRequest, "invalid_dca_plan_id", "invalid recurring purchase plan id")
+	ErrTooManyPlans           = apperr.New(http.StatusConflict, "too_many_dca_plans", "too many recurring purchase plans")
+	ErrExecutionNotFound      = apperr.New(http.StatusNotFound, "dca_execution_not_found", "recurring purchase not found")
+	ErrInvalidExecutionID     = apperr.New(http.StatusBadRequest, "invalid_dca_execution_id", "invalid recurring purchase id")
+	ErrInvalidExecutionFilter = apperr.New(http.StatusBadRequest, "invalid_dca_execution_filter", "invalid recurring purchase filter")
+	ErrExecutionNotPending    = apperr.New(http.StatusConflict, "dca_execution_not_pending", "the recurring purchase is not pending")
+	ErrUnknownCoin            = apperr.New(http.StatusBadRequest, "unknown_currency_id", "unknown currency id")
+	ErrUnsupportedFiat        = apperr.New(http.StatusBadRequest, "unsupported_currency", "unsupported currency")
+	ErrInvalidProjection      = apperr.New(http.StatusBadRequest, "invalid_dca_projection", "invalid projection range")
+	ErrNoPriceHistory         = apperr.New(http.StatusUnprocessableEntity, "price_history_unavailable", "no stored prices for the projection")
+	ErrFXRateUnavailable      = apperr.New(http.StatusUnprocessableEntity, "fx_rate_unavailable", "exchange rate not available")
+)
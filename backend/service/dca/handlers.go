@@ -0,0 +1,217 @@
+package dca
+
+import (
+	"crypto-tracker/service/auth"
+	"crypto-tracker/types"
+	"crypto-tracker/utils"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// RegisterRoutes expects a /dca router that requires authentication
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/plans", h.ListPlans).Methods("GET")
+	router.HandleFunc("/plans", h.CreatePlan).Methods("POST")
+	router.HandleFunc("/plans/{id:[0-9]+}", h.GetPlan).Methods("GET")
+	router.HandleFunc("/plans/{id:[0-9]+}", h.UpdatePlan).Methods("PUT")
+	router.HandleFunc("/plans/{id:[0-9]+}", h.DeletePlan).Methods("DELETE")
+	router.HandleFunc("/executions", h.ListExecutions).Methods("GET")
+	router.HandleFunc("/executions/{id:[0-9]+}/confirm", h.ConfirmExecution).Methods("POST")
+	router.HandleFunc("/executions/{id:[0-9]+}/dismiss", h.DismissExecution).Methods("POST")
+	router.HandleFunc("/projection", h.Project).Methods("POST")
+}
+
+func pathID(r *http.Request, invalid error) (int64, error) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return 0, invalid
+	}
+
+	return id, nil
+}
+
+func (h *Handler) ListPlans(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	plans, err := h.service.Plans(r.Context(), userID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, plans)
+}
+
+func (h *Handler) CreatePlan(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	var payload types.DCAPlanPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	plan, err := h.service.CreatePlan(r.Context(), userID, payload)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, plan)
+}
+
+func (h *Handler) GetPlan(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := pathID(r, ErrInvalidPlanID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	plan, err := h.service.Plan(r.Context(), userID, id)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, plan)
+}
+
+func (h *Handler) UpdatePlan(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := pathID(r, ErrInvalidPlanID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	var payload types.DCAPlanPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	plan, err := h.service.UpdatePlan(r.Context(), userID, id, payload)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, plan)
+}
+
+func (h *Handler) DeletePlan(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := pathID(r, ErrInvalidPlanID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	if err := h.service.DeletePlan(r.Context(), userID, id); err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+func (h *Handler) ListExecutions(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	query := r.URL.Query()
+
+	var planID int64
+	if value := query.Get("plan_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id <= 0 {
+			utils.WriteServiceError(w, ErrInvalidPlanID)
+			return
+		}
+		planID = id
+	}
+
+	executions, err := h.service.Executions(r.Context(), userID, query.Get("status"), planID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, executions)
+}
+
+// ConfirmExecution creates the deal of a pending purchase, the body is
+// optional
+func (h *Handler) ConfirmExecution(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := pathID(r, ErrInvalidExecutionID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	var payload types.DCAConfirmPayload
+	if err := utils.ParseJSON(r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	execution, err := h.service.Confirm(r.Context(), userID, id, payload)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, execution)
+}
+
+func (h *Handler) DismissExecution(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := pathID(r, ErrInvalidExecutionID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	execution, err := h.service.Dismiss(r.Context(), userID, id)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, execution)
+}
+
+func (h *Handler) Project(w http.ResponseWriter, r *http.Request) {
+	var payload types.DCAProjectionPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	projection, err := h.service.Projection(r.Context(), payload)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, projection)
+}
@@ -0,0 +1,228 @@
+package dca
+
+import (
+	"context"
+	"crypto-tracker/apperr"
+	"crypto-tracker/types"
+	"crypto-tracker/utils"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// maxProjectionDays bounds the range of a projection
+	maxProjectionDays = 3660
+	// stalePriceDays is how far the day of a price may be from the day of a
+	// purchase before the projection warns about it
+	stalePriceDays = 7
+)
+
+// Projection backtests a plan: it buys Amount of Fiat worth of the coin on
+// every purchase day of the range at the stored price of the day, converted
+// at the stored exchange rate of the day, and values the coins at the last
+// price of the range
+func (s *Service) Projection(ctx context.Context, payload types.DCAProjectionPayload) (*types.DCAProjection, error) {
+	if err := utils.Validate.Struct(payload); err != nil {
+		return nil, apperr.FromValidator(err)
+	}
+
+	fiat, err := s.fiat(payload.Fiat)
+	if err != nil {
+		return nil, err
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from, _ := time.Parse(time.DateOnly, payload.From)
+	to := today
+	if payload.To != "" {
+		to, _ = time.Parse(time.DateOnly, payload.To)
+	}
+
+	switch {
+	case to.After(today):
+		return nil, fmt.Errorf("%w: to is in the future", ErrInvalidProjection)
+	case from.After(to):
+		return nil, fmt.Errorf("%w: from must not be after to", ErrInvalidProjection)
+	case to.Sub(from).Hours()/24 > maxProjectionDays:
+		return nil, fmt.Errorf("%w: at most %d days", ErrInvalidProjection, maxProjectionDays)
+	}
+
+	currencyID := strings.ToLower(strings.TrimSpace(payload.CurrencyId))
+	points, err := s.history.Prices(ctx, []string{currencyID}, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(points) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoPriceHistory, currencyID)
+	}
+
+	projection := &types.DCAProjection{
+		CurrencyId:  currencyID,
+		Fiat:        fiat,
+		Interval:    payload.Interval,
+		From:        from.Format(time.DateOnly),
+		To:          to.Format(time.DateOnly),
+		Purchases:   make([]types.DCAPurchase, 0),
+		Warnings:    make([]string, 0),
+		GeneratedAt: time.Now(),
+	}
+
+	fx := &fxRates{ctx: ctx, rates: s.rates, fiat: fiat, days: make(map[string]float64)}
+	prices := &priceSeries{points: points}
+	amount := math.Round(payload.Amount*100) / 100
+
+	var firstPrice float64
+	var stale bool
+	for n := 0; ; n++ {
+		date := occurrence(from, payload.Interval, n)
+		if date.After(to) {
+			break
+		}
+
+		day := date.Format(time.DateOnly)
+		point, ok := prices.at(day)
+		if !ok {
+			continue
+		}
+
+		if !stale && daysBetween(point.Date, day) > stalePriceDays {
+			stale = true
+			projection.Warnings = append(projection.Warnings, fmt.Sprintf(
+				"the price of %s on %s is used for %s, the prices of some days are missing", currencyID, point.Date, day))
+		}
+
+		rate, err := fx.at(date)
+		if err != nil {
+			return nil, err
+		}
+
+		price := point.Price * rate
+		if firstPrice == 0 {
+			firstPrice = price
+		}
+
+		count := amount / price
+		projection.Invested += amount
+		projection.Count += count
+		projection.Purchases = append(projection.Purchases, types.DCAPurchase{
+			Date:       day,
+			Price:      round(price),
+			Count:      roundCount(count),
+			Invested:   round(projection.Invested),
+			TotalCount: roundCount(projection.Count),
+			Value:      round(projection.Count * price),
+		})
+	}
+
+	if len(projection.Purchases) == 0 {
+		return nil, fmt.Errorf("%w: no price of %s before %s", ErrNoPriceHistory, currencyID, projection.To)
+	}
+
+	if skipped := countPurchases(from, to, payload.Interval) - len(projection.Purchases); skipped > 0 {
+		projection.Warnings = append(projection.Warnings, fmt.Sprintf(
+			"%d purchases before %s are skipped, there is no price of %s before", skipped, projection.Purchases[0].Date, currencyID))
+	}
+
+	end, _ := prices.at(projection.To)
+	rate, err := fx.at(to)
+	if err != nil {
+		return nil, err
+	}
+
+	projection.EndPrice = end.Price * rate
+	projection.EndValue = projection.Count * projection.EndPrice
+	projection.AvgPrice = projection.Invested / projection.Count
+	projection.Return = ratio(projection.EndValue/projection.Invested - 1)
+	projection.LumpSumReturn = ratio(projection.EndPrice/firstPrice - 1)
+
+	projection.Invested = round(projection.Invested)
+	projection.Count = roundCount(projection.Count)
+	projection.AvgPrice = round(projection.AvgPrice)
+	projection.EndPrice = round(projection.EndPrice)
+	projection.EndValue = round(projection.EndValue)
+
+	return projection, nil
+}
+
+func countPurchases(from, to time.Time, interval string) int {
+	n := 0
+	for !occurrence(from, interval, n).After(to) {
+		n++
+	}
+
+	return n
+}
+
+// priceSeries returns the last price on or before days asked in order
+type priceSeries struct {
+	points []types.PricePoint
+	next   int
+	last   *types.PricePoint
+}
+
+func (p *priceSeries) at(day string) (types.PricePoint, bool) {
+	for ; p.next < len(p.points) && p.points[p.next].Date <= day; p.next++ {
+		p.last = &p.points[p.next]
+	}
+
+	if p.last == nil {
+		return types.PricePoint{}, false
+	}
+
+	return *p.last, true
+}
+
+// fxRates converts USD to fiat at the stored rate of a day
+type fxRates struct {
+	ctx   context.Context
+	rates RateHistory
+	fiat  string
+	days  map[string]float64
+}
+
+func (f *fxRates) at(t time.Time) (float64, error) {
+	if f.fiat == "usd" {
+		return 1, nil
+	}
+
+	day := t.Format(time.DateOnly)
+	if rate, ok := f.days[day]; ok {
+		return rate, nil
+	}
+
+	currency := strings.ToUpper(f.fiat)
+	rate, _, ok, err := f.rates.RateAt(f.ctx, currency, t)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("%w: no %s rates are stored", ErrFXRateUnavailable, currency)
+	}
+
+	f.days[day] = rate
+	return rate, nil
+}
+
+func daysBetween(from, to string) int {
+	a, _ := time.Parse(time.DateOnly, from)
+	b, _ := time.Parse(time.DateOnly, to)
+
+	return int(b.Sub(a).Hours() / 24)
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// ratio rounds a return to 6 decimals
+func ratio(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
+
+// roundCount rounds a count to the 8 decimals the deals are stored with
+func roundCount(v float64) float64 {
+	return math.Round(v*1e8) / 1e8
+}
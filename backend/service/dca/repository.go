@@ -0,0 +1,292 @@
+package dca
+
+import (
+	"context"
+	"crypto-tracker/types"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	planColumns      = `id, user_id, portfolio_id, currency_id, amount, fiat, interval, mode, start_at, next_run_at, runs, active, created_at, updated_at`
+	executionColumns = `id, plan_id, user_id, currency_id, scheduled_at, status, count, price, COALESCE(deal_id, 0), error, created_at, updated_at`
+	// maxExecutions bounds the list of executions
+	maxExecutions = 500
+)
+
+type Repository struct {
+	DB *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{DB: db}
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPlan(row scanner) (*types.DCAPlan, error) {
+	var plan types.DCAPlan
+
+	err := row.Scan(
+		&plan.Id,
+		&plan.UserId,
+		&plan.PortfolioId,
+		&plan.CurrencyId,
+		&plan.Amount,
+		&plan.Fiat,
+		&plan.Interval,
+		&plan.Mode,
+		&plan.StartAt,
+		&plan.NextRunAt,
+		&plan.Runs,
+		&plan.Active,
+		&plan.CreatedAt,
+		&plan.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &plan, nil
+}
+
+func scanExecution(row scanner) (*types.DCAExecution, error) {
+	var execution types.DCAExecution
+
+	err := row.Scan(
+		&execution.Id,
+		&execution.PlanId,
+		&execution.UserId,
+		&execution.CurrencyId,
+		&execution.ScheduledAt,
+		&execution.Status,
+		&execution.Count,
+		&execution.Price,
+		&execution.DealId,
+		&execution.Error,
+		&execution.CreatedAt,
+		&execution.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &execution, nil
+}
+
+func (r *Repository) CreatePlan(ctx context.Context, plan *types.DCAPlan) error {
+	query := `
+		INSERT INTO dca_plans (user_id, portfolio_id, currency_id, amount, fiat, interval, mode, start_at, next_run_at, runs, active, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`
+
+	return r.DB.QueryRowContext(ctx, query,
+		plan.UserId, plan.PortfolioId, plan.CurrencyId, plan.Amount, plan.Fiat, plan.Interval,
+		plan.Mode, plan.StartAt, plan.NextRunAt, plan.Runs, plan.Active,
+	).Scan(&plan.Id, &plan.CreatedAt, &plan.UpdatedAt)
+}
+
+func (r *Repository) GetPlan(ctx context.Context, userID int, id int64) (*types.DCAPlan, error) {
+	query := `SELECT ` + planColumns + ` FROM dca_plans WHERE id = $1 AND user_id = $2`
+
+	plan, err := scanPlan(r.DB.QueryRowContext(ctx, query, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPlanNotFound
+	}
+
+	return plan, err
+}
+
+func (r *Repository) GetPlans(ctx context.Context, userID int) ([]*types.DCAPlan, error) {
+	query := `SELECT ` + planColumns + ` FROM dca_plans WHERE user_id = $1 ORDER BY id`
+
+	return r.queryPlans(ctx, query, userID)
+}
+
+// DuePlans returns at most limit active plans with a purchase due at now,
+// the most overdue first
+func (r *Repository) DuePlans(ctx context.Context, now time.Time, limit int) ([]*types.DCAPlan, error) {
+	query := `
+		SELECT ` + planColumns + `
+		FROM dca_plans
+		WHERE active AND next_run_at <= $1
+		ORDER BY next_run_at
+		LIMIT $2
+	`
+
+	return r.queryPlans(ctx, query, now, limit)
+}
+
+func (r *Repository) queryPlans(ctx context.Context, query string, args ...any) ([]*types.DCAPlan, error) {
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plans := make([]*types.DCAPlan, 0)
+	for rows.Next() {
+		plan, err := scanPlan(rows)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, plan)
+	}
+
+	return plans, rows.Err()
+}
+
+func (r *Repository) CountPlans(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := r.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM dca_plans WHERE user_id = $1`, userID).Scan(&count)
+
+	return count, err
+}
+
+func (r *Repository) UpdatePlan(ctx context.Context, plan *types.DCAPlan) error {
+	query := `
+		UPDATE dca_plans
+		SET portfolio_id = $1, currency_id = $2, amount = $3, fiat = $4, interval = $5, mode = $6,
+			start_at = $7, next_run_at = $8, runs = $9, active = $10, updated_at = NOW()
+		WHERE id = $11 AND user_id = $12
+		RETURNING updated_at
+	`
+
+	err := r.DB.QueryRowContext(ctx, query,
+		plan.PortfolioId, plan.CurrencyId, plan.Amount, plan.Fiat, plan.Interval, plan.Mode,
+		plan.StartAt, plan.NextRunAt, plan.Runs, plan.Active, plan.Id, plan.UserId,
+	).Scan(&plan.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPlanNotFound
+	}
+
+	return err
+}
+
+// DeletePlan removes the plan with its executions, the deals it created
+// are kept
+func (r *Repository) DeletePlan(ctx context.Context, userID int, id int64) error {
+	result, err := r.DB.ExecContext(ctx, `DELETE FROM dca_plans WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrPlanNotFound
+	}
+
+	return nil
+}
+
+// ClaimRun moves the plan to its next purchase and inserts the execution of
+// the current one. claimed is false when another instance ran the plan or
+// it changed since it was read.
+func (r *Repository) ClaimRun(ctx context.Context, plan *types.DCAPlan, runs int, next time.Time, execution *types.DCAExecution) (claimed bool, err error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE dca_plans
+		SET next_run_at = $1, runs = $2, updated_at = NOW()
+		WHERE id = $3 AND active AND next_run_at = $4
+	`, next, runs, plan.Id, plan.NextRunAt)
+	if err != nil {
+		return false, err
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err != nil || rowsAffected == 0 {
+		return false, err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO dca_executions (plan_id, user_id, currency_id, scheduled_at, status, count, price, error, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
+		ON CONFLICT (plan_id, scheduled_at) DO NOTHING
+		RETURNING id, created_at, updated_at
+	`, execution.PlanId, execution.UserId, execution.CurrencyId, execution.ScheduledAt,
+		execution.Status, execution.Count, execution.Price, execution.Error,
+	).Scan(&execution.Id, &execution.CreatedAt, &execution.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func (r *Repository) GetExecution(ctx context.Context, userID int, id int64) (*types.DCAExecution, error) {
+	query := `SELECT ` + executionColumns + ` FROM dca_executions WHERE id = $1 AND user_id = $2`
+
+	execution, err := scanExecution(r.DB.QueryRowContext(ctx, query, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrExecutionNotFound
+	}
+
+	return execution, err
+}
+
+// GetExecutions returns the latest executions of the user, with the status
+// and of the plan unless they are empty and 0
+func (r *Repository) GetExecutions(ctx context.Context, userID int, status string, planID int64) ([]*types.DCAExecution, error) {
+	query := `
+		SELECT ` + executionColumns + `
+		FROM dca_executions
+		WHERE user_id = $1 AND ($2::text = '' OR status = $2) AND ($3::integer = 0 OR plan_id = $3)
+		ORDER BY scheduled_at DESC, id DESC
+		LIMIT $4
+	`
+
+	rows, err := r.DB.QueryContext(ctx, query, userID, status, planID, maxExecutions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	executions := make([]*types.DCAExecution, 0)
+	for rows.Next() {
+		execution, err := scanExecution(rows)
+		if err != nil {
+			return nil, err
+		}
+		executions = append(executions, execution)
+	}
+
+	return executions, rows.Err()
+}
+
+// SetExecutionStatus changes the status of the execution from one status
+// to another, with its count, price, deal and error. updated is false when
+// its status is not from anymore.
+func (r *Repository) SetExecutionStatus(ctx context.Context, execution *types.DCAExecution, from string) (updated bool, err error) {
+	var dealID sql.NullInt64
+	if execution.DealId != 0 {
+		dealID = sql.NullInt64{Int64: execution.DealId, Valid: true}
+	}
+
+	err = r.DB.QueryRowContext(ctx, `
+		UPDATE dca_executions
+		SET status = $1, count = $2, price = $3, deal_id = $4, error = $5, updated_at = NOW()
+		WHERE id = $6 AND status = $7
+		RETURNING updated_at
+	`, execution.Status, execution.Count, execution.Price, dealID, execution.Error, execution.Id, from,
+	).Scan(&execution.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
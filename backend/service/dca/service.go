@@ -0,0 +1,416 @@
+package dca
+
+import (
+	"context"
+	"crypto-tracker/apperr"
+	"crypto-tracker/types"
+	"crypto-tracker/utils"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	maxPlans = 20
+	// duePlansBatch is the number of plans run by one run of the job
+	duePlansBatch = 100
+	priceFiat     = "usd"
+	defaultFiat   = "usd"
+	defaultMode   = ModeConfirm
+)
+
+const (
+	ModeAuto    = "auto"
+	ModeConfirm = "confirm"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusExecuted  = "executed"
+	StatusConfirmed = "confirmed"
+	StatusDismissed = "dismissed"
+	StatusFailed    = "failed"
+)
+
+// DealCreator creates the deals of the executions
+type DealCreator interface {
+	Create(deal *types.Deal) error
+	ResolvePortfolio(ctx context.Context, userID, portfolioID int64) (int64, error)
+}
+
+type PriceProvider interface {
+	GetCurrencyData(ctx context.Context, currencyCode string) ([]types.CurrencyResponse, error)
+	ToUSD(amount float64, currency string) (float64, error)
+	IsCurrencySupported(currency string) bool
+}
+
+// PriceHistory returns the stored daily USD prices of coins, with the last
+// one before from
+type PriceHistory interface {
+	Prices(ctx context.Context, currencyIDs []string, from, to time.Time) ([]types.PricePoint, error)
+}
+
+// RateHistory returns the stored rate of a fiat currency for 1 USD on or
+// closest before date
+type RateHistory interface {
+	RateAt(ctx context.Context, currency string, date time.Time) (rate float64, day time.Time, ok bool, err error)
+}
+
+type Service struct {
+	repo    *Repository
+	deals   DealCreator
+	prices  PriceProvider
+	history PriceHistory
+	rates   RateHistory
+}
+
+func NewService(repo *Repository, deals DealCreator, prices PriceProvider, history PriceHistory, rates RateHistory) *Service {
+	return &Service{
+		repo:    repo,
+		deals:   deals,
+		prices:  prices,
+		history: history,
+		rates:   rates,
+	}
+}
+
+func (s *Service) Plans(ctx context.Context, userID int) ([]*types.DCAPlan, error) {
+	return s.repo.GetPlans(ctx, userID)
+}
+
+func (s *Service) Plan(ctx context.Context, userID int, id int64) (*types.DCAPlan, error) {
+	return s.repo.GetPlan(ctx, userID, id)
+}
+
+func (s *Service) CreatePlan(ctx context.Context, userID int, payload types.DCAPlanPayload) (*types.DCAPlan, error) {
+	plan := &types.DCAPlan{UserId: userID, Active: true}
+	if err := s.apply(ctx, plan, payload, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	count, err := s.repo.CountPlans(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if count >= maxPlans {
+		return nil, fmt.Errorf("%w: at most %d plans per user", ErrTooManyPlans, maxPlans)
+	}
+
+	if err := s.repo.CreatePlan(ctx, plan); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// UpdatePlan replaces the settings of the plan. A new start or interval
+// starts the schedule over, a resumed plan skips the purchases missed while
+// it was paused.
+func (s *Service) UpdatePlan(ctx context.Context, userID int, id int64, payload types.DCAPlanPayload) (*types.DCAPlan, error) {
+	plan, err := s.repo.GetPlan(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.apply(ctx, plan, payload, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdatePlan(ctx, plan); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+func (s *Service) DeletePlan(ctx context.Context, userID int, id int64) error {
+	return s.repo.DeletePlan(ctx, userID, id)
+}
+
+// apply validates payload and sets it on plan, a new plan has no id
+func (s *Service) apply(ctx context.Context, plan *types.DCAPlan, payload types.DCAPlanPayload, now time.Time) error {
+	if err := utils.Validate.Struct(payload); err != nil {
+		return apperr.FromValidator(err)
+	}
+
+	currencyID := strings.ToLower(strings.TrimSpace(payload.CurrencyId))
+	fiat, err := s.fiat(payload.Fiat)
+	if err != nil {
+		return err
+	}
+
+	if currencyID != plan.CurrencyId {
+		prices, err := s.livePrices(ctx)
+		if err != nil {
+			return err
+		}
+		if prices[currencyID] <= 0 {
+			return fmt.Errorf("%w: %s", ErrUnknownCoin, currencyID)
+		}
+	}
+
+	portfolioID, err := s.deals.ResolvePortfolio(ctx, int64(plan.UserId), payload.PortfolioId)
+	if err != nil {
+		return err
+	}
+
+	mode := payload.Mode
+	if mode == "" {
+		mode = defaultMode
+	}
+
+	wasActive := plan.Active
+	if payload.Active != nil {
+		plan.Active = *payload.Active
+	}
+
+	switch {
+	case payload.StartAt != nil:
+		plan.StartAt, plan.Runs = payload.StartAt.UTC(), 0
+		plan.NextRunAt = plan.StartAt
+	case plan.Id == 0:
+		plan.StartAt, plan.Runs = now, 0
+		plan.NextRunAt = plan.StartAt
+	case payload.Interval != plan.Interval:
+		// The new interval counts from the next purchase
+		plan.StartAt, plan.Runs = plan.NextRunAt, 0
+	case plan.Active && !wasActive && plan.NextRunAt.Before(now):
+		plan.Runs, plan.NextRunAt = nextRun(plan.StartAt, payload.Interval, plan.Runs, now)
+	}
+
+	plan.PortfolioId = portfolioID
+	plan.CurrencyId = currencyID
+	plan.Amount = math.Round(payload.Amount*100) / 100
+	plan.Fiat = fiat
+	plan.Interval = payload.Interval
+	plan.Mode = mode
+
+	return nil
+}
+
+func (s *Service) fiat(fiat string) (string, error) {
+	fiat = strings.ToLower(strings.TrimSpace(fiat))
+	if fiat == "" {
+		return defaultFiat, nil
+	}
+
+	if !s.prices.IsCurrencySupported(fiat) {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedFiat, fiat)
+	}
+
+	return fiat, nil
+}
+
+func (s *Service) livePrices(ctx context.Context) (map[string]float64, error) {
+	data, err := s.prices.GetCurrencyData(ctx, priceFiat)
+	if err != nil {
+		return nil, fmt.Errorf("error getting prices: %w", err)
+	}
+
+	prices := make(map[string]float64, len(data))
+	for _, coin := range data {
+		prices[coin.Id] = coin.CurrentPrice
+	}
+
+	return prices, nil
+}
+
+// occurrence returns the purchase n of a schedule, the first is start. A
+// monthly purchase on a day the month does not have is on its last day.
+func occurrence(start time.Time, interval string, n int) time.Time {
+	switch interval {
+	case "daily":
+		return start.AddDate(0, 0, n)
+	case "weekly":
+		return start.AddDate(0, 0, 7*n)
+	case "biweekly":
+		return start.AddDate(0, 0, 14*n)
+	}
+
+	year, month, day := start.Date()
+	first := time.Date(year, month+time.Month(n), 1, start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+	last := first.AddDate(0, 1, -1).Day()
+
+	return first.AddDate(0, 0, min(day, last)-1)
+}
+
+// nextRun returns the first purchase after now that follows purchase runs,
+// the purchases missed in between are skipped
+func nextRun(start time.Time, interval string, runs int, now time.Time) (int, time.Time) {
+	n := runs + 1
+	for !occurrence(start, interval, n).After(now) {
+		n++
+	}
+
+	return n, occurrence(start, interval, n)
+}
+
+// RunDue runs the purchases due now. A plan in auto mode creates a deal at
+// the cached price, a plan in confirm mode leaves a pending execution for the
+// user. The purchases missed while the job was not running are made once,
+// at the current price.
+func (s *Service) RunDue(ctx context.Context) error {
+	now := time.Now().UTC()
+
+	plans, err := s.repo.DuePlans(ctx, now, duePlansBatch)
+	if err != nil || len(plans) == 0 {
+		return err
+	}
+
+	prices, err := s.livePrices(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, plan := range plans {
+		if err := s.run(ctx, plan, prices, now); err != nil {
+			errs = append(errs, fmt.Errorf("plan %d: %w", plan.Id, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Service) run(ctx context.Context, plan *types.DCAPlan, prices map[string]float64, now time.Time) error {
+	runs, next := nextRun(plan.StartAt, plan.Interval, plan.Runs, now)
+
+	execution := &types.DCAExecution{
+		PlanId:      plan.Id,
+		UserId:      plan.UserId,
+		CurrencyId:  plan.CurrencyId,
+		ScheduledAt: plan.NextRunAt,
+		Status:      StatusPending,
+	}
+
+	amount, err := s.prices.ToUSD(plan.Amount, plan.Fiat)
+	price := prices[plan.CurrencyId]
+	switch {
+	case err != nil:
+		execution.Status, execution.Error = StatusFailed, err.Error()
+	case price <= 0:
+		execution.Status, execution.Error = StatusFailed, fmt.Sprintf("no price of %s", plan.CurrencyId)
+	default:
+		execution.Price = price
+		execution.Count = roundCount(amount / price)
+	}
+
+	claimed, err := s.repo.ClaimRun(ctx, plan, runs, next, execution)
+	if err != nil || !claimed {
+		return err
+	}
+
+	if plan.Mode != ModeAuto || execution.Status != StatusPending {
+		return nil
+	}
+
+	deal := &types.Deal{
+		UserId:      int64(plan.UserId),
+		CurrencyId:  plan.CurrencyId,
+		Count:       execution.Count,
+		Price:       execution.Price,
+		FeeCurrency: types.FeeFiat,
+		PortfolioId: plan.PortfolioId,
+	}
+
+	execution.Status = StatusExecuted
+	if err := s.deals.Create(deal); err != nil {
+		execution.Status, execution.Error = StatusFailed, err.Error()
+	}
+	execution.DealId = deal.Id
+
+	_, err = s.repo.SetExecutionStatus(ctx, execution, StatusPending)
+	return err
+}
+
+// Executions lists the latest executions of the user, status and planID
+// filter them unless empty and 0
+func (s *Service) Executions(ctx context.Context, userID int, status string, planID int64) ([]*types.DCAExecution, error) {
+	switch status {
+	case "", StatusPending, StatusExecuted, StatusConfirmed, StatusDismissed, StatusFailed:
+	default:
+		return nil, fmt.Errorf("%w: status %s", ErrInvalidExecutionFilter, status)
+	}
+
+	return s.repo.GetExecutions(ctx, userID, status, planID)
+}
+
+// Confirm records a pending purchase as a deal, at the count and price of
+// the run unless the payload gives the ones of the actual purchase
+func (s *Service) Confirm(ctx context.Context, userID int, id int64, payload types.DCAConfirmPayload) (*types.DCAExecution, error) {
+	if err := utils.Validate.Struct(payload); err != nil {
+		return nil, apperr.FromValidator(err)
+	}
+
+	execution, err := s.repo.GetExecution(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := s.repo.GetPlan(ctx, userID, execution.PlanId)
+	if err != nil {
+		return nil, err
+	}
+
+	count, price := execution.Count, execution.Price
+	if payload.Count > 0 {
+		execution.Count = payload.Count
+	}
+	if payload.Price > 0 {
+		execution.Price = payload.Price
+	}
+
+	// The execution is confirmed first so that a second confirmation cannot
+	// create the deal twice
+	execution.Status = StatusConfirmed
+	if ok, err := s.repo.SetExecutionStatus(ctx, execution, StatusPending); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrExecutionNotPending
+	}
+
+	deal := &types.Deal{
+		UserId:      int64(userID),
+		CurrencyId:  execution.CurrencyId,
+		Count:       execution.Count,
+		Price:       execution.Price,
+		Fee:         payload.Fee,
+		FeeCurrency: types.FeeFiat,
+		PortfolioId: plan.PortfolioId,
+	}
+
+	if err := s.deals.Create(deal); err != nil {
+		execution.Status, execution.Count, execution.Price = StatusPending, count, price
+		if _, revertErr := s.repo.SetExecutionStatus(ctx, execution, StatusConfirmed); revertErr != nil {
+			return nil, errors.Join(err, revertErr)
+		}
+		return nil, err
+	}
+
+	execution.DealId = deal.Id
+	if _, err := s.repo.SetExecutionStatus(ctx, execution, StatusConfirmed); err != nil {
+		return nil, err
+	}
+
+	return execution, nil
+}
+
+// Dismiss skips a pending purchase
+func (s *Service) Dismiss(ctx context.Context, userID int, id int64) (*types.DCAExecution, error) {
+	execution, err := s.repo.GetExecution(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	execution.Status = StatusDismissed
+	if ok, err := s.repo.SetExecutionStatus(ctx, execution, StatusPending); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrExecutionNotPending
+	}
+
+	return execution, nil
+}
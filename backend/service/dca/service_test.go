@@ -0,0 +1,75 @@
+package dca
+
+import (
+	"testing"
+	"time"
+)
+
+func at(s string) time.Time {
+	t, err := time.Parse(time.DateTime, s)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+func TestOccurrence(t *testing.T) {
+	tests := []struct {
+		name     string
+		start    string
+		interval string
+		n        int
+		want     string
+	}{
+		{"the first is the start", "2024-01-31 10:00:00", "monthly", 0, "2024-01-31 10:00:00"},
+		{"daily", "2024-02-27 10:00:00", "daily", 3, "2024-03-01 10:00:00"},
+		{"weekly", "2024-12-25 08:30:00", "weekly", 2, "2025-01-08 08:30:00"},
+		{"biweekly", "2024-01-01 00:00:00", "biweekly", 3, "2024-02-12 00:00:00"},
+		{"monthly", "2024-01-15 10:00:00", "monthly", 1, "2024-02-15 10:00:00"},
+		{"monthly across the year", "2024-12-15 10:00:00", "monthly", 1, "2025-01-15 10:00:00"},
+		{"the 31st in a leap February", "2024-01-31 10:00:00", "monthly", 1, "2024-02-29 10:00:00"},
+		{"the 31st in February", "2023-01-31 10:00:00", "monthly", 1, "2023-02-28 10:00:00"},
+		{"the 31st back after February", "2024-01-31 10:00:00", "monthly", 2, "2024-03-31 10:00:00"},
+		{"the 31st in April", "2024-01-31 10:00:00", "monthly", 3, "2024-04-30 10:00:00"},
+		{"the 31st a year later", "2024-01-31 10:00:00", "monthly", 13, "2025-02-28 10:00:00"},
+		{"the 30th in February", "2023-01-30 10:00:00", "monthly", 1, "2023-02-28 10:00:00"},
+		{"the 29th of a leap year", "2024-02-29 10:00:00", "monthly", 12, "2025-02-28 10:00:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := occurrence(at(tt.start), tt.interval, tt.n)
+			if !got.Equal(at(tt.want)) {
+				t.Errorf("occurrence %d = %s, want %s", tt.n, got.Format(time.DateTime), tt.want)
+			}
+		})
+	}
+}
+
+func TestNextRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		start    string
+		interval string
+		runs     int
+		now      string
+		n        int
+		want     string
+	}{
+		{"before the next purchase", "2024-01-31 10:00:00", "monthly", 0, "2024-02-29 09:59:00", 1, "2024-02-29 10:00:00"},
+		{"at the next purchase", "2024-01-31 10:00:00", "monthly", 0, "2024-02-29 10:00:00", 2, "2024-03-31 10:00:00"},
+		{"missed purchases are skipped", "2024-01-31 10:00:00", "monthly", 0, "2024-05-15 00:00:00", 4, "2024-05-31 10:00:00"},
+		{"after the last run", "2024-01-01 10:00:00", "daily", 5, "2024-01-03 10:00:00", 6, "2024-01-07 10:00:00"},
+		{"weekly", "2024-01-01 10:00:00", "weekly", 1, "2024-01-20 00:00:00", 3, "2024-01-22 10:00:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, next := nextRun(at(tt.start), tt.interval, tt.runs, at(tt.now))
+			if n != tt.n || !next.Equal(at(tt.want)) {
+				t.Errorf("next run = %d at %s, want %d at %s", n, next.Format(time.DateTime), tt.n, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package deals
+
+import (
+	"crypto-tracker/apperr"
+	"net/http"
+)
+
+var (
+	ErrDealNotFound        = apperr.New(http.StatusNotFound, "deal_not_found", "deal not found")
+	ErrInvalidDealID       = apperr.New(http.StatusBadRequest, "invalid_deal_id", "invalid deal id")
+	ErrUserIDRequired      = apperr.New(http.StatusBadRequest, "user_id_required", "user ID is required")
+	ErrInvalidCSV          = apperr.New(http.StatusBadRequest, "invalid_csv", "invalid CSV file")
+	ErrImportTooLarge      = apperr.New(http.StatusRequestEntityTooLarge, "import_too_large", "import file too large")
+	ErrUnknownImportFormat = apperr.New(http.StatusBadRequest, "unknown_import_format", "unknown import format")
+	ErrInvalidPortfolioID  = apperr.New(http.StatusBadRequest, "invalid_portfolio_id", "invalid portfolio id")
+	ErrTransferDeal        = apperr.New(http.StatusConflict, "transfer_deal", "deals of a transfer are changed through the transfer")
+	ErrTransferredOut      = apperr.New(http.StatusConflict, "transferred_out", "the coins of the deal have been transferred out of the portfolio")
+)
@@ -1,6 +1,8 @@
 package deals
 
 import (
+	"crypto-tracker/apperr"
+	"crypto-tracker/service/auth"
 	"crypto-tracker/service/user"
 	"crypto-tracker/types"
 	"crypto-tracker/utils"
@@ -13,20 +15,23 @@ import (
 )
 
 type Handler struct {
-	service *DealService
-	store   *user.Repository
+	service  *DealService
+	store    *user.Repository
+	importer *Importer
 }
 
-func NewHandler(service *DealService, store *user.Repository) *Handler {
+func NewHandler(service *DealService, store *user.Repository, importer *Importer) *Handler {
 	return &Handler{
-		service: service,
-		store:   store,
+		service:  service,
+		store:    store,
+		importer: importer,
 	}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
 	router.HandleFunc("/", h.CreateDeal).Methods("POST")
 	router.HandleFunc("/", h.GetAllDeals).Methods("GET")
+	router.HandleFunc("/import", h.ImportDeals).Methods("POST")
 	router.HandleFunc("/{id:[0-9]+}", h.GetDeal).Methods("GET")
 	router.HandleFunc("/{id:[0-9]+}", h.UpdateDeal).Methods("PUT")
 	router.HandleFunc("/{id:[0-9]+}", h.DeleteDeal).Methods("DELETE")
@@ -39,7 +44,7 @@ func (h *Handler) CreateDeal(w http.ResponseWriter, r *http.Request) {
 
 	err := utils.ParseJSON(r, &deal)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteError(w, http.StatusBadRequest, err)
 		return
 	}
 
@@ -47,12 +52,12 @@ func (h *Handler) CreateDeal(w http.ResponseWriter, r *http.Request) {
 
 	_, err = h.store.GetUserById(int(deal.UserId))
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteServiceError(w, err)
 		return
 	}
 
 	if err := h.service.Create(deal); err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteServiceError(w, err)
 		return
 	}
 
@@ -63,17 +68,13 @@ func (h *Handler) GetDeal(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseInt(vars["id"], 10, 64)
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid deal id"))
+		utils.WriteServiceError(w, ErrInvalidDealID)
 		return
 	}
 
 	deal, err := h.service.GetByID(id)
 	if err != nil {
-		if errors.Is(err, errors.New("deal not found")) {
-			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("deal not found"))
-		} else {
-			utils.WriteError(w, http.StatusInternalServerError, err)
-		}
+		utils.WriteServiceError(w, err)
 		return
 	}
 
@@ -86,7 +87,7 @@ func (h *Handler) GetUserDeals(w http.ResponseWriter, r *http.Request) {
 
 	deals, err := h.service.GetByUserID(userID)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteServiceError(w, err)
 		return
 	}
 
@@ -96,7 +97,7 @@ func (h *Handler) GetUserDeals(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetAllDeals(w http.ResponseWriter, r *http.Request) {
 	deals, err := h.service.GetAll()
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteServiceError(w, err)
 		return
 	}
 
@@ -107,7 +108,7 @@ func (h *Handler) UpdateDeal(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseInt(vars["id"], 10, 64)
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid deal id"))
+		utils.WriteServiceError(w, ErrInvalidDealID)
 		return
 	}
 
@@ -115,7 +116,7 @@ func (h *Handler) UpdateDeal(w http.ResponseWriter, r *http.Request) {
 
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&deal); err != nil {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("Invalid request payload"))
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid request payload"))
 		return
 	}
 	defer r.Body.Close()
@@ -123,11 +124,7 @@ func (h *Handler) UpdateDeal(w http.ResponseWriter, r *http.Request) {
 	deal.Id = id
 
 	if err := h.service.Update(&deal); err != nil {
-		if errors.Is(err, errors.New("deal not found")) {
-			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("Deal not found"))
-		} else {
-			utils.WriteError(w, http.StatusInternalServerError, err)
-		}
+		utils.WriteServiceError(w, err)
 		return
 	}
 
@@ -138,16 +135,12 @@ func (h *Handler) DeleteDeal(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.ParseInt(vars["id"], 10, 64)
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid deal ID"))
+		utils.WriteServiceError(w, ErrInvalidDealID)
 		return
 	}
 
 	if err := h.service.Delete(id); err != nil {
-		if errors.Is(err, errors.New("deal not found")) {
-			utils.WriteError(w, http.StatusNotFound, fmt.Errorf("deal not found"))
-		} else {
-			utils.WriteError(w, http.StatusInternalServerError, err)
-		}
+		utils.WriteServiceError(w, err)
 		return
 	}
 
@@ -158,11 +151,100 @@ func (h *Handler) GetUserPortfolio(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID := vars["user_id"]
 
-	portfolio, err := h.service.GetUserPortfolio(userID)
+	var portfolioID int64
+	if value := r.URL.Query().Get("portfolio_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id <= 0 {
+			utils.WriteServiceError(w, ErrInvalidPortfolioID)
+			return
+		}
+		portfolioID = id
+	}
+
+	portfolio, err := h.service.GetUserPortfolio(userID, portfolioID)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteServiceError(w, err)
 		return
 	}
 
 	utils.WriteJSON(w, http.StatusOK, portfolio)
 }
+
+// ImportDeals creates deals of the authenticated user from a multipart CSV
+// upload. The form has the file, the format, csv by default or the name of an
+// exchange importer, the JSON column mapping and the delimiter of a csv file,
+// the portfolio_id, the default portfolio when missing, and dry_run=true to
+// only validate.
+func (h *Handler) ImportDeals(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxImportBytes+1<<20)
+	if err := r.ParseMultipartForm(MaxImportBytes); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			utils.WriteServiceError(w, fmt.Errorf("%w: at most %d bytes", ErrImportTooLarge, MaxImportBytes))
+			return
+		}
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid multipart form: %w", err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		utils.WriteServiceError(w, apperr.Validation(types.FieldError{Field: "file", Rule: "required", Message: "file is required"}))
+		return
+	}
+	defer file.Close()
+
+	opts := ImportOptions{
+		DryRun: r.FormValue("dry_run") == "true",
+	}
+
+	if value := r.FormValue("portfolio_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id <= 0 {
+			utils.WriteServiceError(w, ErrInvalidPortfolioID)
+			return
+		}
+		opts.PortfolioID = id
+	}
+
+	if mapping := r.FormValue("mapping"); mapping != "" {
+		if err := json.Unmarshal([]byte(mapping), &opts.Mapping); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid mapping: %w", err))
+			return
+		}
+	}
+
+	switch delimiter := r.FormValue("delimiter"); delimiter {
+	case "":
+	case `\t`, "tab":
+		opts.Delimiter = '\t'
+	default:
+		runes := []rune(delimiter)
+		if len(runes) != 1 {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("delimiter must be a single character"))
+			return
+		}
+		opts.Delimiter = runes[0]
+	}
+
+	var report *types.DealImportReport
+	if format := r.FormValue("format"); format == "" || format == "csv" {
+		report, err = h.importer.Import(r.Context(), userID, file, opts)
+	} else {
+		report, err = h.importer.ImportTrades(r.Context(), userID, format, file, opts)
+	}
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	status := http.StatusCreated
+	if opts.DryRun {
+		status = http.StatusOK
+	}
+
+	utils.WriteJSON(w, status, report)
+}
@@ -0,0 +1,518 @@
+package deals
+
+import (
+	"context"
+	"crypto-tracker/apperr"
+	"crypto-tracker/types"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxImportBytes and MaxImportRows limit the size of a CSV import
+	MaxImportBytes = 5 << 20
+	MaxImportRows  = 5000
+
+	ImportValid     = "valid"
+	ImportImported  = "imported"
+	ImportDuplicate = "duplicate"
+	ImportInvalid   = "invalid"
+)
+
+// importAliases are the header names recognized when a field is not mapped
+var importAliases = map[string][]string{
+	"coin":         {"coin", "currency", "currency_id", "coin_id", "symbol", "asset"},
+	"count":        {"count", "amount", "quantity", "qty"},
+	"price":        {"price", "unit_price", "price_usd"},
+	"date":         {"date", "time", "datetime", "timestamp", "created_at"},
+	"side":         {"side", "type", "action"},
+	"fee":          {"fee", "fees", "commission"},
+	"fee_currency": {"fee_currency", "fee_coin", "fee_asset", "commission_asset"},
+}
+
+// optionalImportFields may be missing from the file
+var optionalImportFields = map[string]bool{"date": true, "side": true, "fee": true, "fee_currency": true}
+
+var importDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// CoinProvider resolves the coins of an import and converts the prices to
+// USD at the current rates, the currency service
+type CoinProvider interface {
+	GetCurrencyData(ctx context.Context, currencyCode string) ([]types.CurrencyResponse, error)
+	ToUSD(amount float64, currency string) (float64, error)
+}
+
+// RateHistory returns the stored rate of a fiat currency for 1 USD on or
+// closest before date, see tax.Repository
+type RateHistory interface {
+	RateAt(ctx context.Context, currency string, date time.Time) (rate float64, day time.Time, ok bool, err error)
+}
+
+// ImportOptions configure a CSV import. Prices are in USD, like the deals
+// created through the API.
+type ImportOptions struct {
+	Mapping types.DealImportMapping
+	// Delimiter is detected from the header when zero
+	Delimiter rune
+	DryRun    bool
+	// PortfolioID is the portfolio of the deals, 0 for the default one
+	PortfolioID int64
+}
+
+// Importer creates deals from the CSV export of a spreadsheet or the trade
+// history of an exchange
+type Importer struct {
+	service *DealService
+	coins   CoinProvider
+	rates   RateHistory
+}
+
+func NewImporter(service *DealService, coins CoinProvider, rates RateHistory) *Importer {
+	return &Importer{
+		service: service,
+		coins:   coins,
+		rates:   rates,
+	}
+}
+
+// importRow is a parsed row before the validation
+type importRow struct {
+	line     int
+	deal     *types.Deal
+	errs     []types.FieldError
+	warnings []string
+}
+
+// Import reads the deals of userID from r. Every row is validated like a deal
+// created through the API, and rows equal to an existing deal or to an earlier
+// row are reported as duplicates and skipped. Unless it is a dry run, the
+// valid rows are stored in one transaction, and nothing is stored when a row
+// is invalid.
+func (im *Importer) Import(ctx context.Context, userID int, r io.Reader, opts ImportOptions) (*types.DealImportReport, error) {
+	records, err := readCSV(r, opts.Delimiter)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := importColumns(records[0], opts.Mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	coins, err := im.coinIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]importRow, 0, len(records)-1)
+	for i, record := range records[1:] {
+		deal, errs := parseRow(userID, record, columns, coins)
+		rows = append(rows, importRow{line: i + 2, deal: deal, errs: errs})
+	}
+
+	return im.save(ctx, userID, rows, opts)
+}
+
+// save validates the rows, detects the duplicates and, unless it is a dry
+// run, stores the valid rows in the portfolio in one transaction
+func (im *Importer) save(ctx context.Context, userID int, rows []importRow, opts ImportOptions) (*types.DealImportReport, error) {
+	dryRun := opts.DryRun
+
+	portfolioID, err := im.service.ResolvePortfolio(ctx, int64(userID), opts.PortfolioID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen, err := im.existingDeals(userID, portfolioID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &types.DealImportReport{
+		DryRun:  dryRun,
+		Rows:    len(rows),
+		Results: make([]types.DealImportRow, 0, len(rows)),
+	}
+
+	var deals []*types.Deal
+	var fieldErrors []types.FieldError
+
+	for _, r := range rows {
+		row := types.DealImportRow{Line: r.line, Warnings: r.warnings}
+
+		errs := r.errs
+		if len(errs) == 0 {
+			r.deal.PortfolioId = portfolioID
+			errs = apperr.FieldErrors(im.service.Validate(r.deal))
+		}
+
+		switch {
+		case len(errs) > 0:
+			row.Status = ImportInvalid
+			row.Errors = errs
+			report.Invalid++
+
+			for _, fe := range errs {
+				fe.Field = fmt.Sprintf("line %d: %s", r.line, fe.Field)
+				fe.Message = fmt.Sprintf("line %d: %s", r.line, fe.Message)
+				fieldErrors = append(fieldErrors, fe)
+			}
+		case seen[dealKey(r.deal)]:
+			row.Status = ImportDuplicate
+			row.Deal = r.deal
+			report.Duplicates++
+		default:
+			markSeen(seen, r.deal)
+			row.Status = ImportValid
+			row.Deal = r.deal
+			report.Valid++
+			deals = append(deals, r.deal)
+		}
+
+		report.Results = append(report.Results, row)
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	if len(fieldErrors) > 0 {
+		return nil, apperr.Validation(fieldErrors...)
+	}
+
+	if len(deals) > 0 {
+		if err := im.service.repo.CreateMany(deals); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range report.Results {
+		if report.Results[i].Status == ImportValid {
+			report.Results[i].Status = ImportImported
+		}
+	}
+	report.Imported = len(deals)
+
+	return report, nil
+}
+
+func readCSV(r io.Reader, delimiter rune) ([][]string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxImportBytes+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > MaxImportBytes {
+		return nil, fmt.Errorf("%w: at most %d bytes", ErrImportTooLarge, MaxImportBytes)
+	}
+
+	text := strings.TrimPrefix(string(data), "\ufeff")
+
+	if delimiter == 0 {
+		delimiter = detectDelimiter(text)
+	}
+
+	reader := csv.NewReader(strings.NewReader(text))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCSV, err)
+	}
+
+	if len(records) < 2 {
+		return nil, fmt.Errorf("%w: a header and at least one row are required", ErrInvalidCSV)
+	}
+
+	if len(records)-1 > MaxImportRows {
+		return nil, fmt.Errorf("%w: at most %d rows", ErrImportTooLarge, MaxImportRows)
+	}
+
+	return records, nil
+}
+
+// detectDelimiter picks the most frequent of , ; and tab in the header
+func detectDelimiter(text string) rune {
+	header, _, _ := strings.Cut(text, "\n")
+
+	best, bestCount := ',', strings.Count(header, ",")
+	for _, d := range []rune{';', '\t'} {
+		if count := strings.Count(header, string(d)); count > bestCount {
+			best, bestCount = d, count
+		}
+	}
+
+	return best
+}
+
+// importColumns returns the index of every field in header, -1 for the
+// optional fields that are missing
+func importColumns(header []string, mapping types.DealImportMapping) (map[string]int, error) {
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[normalizeHeader(name)] = i
+	}
+
+	mapped := map[string]string{
+		"coin":         mapping.Coin,
+		"count":        mapping.Count,
+		"price":        mapping.Price,
+		"date":         mapping.Date,
+		"side":         mapping.Side,
+		"fee":          mapping.Fee,
+		"fee_currency": mapping.FeeCurrency,
+	}
+
+	columns := make(map[string]int, len(mapped))
+	var missing []string
+
+	for field, name := range mapped {
+		columns[field] = -1
+
+		if name != "" {
+			i, ok := index[normalizeHeader(name)]
+			if !ok {
+				return nil, fmt.Errorf("%w: column %q of the mapping is not in the header", ErrInvalidCSV, name)
+			}
+
+			columns[field] = i
+			continue
+		}
+
+		for _, alias := range importAliases[field] {
+			if i, ok := index[alias]; ok {
+				columns[field] = i
+				break
+			}
+		}
+
+		if columns[field] < 0 && !optionalImportFields[field] {
+			missing = append(missing, field)
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: no column for %s, map it explicitly", ErrInvalidCSV, strings.Join(missing, ", "))
+	}
+
+	return columns, nil
+}
+
+func normalizeHeader(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+}
+
+func parseRow(userID int, record []string, columns map[string]int, coins *coinIndex) (*types.Deal, []types.FieldError) {
+	value := func(field string) string {
+		i := columns[field]
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+
+		return strings.TrimSpace(record[i])
+	}
+
+	deal := &types.Deal{UserId: int64(userID)}
+	var errs []types.FieldError
+
+	if coin := value("coin"); coin != "" {
+		id, ok := coins.resolve(coin)
+		if !ok {
+			errs = append(errs, types.FieldError{Field: "coin", Rule: "unknown_coin", Message: fmt.Sprintf("unknown coin %q", coin)})
+		}
+		deal.CurrencyId = id
+	}
+
+	count, err := parseNumber(value("count"))
+	if err != nil {
+		errs = append(errs, types.FieldError{Field: "count", Rule: "number", Message: "count must be a number"})
+	}
+	deal.Count = count
+
+	price, err := parseNumber(value("price"))
+	if err != nil || price < 0 {
+		errs = append(errs, types.FieldError{Field: "price", Rule: "number", Message: "price must be a positive number"})
+	}
+	deal.Price = price
+
+	switch side := strings.ToLower(value("side")); side {
+	case "", "buy", "b":
+	case "sell", "s":
+		deal.Count = -math.Abs(deal.Count)
+	default:
+		errs = append(errs, types.FieldError{Field: "side", Rule: "oneof", Message: fmt.Sprintf("side must be buy or sell, got %q", side)})
+	}
+
+	fee, err := parseNumber(value("fee"))
+	if err != nil || fee < 0 {
+		errs = append(errs, types.FieldError{Field: "fee", Rule: "number", Message: "fee must be a positive number"})
+	}
+	deal.Fee = fee
+
+	if feeCurrency := value("fee_currency"); feeCurrency != "" && !strings.EqualFold(feeCurrency, types.FeeFiat) {
+		id, ok := coins.resolve(feeCurrency)
+		if !ok || id != deal.CurrencyId {
+			errs = append(errs, types.FieldError{
+				Field:   "fee_currency",
+				Rule:    "oneof",
+				Message: fmt.Sprintf("fee_currency must be %s or the coin of the row, got %q", types.FeeFiat, feeCurrency),
+			})
+		}
+		deal.FeeCurrency = id
+	}
+
+	if date := value("date"); date != "" {
+		createdAt, err := parseDate(date)
+		if err != nil {
+			errs = append(errs, types.FieldError{Field: "date", Rule: "date", Message: fmt.Sprintf("invalid date %q", date)})
+		} else if createdAt.After(time.Now()) {
+			errs = append(errs, types.FieldError{Field: "date", Rule: "past", Message: "date must not be in the future"})
+		}
+		deal.CreatedAt = createdAt
+	}
+
+	return deal, errs
+}
+
+// parseNumber accepts plain numbers with an optional $ and spaces or commas
+// as thousand separators
+func parseNumber(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	s = strings.NewReplacer("$", "", " ", "", ",", "").Replace(s)
+	return strconv.ParseFloat(s, 64)
+}
+
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range importDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+
+	return time.Time{}, errors.New("unknown date format")
+}
+
+// coinIndex finds the CoinGecko id of a coin by its id, symbol or name. A
+// symbol shared by several coins resolves to the one with the largest market
+// cap, the market data is sorted by it.
+type coinIndex struct {
+	ids     map[string]bool
+	symbols map[string]string
+	names   map[string]string
+	// prices are the current USD prices by id
+	prices map[string]float64
+}
+
+func (im *Importer) coinIndex(ctx context.Context) (*coinIndex, error) {
+	data, err := im.coins.GetCurrencyData(ctx, "usd")
+	if err != nil {
+		return nil, err
+	}
+
+	index := &coinIndex{
+		ids:     make(map[string]bool, len(data)),
+		symbols: make(map[string]string, len(data)),
+		names:   make(map[string]string, len(data)),
+		prices:  make(map[string]float64, len(data)),
+	}
+
+	for _, coin := range data {
+		index.ids[coin.Id] = true
+		index.prices[coin.Id] = coin.CurrentPrice
+
+		if _, ok := index.symbols[strings.ToLower(coin.Symbol)]; !ok {
+			index.symbols[strings.ToLower(coin.Symbol)] = coin.Id
+		}
+		if _, ok := index.names[strings.ToLower(coin.Name)]; !ok {
+			index.names[strings.ToLower(coin.Name)] = coin.Id
+		}
+	}
+
+	return index, nil
+}
+
+func (c *coinIndex) resolve(coin string) (string, bool) {
+	coin = strings.ToLower(strings.TrimSpace(coin))
+
+	if c.ids[coin] {
+		return coin, true
+	}
+	if id, ok := c.symbols[coin]; ok {
+		return id, true
+	}
+	if id, ok := c.names[coin]; ok {
+		return id, true
+	}
+
+	return "", false
+}
+
+func (c *coinIndex) bySymbol(symbol string) (string, bool) {
+	id, ok := c.symbols[strings.ToLower(symbol)]
+	return id, ok
+}
+
+// existingDeals returns the keys of the deals the user already has in the
+// portfolio
+func (im *Importer) existingDeals(userID int, portfolioID int64) (map[string]bool, error) {
+	deals, err := im.service.GetByUserID(strconv.Itoa(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(deals))
+	for _, deal := range deals {
+		if deal.PortfolioId == portfolioID {
+			markSeen(seen, deal)
+		}
+	}
+
+	return seen, nil
+}
+
+// dealKey identifies a deal for the duplicate detection. Rows without a date
+// are keyed on the other fields only, so that a re-import matches the deal an
+// earlier import stored for them, whatever date it was given.
+func dealKey(deal *types.Deal) string {
+	// The currency of a zero fee does not tell deals apart
+	feeCurrency := deal.FeeCurrency
+	if deal.Fee == 0 {
+		feeCurrency = types.FeeFiat
+	}
+
+	key := fmt.Sprintf("%s|%.8f|%.8f|%.8f|%s", deal.CurrencyId, deal.Count, deal.Price, deal.Fee, feeCurrency)
+	if deal.CreatedAt.IsZero() {
+		return key
+	}
+
+	return key + "|" + strconv.FormatInt(deal.CreatedAt.Unix(), 10)
+}
+
+// markSeen records the deal under its own key and under the key of an undated
+// row with the same fields
+func markSeen(seen map[string]bool, deal *types.Deal) {
+	seen[dealKey(deal)] = true
+	if !deal.CreatedAt.IsZero() {
+		undated := *deal
+		undated.CreatedAt = time.Time{}
+		seen[dealKey(&undated)] = true
+	}
+}
@@ -0,0 +1,127 @@
+package importers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+func init() {
+	Register(binance{})
+}
+
+// binance parses the spot trade history export. Both the older layout with
+// units in the values ("Date(UTC),Pair,Side,Price,Executed,Amount,Fee") and
+// the newer one ("Date(UTC),Market,Type,Price,Amount,Total,Fee,Fee Coin")
+// are supported.
+type binance struct{}
+
+// binanceQuotes are the quotes of the markets, the USD of the Binance.US
+// exports comes before the stablecoins ending with it
+var binanceQuotes = []string{
+	"USD", "EUR", "GBP", "TRY", "BRL", "AUD", "JPY", "RUB", "UAH", "ZAR", "PLN", "ARS", "MXN",
+	"USDT", "USDC", "FDUSD", "BUSD", "TUSD", "USDP", "DAI",
+	"BTC", "ETH", "BNB",
+}
+
+func (binance) Name() string {
+	return "binance"
+}
+
+func (binance) Parse(r io.Reader, known KnownAsset) ([]Row, error) {
+	records, lines, err := readAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, errors.New("empty file")
+	}
+
+	h := newHeader(records[0])
+
+	var parse func(record []string, known KnownAsset) (Trade, error)
+	switch {
+	case h.has("date(utc)", "pair", "side", "price", "executed", "fee"):
+		parse = h.binanceLegacy
+	case h.has("date(utc)", "market", "type", "price", "amount", "fee", "fee coin"):
+		parse = h.binance
+	default:
+		return nil, errors.New("not a Binance trade history export")
+	}
+
+	rows := make([]Row, 0, len(records)-1)
+	for i, record := range records[1:] {
+		trade, err := parse(record, known)
+		rows = append(rows, Row{Line: lines[i+1], Trade: trade, Err: err})
+	}
+
+	return rows, nil
+}
+
+func (h header) binance(record []string, known KnownAsset) (Trade, error) {
+	trade := Trade{Pair: h.get(record, "market")}
+
+	var errs []error
+	var err error
+
+	trade.Time, err = parseTime(h.get(record, "date(utc)"), "2006-01-02 15:04:05")
+	errs = append(errs, err)
+
+	trade.Base, trade.Quote, err = SplitPair(trade.Pair, binanceQuotes, known)
+	errs = append(errs, err)
+
+	trade.Side, err = parseSide(h.get(record, "type"))
+	errs = append(errs, err)
+
+	trade.Price, err = parseNumber(h.get(record, "price"))
+	errs = append(errs, wrap("price", err))
+
+	trade.Amount, err = parseNumber(h.get(record, "amount"))
+	errs = append(errs, wrap("amount", err))
+
+	if fee := h.get(record, "fee"); fee != "" {
+		trade.Fee, err = parseNumber(fee)
+		errs = append(errs, wrap("fee", err))
+		trade.FeeCurrency = Asset(h.get(record, "fee coin"))
+	}
+
+	return trade, errors.Join(errs...)
+}
+
+func (h header) binanceLegacy(record []string, known KnownAsset) (Trade, error) {
+	trade := Trade{Pair: h.get(record, "pair")}
+
+	var errs []error
+	var err error
+
+	trade.Time, err = parseTime(h.get(record, "date(utc)"), "2006-01-02 15:04:05")
+	errs = append(errs, err)
+
+	trade.Base, trade.Quote, err = SplitPair(trade.Pair, binanceQuotes, known)
+	errs = append(errs, err)
+
+	trade.Side, err = parseSide(h.get(record, "side"))
+	errs = append(errs, err)
+
+	trade.Price, err = parseNumber(h.get(record, "price"))
+	errs = append(errs, wrap("price", err))
+
+	trade.Amount, _, err = parseAmount(h.get(record, "executed"))
+	errs = append(errs, wrap("executed", err))
+
+	if fee := h.get(record, "fee"); fee != "" {
+		trade.Fee, trade.FeeCurrency, err = parseAmount(fee)
+		errs = append(errs, wrap("fee", err))
+	}
+
+	return trade, errors.Join(errs...)
+}
+
+func wrap(field string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return fmt.Errorf("invalid %s: %w", field, err)
+}
@@ -0,0 +1,144 @@
+package importers
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+func init() {
+	Register(coinbase{})
+}
+
+// coinbase parses the transaction history report of the Coinbase app
+// ("Timestamp,Transaction Type,Asset,Quantity Transacted,Spot Price Currency,
+// Spot Price at Transaction,Subtotal,Total ...,Fees ...,Notes") and the fills
+// report of Coinbase Advanced Trade ("portfolio,trade id,product,side,
+// created at,size,size unit,price,fee,total,price/fee/total unit"). The lines
+// before the header of the transaction report are skipped, and so are the
+// transactions that are not buys or sells.
+type coinbase struct{}
+
+// coinbaseQuotes are the quotes of the products, which are written with a
+// dash such as BTC-USD in the current exports
+var coinbaseQuotes = []string{
+	"USD", "EUR", "GBP", "CAD", "AUD",
+	"USDC", "USDT", "DAI", "BTC", "ETH",
+}
+
+func (coinbase) Name() string {
+	return "coinbase"
+}
+
+func (coinbase) Parse(r io.Reader, known KnownAsset) ([]Row, error) {
+	records, lines, err := readAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, record := range records {
+		h := newHeader(record)
+
+		switch {
+		case h.has("timestamp", "transaction type", "asset", "quantity transacted", "spot price currency", "spot price at transaction"):
+			return h.coinbaseTransactions(records[i+1:], lines[i+1:]), nil
+		case h.has("product", "side", "created at", "size", "price", "fee", "price/fee/total unit"):
+			return h.coinbaseFills(records[i+1:], lines[i+1:], known), nil
+		}
+	}
+
+	return nil, errors.New("not a Coinbase transaction history or fills export")
+}
+
+func (h header) coinbaseTransactions(records [][]string, lines []int) []Row {
+	var rows []Row
+
+	for i, record := range records {
+		kind := strings.ToLower(h.get(record, "transaction type"))
+
+		var side string
+		switch kind {
+		case "buy", "advanced trade buy", "advance trade buy":
+			side = SideBuy
+		case "sell", "advanced trade sell", "advance trade sell":
+			side = SideSell
+		default:
+			continue
+		}
+
+		trade := Trade{
+			Side:        side,
+			Base:        Asset(h.get(record, "asset")),
+			Quote:       Asset(h.get(record, "spot price currency")),
+			FeeCurrency: Asset(h.get(record, "spot price currency")),
+		}
+		trade.Pair = trade.Base + "-" + trade.Quote
+
+		var errs []error
+		var err error
+
+		trade.Time, err = parseTime(h.get(record, "timestamp"), "2006-01-02T15:04:05Z07:00", "2006-01-02 15:04:05 MST", "2006-01-02 15:04:05 UTC")
+		errs = append(errs, err)
+
+		trade.Amount, err = parseNumber(h.get(record, "quantity transacted"))
+		errs = append(errs, wrap("quantity", err))
+
+		trade.Price, err = parseNumber(h.get(record, "spot price at transaction"))
+		errs = append(errs, wrap("spot price", err))
+
+		if fee := h.feesColumn(record); fee != "" {
+			trade.Fee, err = parseNumber(fee)
+			errs = append(errs, wrap("fees", err))
+		}
+
+		rows = append(rows, Row{Line: lines[i], Trade: trade, Err: errors.Join(errs...)})
+	}
+
+	return rows
+}
+
+// feesColumn reads "Fees and/or Spread" of the current reports or "Fees" of
+// the older ones
+func (h header) feesColumn(record []string) string {
+	for _, name := range []string{"fees and/or spread", "fees"} {
+		if _, ok := h[name]; ok {
+			return h.get(record, name)
+		}
+	}
+
+	return ""
+}
+
+func (h header) coinbaseFills(records [][]string, lines []int, known KnownAsset) []Row {
+	rows := make([]Row, 0, len(records))
+
+	for i, record := range records {
+		trade := Trade{Pair: h.get(record, "product")}
+
+		var errs []error
+		var err error
+
+		trade.Time, err = parseTime(h.get(record, "created at"), "2006-01-02T15:04:05.999Z07:00", "2006-01-02T15:04:05Z07:00")
+		errs = append(errs, err)
+
+		trade.Base, trade.Quote, err = SplitPair(trade.Pair, coinbaseQuotes, known)
+		errs = append(errs, err)
+
+		trade.Side, err = parseSide(h.get(record, "side"))
+		errs = append(errs, err)
+
+		trade.Amount, err = parseNumber(h.get(record, "size"))
+		errs = append(errs, wrap("size", err))
+
+		trade.Price, err = parseNumber(h.get(record, "price"))
+		errs = append(errs, wrap("price", err))
+
+		trade.Fee, err = parseNumber(h.get(record, "fee"))
+		errs = append(errs, wrap("fee", err))
+		trade.FeeCurrency = Asset(h.get(record, "price/fee/total unit"))
+
+		rows = append(rows, Row{Line: lines[i], Trade: trade, Err: errors.Join(errs...)})
+	}
+
+	return rows
+}
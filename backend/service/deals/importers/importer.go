@@ -0,0 +1,267 @@
+// Package importers parses the trade-history exports of exchanges. Every
+// exchange is a TradeImporter that registers itself by name, the deals
+// importer converts the trades to deals.
+package importers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SideBuy  = "buy"
+	SideSell = "sell"
+)
+
+var ErrUnknownPair = errors.New("unknown trading pair")
+
+// Trade is one executed trade of an export, normalized across the exchanges
+type Trade struct {
+	Time time.Time `json:"time"`
+	// Pair is the market as written in the export, e.g. BTCUSDT or XXBTZUSD
+	Pair string `json:"pair"`
+	// Base and Quote are upper case symbols, e.g. BTC and USDT
+	Base  string `json:"base"`
+	Quote string `json:"quote"`
+	Side  string `json:"side"`
+	// Amount is in Base, Price is the price of one Base in Quote
+	Amount      float64 `json:"amount"`
+	Price       float64 `json:"price"`
+	Fee         float64 `json:"fee"`
+	FeeCurrency string  `json:"fee_currency,omitempty"`
+}
+
+// Row is a parsed line of an export, Err is set when the line is not a
+// valid trade
+type Row struct {
+	Line  int
+	Trade Trade
+	Err   error
+}
+
+// TradeImporter parses the trade-history export of one exchange. Rows that
+// are not trades, such as deposits, are left out.
+type TradeImporter interface {
+	Name() string
+	Parse(r io.Reader, known KnownAsset) ([]Row, error)
+}
+
+var (
+	mu        sync.RWMutex
+	importers = make(map[string]TradeImporter)
+)
+
+// Register makes an importer available by its name, it is called from the
+// init function of every importer
+func Register(importer TradeImporter) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, exists := importers[importer.Name()]; exists {
+		panic("importers: " + importer.Name() + " registered twice")
+	}
+
+	importers[importer.Name()] = importer
+}
+
+func Get(name string) (TradeImporter, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	importer, ok := importers[strings.ToLower(name)]
+	return importer, ok
+}
+
+// Names returns the names of the registered importers, sorted
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(importers))
+	for name := range importers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// aliases are the exchange specific codes of common assets
+var aliases = map[string]string{
+	"XBT": "BTC",
+	"XDG": "DOGE",
+}
+
+// krakenLegacy are the X (crypto) and Z (fiat) prefixed asset codes of the
+// older Kraken pairs such as XXBTZUSD
+var krakenLegacy = map[string]string{
+	"XETC": "ETC", "XETH": "ETH", "XLTC": "LTC", "XMLN": "MLN", "XREP": "REP",
+	"XXBT": "BTC", "XXDG": "DOGE", "XXLM": "XLM", "XXMR": "XMR", "XXRP": "XRP",
+	"XZEC": "ZEC", "ZAUD": "AUD", "ZCAD": "CAD", "ZEUR": "EUR", "ZGBP": "GBP",
+	"ZJPY": "JPY", "ZUSD": "USD", "ZCHF": "CHF",
+}
+
+// KnownAsset tells whether a symbol, as returned by Asset, is a coin the
+// caller can import. A pair without a separator is only split where the
+// base is known, nil accepts any base.
+type KnownAsset func(symbol string) bool
+
+// SplitPair splits a market such as BTCUSDT, BTC-USD, BTC/EUR or XXBTZUSD
+// into its base and quote symbols. A pair without a separator is split at
+// the first of the quotes of the exchange it ends with, so the fiat quotes
+// come before the stablecoins whose names end with them: DOTUSD is DOT and
+// USD, not DO and TUSD.
+func SplitPair(pair string, quotes []string, known KnownAsset) (base, quote string, err error) {
+	p := strings.ToUpper(strings.TrimSpace(pair))
+
+	for _, sep := range []string{"-", "/", "_", " "} {
+		if b, q, ok := strings.Cut(p, sep); ok && b != "" && q != "" {
+			return Asset(b), Asset(q), nil
+		}
+	}
+
+	if len(p) == 8 {
+		_, baseOK := krakenLegacy[p[:4]]
+		_, quoteOK := krakenLegacy[p[4:]]
+		if baseOK && quoteOK {
+			return Asset(p[:4]), Asset(p[4:]), nil
+		}
+	}
+
+	for _, q := range quotes {
+		if b, ok := strings.CutSuffix(p, q); ok && b != "" && (known == nil || known(Asset(b))) {
+			return Asset(b), Asset(q), nil
+		}
+	}
+
+	return "", "", fmt.Errorf("%w: %s", ErrUnknownPair, pair)
+}
+
+// Asset normalizes an asset code: upper case, with the Kraken legacy codes
+// and aliases such as XBT resolved
+func Asset(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	if legacy, ok := krakenLegacy[code]; ok {
+		return legacy
+	}
+
+	if alias, ok := aliases[code]; ok {
+		return alias
+	}
+
+	return code
+}
+
+// header maps the lower cased column names of an export to their index
+type header map[string]int
+
+func newHeader(record []string) header {
+	h := make(header, len(record))
+	for i, name := range record {
+		h[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+
+	return h
+}
+
+func (h header) has(names ...string) bool {
+	for _, name := range names {
+		if _, ok := h[name]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// get returns the trimmed value of the column, empty when it is missing
+func (h header) get(record []string, name string) string {
+	i, ok := h[name]
+	if !ok || i >= len(record) {
+		return ""
+	}
+
+	return strings.TrimSpace(record[i])
+}
+
+// readAll returns the records of a CSV file and the line of every record,
+// blank lines are skipped
+func readAll(r io.Reader) ([][]string, []int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var records [][]string
+	var lines []int
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		records = append(records, record)
+		lines = append(lines, line)
+	}
+
+	return records, lines, nil
+}
+
+// parseNumber accepts numbers with a currency sign and comma thousand
+// separators such as "$1,234.50"
+func parseNumber(s string) (float64, error) {
+	s = strings.NewReplacer(",", "", "$", "", "€", "", "£", "", " ", "").Replace(s)
+	if s == "" {
+		return 0, errors.New("missing number")
+	}
+
+	return strconv.ParseFloat(s, 64)
+}
+
+// parseAmount splits a number with a unit suffix, like "0.0012BTC" of the
+// Binance exports
+func parseAmount(s string) (float64, string, error) {
+	s = strings.TrimSpace(s)
+
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.' && r != ',' && r != '-'
+	})
+	if i < 0 {
+		n, err := parseNumber(s)
+		return n, "", err
+	}
+
+	n, err := parseNumber(s[:i])
+	return n, Asset(s[i:]), err
+}
+
+func parseTime(s string, layouts ...string) (time.Time, error) {
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+func parseSide(s string) (string, error) {
+	switch side := strings.ToLower(strings.TrimSpace(s)); side {
+	case "buy", "sell":
+		return side, nil
+	default:
+		return "", fmt.Errorf("invalid side %q", s)
+	}
+}
@@ -0,0 +1,139 @@
+package importers
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// knownAssets are the symbols of the coins in the sample exports
+var knownAssets = []string{"ADA", "BAT", "BNB", "BTC", "DOGE", "DOT", "ETH", "FET", "GRT", "SOL", "USDC", "USDT"}
+
+func known(symbol string) bool {
+	for _, asset := range knownAssets {
+		if asset == symbol {
+			return true
+		}
+	}
+
+	return false
+}
+
+// goldenRow is a Row with its error as text
+type goldenRow struct {
+	Line  int    `json:"line"`
+	Trade Trade  `json:"trade"`
+	Err   string `json:"error,omitempty"`
+}
+
+// TestGolden parses every testdata/<exchange>[_<layout>].csv with the
+// importer of the exchange and compares the rows with the .golden.json file
+// next to it. Run go test -update to rewrite the golden files.
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) == 0 {
+		t.Fatal("no sample exports in testdata")
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".csv")
+
+		t.Run(name, func(t *testing.T) {
+			exchange, _, _ := strings.Cut(name, "_")
+			importer, ok := Get(exchange)
+			if !ok {
+				t.Fatalf("no importer for %s", exchange)
+			}
+
+			f, err := os.Open(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			rows, err := importer.Parse(f, known)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+
+			got := make([]goldenRow, 0, len(rows))
+			for _, row := range rows {
+				golden := goldenRow{Line: row.Line, Trade: row.Trade}
+				if row.Err != nil {
+					golden.Err = row.Err.Error()
+				}
+				got = append(got, golden)
+			}
+
+			actual, err := json.MarshalIndent(got, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual = append(actual, '\n')
+
+			path := filepath.Join("testdata", name+".golden.json")
+			if *update {
+				if err := os.WriteFile(path, actual, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expected, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v, run go test -update to create it", err)
+			}
+
+			if !bytes.Equal(actual, expected) {
+				t.Errorf("rows of %s differ from %s\ngot:\n%s", file, path, actual)
+			}
+		})
+	}
+}
+
+func TestSplitPair(t *testing.T) {
+	tests := []struct {
+		pair   string
+		quotes []string
+		base   string
+		quote  string
+	}{
+		{"DOTUSD", krakenQuotes, "DOT", "USD"},
+		{"GRTUSD", krakenQuotes, "GRT", "USD"},
+		{"BATUSD", krakenQuotes, "BAT", "USD"},
+		{"FETUSD", krakenQuotes, "FET", "USD"},
+		{"XXBTZUSD", krakenQuotes, "BTC", "USD"},
+		{"XBTUSDT", krakenQuotes, "BTC", "USDT"},
+		{"BTCUSDT", binanceQuotes, "BTC", "USDT"},
+		{"BTCFDUSD", binanceQuotes, "BTC", "FDUSD"},
+		{"ADATUSD", binanceQuotes, "ADA", "TUSD"},
+		{"DOTUSD", binanceQuotes, "DOT", "USD"},
+		{"ETHBTC", binanceQuotes, "ETH", "BTC"},
+		{"BTC-USD", coinbaseQuotes, "BTC", "USD"},
+	}
+
+	for _, tt := range tests {
+		base, quote, err := SplitPair(tt.pair, tt.quotes, known)
+		if err != nil {
+			t.Errorf("SplitPair(%q): %v", tt.pair, err)
+			continue
+		}
+
+		if base != tt.base || quote != tt.quote {
+			t.Errorf("SplitPair(%q) = %s, %s, want %s, %s", tt.pair, base, quote, tt.base, tt.quote)
+		}
+	}
+
+	if _, _, err := SplitPair("XYZUSDT", binanceQuotes, known); err == nil {
+		t.Error("SplitPair(\"XYZUSDT\") split a pair with an unknown base")
+	}
+}
@@ -0,0 +1,79 @@
+package importers
+
+import (
+	"errors"
+	"io"
+)
+
+func init() {
+	Register(kraken{})
+}
+
+// kraken parses the trades.csv export
+// ("txid","ordertxid","pair","time","type","ordertype","price","cost","fee","vol",...).
+// The fee is in the quote currency.
+type kraken struct{}
+
+// krakenQuotes are the quotes of the pairs without a separator, such as
+// DOTUSD or XBTUSDT. Kraken has no TUSD market.
+var krakenQuotes = []string{
+	"ZUSD", "ZEUR", "ZGBP", "ZCAD", "ZAUD", "ZJPY", "ZCHF",
+	"USD", "EUR", "GBP", "CAD", "AUD", "JPY", "CHF",
+	"USDT", "USDC", "DAI", "XBT", "ETH",
+}
+
+func (kraken) Name() string {
+	return "kraken"
+}
+
+func (kraken) Parse(r io.Reader, known KnownAsset) ([]Row, error) {
+	records, lines, err := readAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, errors.New("empty file")
+	}
+
+	h := newHeader(records[0])
+	if !h.has("pair", "time", "type", "price", "fee", "vol") {
+		return nil, errors.New("not a Kraken trades export")
+	}
+
+	rows := make([]Row, 0, len(records)-1)
+	for i, record := range records[1:] {
+		trade, err := h.kraken(record, known)
+		rows = append(rows, Row{Line: lines[i+1], Trade: trade, Err: err})
+	}
+
+	return rows, nil
+}
+
+func (h header) kraken(record []string, known KnownAsset) (Trade, error) {
+	trade := Trade{Pair: h.get(record, "pair")}
+
+	var errs []error
+	var err error
+
+	trade.Time, err = parseTime(h.get(record, "time"), "2006-01-02 15:04:05.9999", "2006-01-02 15:04:05")
+	errs = append(errs, err)
+
+	trade.Base, trade.Quote, err = SplitPair(trade.Pair, krakenQuotes, known)
+	errs = append(errs, err)
+
+	trade.Side, err = parseSide(h.get(record, "type"))
+	errs = append(errs, err)
+
+	trade.Price, err = parseNumber(h.get(record, "price"))
+	errs = append(errs, wrap("price", err))
+
+	trade.Amount, err = parseNumber(h.get(record, "vol"))
+	errs = append(errs, wrap("vol", err))
+
+	trade.Fee, err = parseNumber(h.get(record, "fee"))
+	errs = append(errs, wrap("fee", err))
+	trade.FeeCurrency = trade.Quote
+
+	return trade, errors.Join(errs...)
+}
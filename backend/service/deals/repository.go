@@ -1,6 +1,7 @@
 package deals
 
 import (
+	"context"
 	"crypto-tracker/types"
 	"database/sql"
 	"errors"
@@ -14,6 +15,11 @@ type DealRepository interface {
 	GetAll() ([]*types.Deal, error)
 	Update(deal *types.Deal) error
 	Delete(id int64) error
+	GetUserIDs() ([]int64, error)
+	CreateMany(deals []*types.Deal) error
+	StreamByUserID(ctx context.Context, userID int64, from, to time.Time, fn func(*types.Deal) error) error
+	CreateLocked(ctx context.Context, deal *types.Deal) error
+	DeleteLocked(ctx context.Context, deal *types.Deal, check func(holding *types.Portfolio, transferredOut float64) error) error
 }
 
 type Repository struct {
@@ -26,7 +32,7 @@ func NewRepository(db *sql.DB) *Repository {
 
 func (r *Repository) GetAll() ([]*types.Deal, error) {
 	query := `
-		SELECT id, user_id, currency_id, count, price, created_at, updated_at
+		SELECT id, user_id, currency_id, count, price, fee, fee_currency, portfolio_id, COALESCE(transfer_id, 0), created_at, updated_at
 		FROM deals
 		ORDER BY created_at DESC
 	`
@@ -49,6 +55,10 @@ func (r *Repository) GetAll() ([]*types.Deal, error) {
 			&deal.CurrencyId,
 			&deal.Count,
 			&deal.Price,
+			&deal.Fee,
+			&deal.FeeCurrency,
+			&deal.PortfolioId,
+			&deal.TransferId,
 			&createdAt,
 			&updatedAt,
 		)
@@ -72,8 +82,8 @@ func (r *Repository) GetAll() ([]*types.Deal, error) {
 
 func (r *Repository) Create(deal *types.Deal) error {
 	query := `
-		INSERT INTO deals (user_id, currency_id, count, price, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, NOW(), NOW())
+		INSERT INTO deals (user_id, currency_id, count, price, fee, fee_currency, portfolio_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW())
 		RETURNING id, created_at, updated_at
 	`
 
@@ -83,6 +93,9 @@ func (r *Repository) Create(deal *types.Deal) error {
 		deal.CurrencyId,
 		deal.Count,
 		deal.Price,
+		deal.Fee,
+		deal.FeeCurrency,
+		deal.PortfolioId,
 	).Scan(&deal.Id, &deal.CreatedAt, &deal.UpdatedAt)
 
 	if err != nil {
@@ -92,9 +105,39 @@ func (r *Repository) Create(deal *types.Deal) error {
 	return nil
 }
 
+// CreateMany inserts the deals in one transaction, either all of them are
+// stored or none. A zero CreatedAt is stored as now.
+func (r *Repository) CreateMany(deals []*types.Deal) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO deals (user_id, currency_id, count, price, fee, fee_currency, portfolio_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, COALESCE($8, NOW()), NOW())
+		RETURNING id, created_at, updated_at
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, deal := range deals {
+		err := stmt.QueryRow(deal.UserId, deal.CurrencyId, deal.Count, deal.Price, deal.Fee, deal.FeeCurrency, deal.PortfolioId, nullTime(deal.CreatedAt)).
+			Scan(&deal.Id, &deal.CreatedAt, &deal.UpdatedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
 func (r *Repository) GetByID(id int64) (*types.Deal, error) {
 	query := `
-		SELECT id, user_id, currency_id, count, price, created_at, updated_at
+		SELECT id, user_id, currency_id, count, price, fee, fee_currency, portfolio_id, COALESCE(transfer_id, 0), created_at, updated_at
 		FROM deals
 		WHERE id = $1
 	`
@@ -108,6 +151,10 @@ func (r *Repository) GetByID(id int64) (*types.Deal, error) {
 		&deal.CurrencyId,
 		&deal.Count,
 		&deal.Price,
+		&deal.Fee,
+		&deal.FeeCurrency,
+		&deal.PortfolioId,
+		&deal.TransferId,
 		&createdAt,
 		&updatedAt,
 	)
@@ -127,7 +174,7 @@ func (r *Repository) GetByID(id int64) (*types.Deal, error) {
 
 func (r *Repository) GetByUserID(userID string) ([]*types.Deal, error) {
 	query := `
-		SELECT id, user_id, currency_id, count, price, created_at, updated_at
+		SELECT id, user_id, currency_id, count, price, fee, fee_currency, portfolio_id, COALESCE(transfer_id, 0), created_at, updated_at
 		FROM deals
 		WHERE user_id = $1
 		ORDER BY created_at DESC
@@ -151,6 +198,10 @@ func (r *Repository) GetByUserID(userID string) ([]*types.Deal, error) {
 			&deal.CurrencyId,
 			&deal.Count,
 			&deal.Price,
+			&deal.Fee,
+			&deal.FeeCurrency,
+			&deal.PortfolioId,
+			&deal.TransferId,
 			&createdAt,
 			&updatedAt,
 		)
@@ -175,8 +226,8 @@ func (r *Repository) GetByUserID(userID string) ([]*types.Deal, error) {
 func (r *Repository) Update(deal *types.Deal) error {
 	query := `
 		UPDATE deals
-		SET user_id = $1, currency_id = $2, count = $3, price = $4, updated_at = NOW()
-		WHERE id = $5
+		SET user_id = $1, currency_id = $2, count = $3, price = $4, fee = $5, fee_currency = $6, portfolio_id = $7, updated_at = NOW()
+		WHERE id = $8
 		RETURNING updated_at
 	`
 
@@ -188,12 +239,15 @@ func (r *Repository) Update(deal *types.Deal) error {
 		deal.CurrencyId,
 		deal.Count,
 		deal.Price,
+		deal.Fee,
+		deal.FeeCurrency,
+		deal.PortfolioId,
 		deal.Id,
 	).Scan(&updatedAt)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return errors.New("deal not found")
+			return ErrDealNotFound
 		}
 		return err
 	}
@@ -217,8 +271,187 @@ func (r *Repository) Delete(id int64) error {
 	}
 
 	if rowsAffected == 0 {
-		return errors.New("deal not found")
+		return ErrDealNotFound
 	}
 
 	return nil
 }
+
+// lockHolding locks the portfolio of the deal until the end of tx, like the
+// transfers out of it do, and returns the holding of the coin in it without
+// the deal and the count of the coin transferred out of it
+func lockHolding(ctx context.Context, tx *sql.Tx, deal *types.Deal) (*types.Portfolio, float64, error) {
+	var id int64
+	err := tx.QueryRowContext(ctx, `SELECT id FROM portfolios WHERE id = $1 AND user_id = $2 FOR UPDATE`, deal.PortfolioId, deal.UserId).Scan(&id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT count, price, fee, fee_currency, transfer_id IS NOT NULL
+		FROM deals
+		WHERE user_id = $1 AND portfolio_id = $2 AND currency_id = $3 AND id <> $4
+	`, deal.UserId, deal.PortfolioId, deal.CurrencyId, deal.Id)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	holding := &types.Portfolio{CurrencyID: deal.CurrencyId}
+	transferredOut := 0.0
+	for rows.Next() {
+		other := types.Deal{CurrencyId: deal.CurrencyId}
+		var transfer bool
+		if err := rows.Scan(&other.Count, &other.Price, &other.Fee, &other.FeeCurrency, &transfer); err != nil {
+			return nil, 0, err
+		}
+
+		holding.Add(&other)
+		if transfer && other.Count < 0 {
+			transferredOut -= other.Count
+		}
+	}
+
+	return holding, transferredOut, rows.Err()
+}
+
+// CreateLocked is Create while the portfolio of the deal is locked, so that
+// a sell and a transfer out of the portfolio run one after the other
+func (r *Repository) CreateLocked(ctx context.Context, deal *types.Deal) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, _, err := lockHolding(ctx, tx, deal); err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO deals (user_id, currency_id, count, price, fee, fee_currency, portfolio_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`,
+		deal.UserId,
+		deal.CurrencyId,
+		deal.Count,
+		deal.Price,
+		deal.Fee,
+		deal.FeeCurrency,
+		deal.PortfolioId,
+	).Scan(&deal.Id, &deal.CreatedAt, &deal.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteLocked deletes the deal while its portfolio is locked. check is
+// given the holding of the portfolio without the deal and the count
+// transferred out of it.
+func (r *Repository) DeleteLocked(ctx context.Context, deal *types.Deal, check func(holding *types.Portfolio, transferredOut float64) error) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	holding, transferredOut, err := lockHolding(ctx, tx, deal)
+	if err != nil {
+		return err
+	}
+
+	if err := check(holding, transferredOut); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM deals WHERE id = $1`, deal.Id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrDealNotFound
+	}
+
+	return tx.Commit()
+}
+
+// GetUserIDs returns the users that have at least one deal
+func (r *Repository) GetUserIDs() ([]int64, error) {
+	rows, err := r.DB.Query(`SELECT DISTINCT user_id FROM deals ORDER BY user_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []int64
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, rows.Err()
+}
+
+// StreamByUserID calls fn with every deal of the user created in [from, to),
+// oldest first, without loading them all in memory. A zero from or to is
+// not a bound.
+func (r *Repository) StreamByUserID(ctx context.Context, userID int64, from, to time.Time, fn func(*types.Deal) error) error {
+	query := `
+		SELECT id, user_id, currency_id, count, price, fee, fee_currency, portfolio_id, COALESCE(transfer_id, 0), created_at, updated_at
+		FROM deals
+		WHERE user_id = $1
+			AND ($2::timestamp IS NULL OR created_at >= $2)
+			AND ($3::timestamp IS NULL OR created_at < $3)
+		ORDER BY created_at, id
+	`
+
+	rows, err := r.DB.QueryContext(ctx, query, userID, nullTime(from), nullTime(to))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var deal types.Deal
+
+		err := rows.Scan(
+			&deal.Id,
+			&deal.UserId,
+			&deal.CurrencyId,
+			&deal.Count,
+			&deal.Price,
+			&deal.Fee,
+			&deal.FeeCurrency,
+			&deal.PortfolioId,
+			&deal.TransferId,
+			&deal.CreatedAt,
+			&deal.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(&deal); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
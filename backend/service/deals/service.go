@@ -1,31 +1,93 @@
 package deals
 
 import (
+	"context"
+	"crypto-tracker/apperr"
 	"crypto-tracker/types"
-	"errors"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/go-playground/validator/v10"
 )
 
+// PortfolioResolver checks that a portfolio belongs to the user. The zero id
+// resolves to the default portfolio of the user, created when missing.
+type PortfolioResolver interface {
+	ResolvePortfolio(ctx context.Context, userID, portfolioID int64) (int64, error)
+}
+
+// countTolerance absorbs the rounding of the counts, stored with 8 decimals
+const countTolerance = 1e-8
+
 type DealService struct {
-	repo     DealRepository
-	validate *validator.Validate
+	repo       DealRepository
+	portfolios PortfolioResolver
+	validate   *validator.Validate
 }
 
-func NewDealService(repo DealRepository) *DealService {
+func NewDealService(repo DealRepository, portfolios PortfolioResolver) *DealService {
 	return &DealService{
-		repo:     repo,
-		validate: validator.New(),
+		repo:       repo,
+		portfolios: portfolios,
+		validate:   validator.New(),
 	}
 }
 
 func (s *DealService) Create(deal *types.Deal) error {
-	if err := s.validate.Struct(deal); err != nil {
+	if err := s.Validate(deal); err != nil {
 		return err
 	}
 
+	if deal.TransferId != 0 {
+		return ErrTransferDeal
+	}
+
+	portfolioID, err := s.ResolvePortfolio(context.Background(), deal.UserId, deal.PortfolioId)
+	if err != nil {
+		return err
+	}
+	deal.PortfolioId = portfolioID
+
+	// A sell waits for the transfers out of the portfolio in progress
+	if deal.Count < 0 {
+		return s.repo.CreateLocked(context.Background(), deal)
+	}
+
 	return s.repo.Create(deal)
 }
 
+// Validate checks a deal before it is stored. An empty fee currency is
+// taken as usd.
+func (s *DealService) Validate(deal *types.Deal) error {
+	if err := s.validate.Struct(deal); err != nil {
+		return apperr.FromValidator(err)
+	}
+
+	deal.FeeCurrency = strings.ToLower(strings.TrimSpace(deal.FeeCurrency))
+	if deal.FeeCurrency == "" {
+		deal.FeeCurrency = types.FeeFiat
+	}
+
+	if deal.FeeCurrency != types.FeeFiat && deal.FeeCurrency != deal.CurrencyId {
+		return apperr.Validation(types.FieldError{
+			Field:   "fee_currency",
+			Rule:    "oneof",
+			Message: fmt.Sprintf("fee_currency must be %s or %s", types.FeeFiat, deal.CurrencyId),
+		})
+	}
+
+	if deal.Count > 0 && deal.Quantity() <= 0 {
+		return apperr.Validation(types.FieldError{
+			Field:   "fee",
+			Rule:    "lt",
+			Message: "a fee paid in the coin must be less than the count",
+		})
+	}
+
+	return nil
+}
+
 func (s *DealService) GetByID(id int64) (*types.Deal, error) {
 	deal, err := s.repo.GetByID(id)
 	if err != nil {
@@ -33,7 +95,7 @@ func (s *DealService) GetByID(id int64) (*types.Deal, error) {
 	}
 
 	if deal == nil {
-		return nil, errors.New("deal not found")
+		return nil, ErrDealNotFound
 	}
 
 	return deal, nil
@@ -41,7 +103,7 @@ func (s *DealService) GetByID(id int64) (*types.Deal, error) {
 
 func (s *DealService) GetByUserID(userID string) ([]*types.Deal, error) {
 	if userID == "" {
-		return nil, errors.New("user ID is required")
+		return nil, ErrUserIDRequired
 	}
 
 	return s.repo.GetByUserID(userID)
@@ -51,13 +113,23 @@ func (s *DealService) GetAll() ([]*types.Deal, error) {
 	return s.repo.GetAll()
 }
 
+func (s *DealService) GetUserIDs() ([]int64, error) {
+	return s.repo.GetUserIDs()
+}
+
+// StreamUserDeals calls fn with the deals of the user created in [from, to),
+// oldest first
+func (s *DealService) StreamUserDeals(ctx context.Context, userID int64, from, to time.Time, fn func(*types.Deal) error) error {
+	return s.repo.StreamByUserID(ctx, userID, from, to, fn)
+}
+
 func (s *DealService) Update(deal *types.Deal) error {
-	if err := s.validate.Struct(deal); err != nil {
+	if err := s.Validate(deal); err != nil {
 		return err
 	}
 
 	if deal.Id <= 0 {
-		return errors.New("invalid deal ID")
+		return ErrInvalidDealID
 	}
 
 	existingDeal, err := s.repo.GetByID(deal.Id)
@@ -66,23 +138,73 @@ func (s *DealService) Update(deal *types.Deal) error {
 	}
 
 	if existingDeal == nil {
-		return errors.New("deal not found")
+		return ErrDealNotFound
 	}
 
+	if existingDeal.TransferId != 0 || deal.TransferId != 0 {
+		return ErrTransferDeal
+	}
+
+	// A deal without a portfolio stays in its own
+	if deal.PortfolioId == 0 {
+		deal.PortfolioId = existingDeal.PortfolioId
+	}
+
+	portfolioID, err := s.ResolvePortfolio(context.Background(), deal.UserId, deal.PortfolioId)
+	if err != nil {
+		return err
+	}
+	deal.PortfolioId = portfolioID
+
 	return s.repo.Update(deal)
 }
 
 func (s *DealService) Delete(id int64) error {
 	if id <= 0 {
-		return errors.New("invalid deal ID")
+		return ErrInvalidDealID
+	}
+
+	existingDeal, err := s.repo.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	if existingDeal == nil {
+		return ErrDealNotFound
+	}
+
+	if existingDeal.TransferId != 0 {
+		return ErrTransferDeal
 	}
 
-	return s.repo.Delete(id)
+	if existingDeal.Count < 0 {
+		return s.repo.Delete(id)
+	}
+
+	// The coins of a buy may have been transferred out of the portfolio, it
+	// is only deleted while the portfolio still holds them
+	return s.repo.DeleteLocked(context.Background(), existingDeal, func(holding *types.Portfolio, transferredOut float64) error {
+		if transferredOut > countTolerance && holding.TotalCount < -countTolerance {
+			return fmt.Errorf("%w: %g %s would be left, %g were transferred out",
+				ErrTransferredOut, holding.TotalCount, existingDeal.CurrencyId, transferredOut)
+		}
+
+		return nil
+	})
 }
 
-func (s *DealService) GetUserPortfolio(userID string) (map[string]*types.Portfolio, error) {
+// ResolvePortfolio returns the id of the portfolio of the user, the default
+// one for 0
+func (s *DealService) ResolvePortfolio(ctx context.Context, userID, portfolioID int64) (int64, error) {
+	return s.portfolios.ResolvePortfolio(ctx, userID, portfolioID)
+}
+
+// GetUserPortfolio sums the deals of the user by coin, over all portfolios
+// when portfolioID is 0. Transfers between portfolios cancel out in the sum
+// over all of them.
+func (s *DealService) GetUserPortfolio(userID string, portfolioID int64) (map[string]*types.Portfolio, error) {
 	if userID == "" {
-		return nil, errors.New("user ID is required")
+		return nil, ErrUserIDRequired
 	}
 
 	deals, err := s.repo.GetByUserID(userID)
@@ -93,8 +215,11 @@ func (s *DealService) GetUserPortfolio(userID string) (map[string]*types.Portfol
 	portfolio := make(map[string]*types.Portfolio)
 
 	for _, deal := range deals {
+		if portfolioID != 0 && deal.PortfolioId != portfolioID {
+			continue
+		}
+
 		currencyID := deal.CurrencyId
-		cost := deal.Count * deal.Price
 
 		if _, exists := portfolio[currencyID]; !exists {
 			portfolio[currencyID] = &types.Portfolio{
@@ -105,14 +230,7 @@ func (s *DealService) GetUserPortfolio(userID string) (map[string]*types.Portfol
 			}
 		}
 
-		entry := portfolio[currencyID]
-
-		entry.TotalCount += deal.Count
-		entry.TotalCost += cost
-
-		if entry.TotalCount > 0 {
-			entry.AvgPrice = entry.TotalCost / entry.TotalCount
-		}
+		portfolio[currencyID].Add(deal)
 	}
 
 	return portfolio, nil
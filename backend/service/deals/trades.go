@@ -0,0 +1,236 @@
+package deals
+
+import (
+	"bytes"
+	"context"
+	"crypto-tracker/service/deals/importers"
+	"crypto-tracker/types"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// usdStablecoins are quote currencies valued at one USD
+var usdStablecoins = []string{"USD", "USDT", "USDC", "BUSD", "FDUSD", "TUSD", "USDP", "DAI"}
+
+// staleRateDays is how far the day of a stored exchange rate may be from the
+// day of a trade before the trade warns about it
+const staleRateDays = 7
+
+// ImportTrades reads the trade history export of an exchange, see the
+// importers package, and stores the trades as deals like Import, only the
+// DryRun and PortfolioID options apply. Prices are converted to the fiat of
+// the deals at the exchange rates of the day of the trade, or the current
+// ones while none is stored, fees too unless they are paid in the traded coin.
+func (im *Importer) ImportTrades(ctx context.Context, userID int, format string, r io.Reader, opts ImportOptions) (*types.DealImportReport, error) {
+	importer, ok := importers.Get(format)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s, expected csv or one of %s", ErrUnknownImportFormat, format, strings.Join(importers.Names(), ", "))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, MaxImportBytes+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > MaxImportBytes {
+		return nil, fmt.Errorf("%w: at most %d bytes", ErrImportTooLarge, MaxImportBytes)
+	}
+
+	coins, err := im.coinIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	trades, err := importer.Parse(bytes.NewReader(data), func(symbol string) bool {
+		_, ok := coins.bySymbol(symbol)
+		return ok
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCSV, err)
+	}
+
+	if len(trades) == 0 {
+		return nil, fmt.Errorf("%w: no trades found", ErrInvalidCSV)
+	}
+
+	if len(trades) > MaxImportRows {
+		return nil, fmt.Errorf("%w: at most %d rows", ErrImportTooLarge, MaxImportRows)
+	}
+
+	conv := &converter{
+		ctx:   ctx,
+		rates: im.rates,
+		live:  im.coins,
+		coins: coins,
+		cache: make(map[string]dayRate),
+	}
+
+	rows := make([]importRow, 0, len(trades))
+	for _, trade := range trades {
+		row := importRow{line: trade.Line}
+
+		if trade.Err != nil {
+			row.errs = []types.FieldError{{Field: "trade", Rule: "format", Message: trade.Err.Error()}}
+		} else {
+			row.deal, row.warnings, err = tradeDeal(userID, trade.Trade, coins, conv)
+			if err != nil {
+				row.errs = []types.FieldError{{Field: "trade", Rule: "convert", Message: err.Error()}}
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return im.save(ctx, userID, rows, opts)
+}
+
+// tradeDeal converts a trade to a deal in the fiat of the deals
+func tradeDeal(userID int, trade importers.Trade, coins *coinIndex, conv *converter) (*types.Deal, []string, error) {
+	coinID, ok := coins.bySymbol(trade.Base)
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown coin %s", trade.Base)
+	}
+
+	if trade.Amount <= 0 || trade.Price <= 0 {
+		return nil, nil, errors.New("amount and price must be positive")
+	}
+
+	var warnings []string
+
+	price, warning, err := conv.value(trade.Price, trade.Quote, trade.Time)
+	if err != nil {
+		return nil, nil, err
+	}
+	warnings = appendWarning(warnings, warning)
+
+	deal := &types.Deal{
+		UserId:      int64(userID),
+		CurrencyId:  coinID,
+		Count:       trade.Amount,
+		Price:       price,
+		FeeCurrency: types.FeeFiat,
+		CreatedAt:   trade.Time,
+	}
+
+	if trade.Side == importers.SideSell {
+		deal.Count = -trade.Amount
+	}
+
+	// A fee in the traded coin is kept in the coin, any other fee is
+	// converted to the fiat of the deals
+	if trade.Fee != 0 {
+		feeCurrency := trade.FeeCurrency
+		if feeCurrency == "" {
+			feeCurrency = trade.Quote
+		}
+
+		if feeCurrency == trade.Base {
+			deal.Fee = math.Abs(trade.Fee)
+			deal.FeeCurrency = coinID
+		} else {
+			fee, warning, err := conv.value(math.Abs(trade.Fee), feeCurrency, trade.Time)
+			if err != nil {
+				return nil, nil, fmt.Errorf("fee: %w", err)
+			}
+			warnings = appendWarning(warnings, warning)
+			deal.Fee = fee
+		}
+	}
+
+	return deal, warnings, nil
+}
+
+// dayRate is the rate of a currency for 1 USD on a day, ok is false when
+// neither a stored nor a current rate is known
+type dayRate struct {
+	rate    float64
+	ok      bool
+	warning string
+}
+
+// converter values the amounts of the trades in USD, the fiat of the deals,
+// at the stored rates of the day of every trade and at the current rates of
+// live for the currencies without a stored rate. The rates are looked up once
+// per currency and day.
+type converter struct {
+	ctx   context.Context
+	rates RateHistory
+	live  CoinProvider
+	coins *coinIndex
+	cache map[string]dayRate
+}
+
+// rate returns the rate of a fiat currency for 1 USD on the day of t
+func (c *converter) rate(currency string, t time.Time) (dayRate, error) {
+	if currency == "USD" {
+		return dayRate{rate: 1, ok: true}, nil
+	}
+
+	day := t.UTC().Format(time.DateOnly)
+	key := currency + " " + day
+	if cached, ok := c.cache[key]; ok {
+		return cached, nil
+	}
+
+	rate, rateDay, ok, err := c.rates.RateAt(c.ctx, currency, t.UTC())
+	if err != nil {
+		return dayRate{}, err
+	}
+
+	result := dayRate{rate: rate, ok: ok && rate > 0}
+	if result.ok && math.Abs(t.Sub(rateDay).Hours()/24) > staleRateDays {
+		result.warning = fmt.Sprintf("the %s rate of %s is used for %s", currency, rateDay.Format(time.DateOnly), day)
+	}
+
+	// No rate of the currency is stored yet, before the first run of the
+	// rates job for example, so the current one is used
+	if !result.ok {
+		if usd, err := c.live.ToUSD(1, currency); err == nil && usd > 0 {
+			result = dayRate{
+				rate:    1 / usd,
+				ok:      true,
+				warning: fmt.Sprintf("no %s rate is stored for %s, the current rate is used", currency, day),
+			}
+		}
+	}
+
+	c.cache[key] = result
+	return result, nil
+}
+
+// value converts an amount in a stablecoin, a fiat currency or a coin to
+// USD. Coins are converted at their current price, not the one at the time
+// of the trade, so a warning is returned.
+func (c *converter) value(amount float64, currency string, t time.Time) (float64, string, error) {
+	if slices.Contains(usdStablecoins, currency) {
+		return amount, "", nil
+	}
+
+	quote, err := c.rate(currency, t)
+	if err != nil {
+		return 0, "", err
+	}
+	if quote.ok {
+		return amount / quote.rate, quote.warning, nil
+	}
+
+	if coinID, ok := c.coins.bySymbol(currency); ok && c.coins.prices[coinID] > 0 {
+		warning := fmt.Sprintf("%s converted at the current %s price", currency, currency)
+		return amount * c.coins.prices[coinID], warning, nil
+	}
+
+	return 0, "", fmt.Errorf("no %s rate is known", currency)
+}
+
+func appendWarning(warnings []string, warning string) []string {
+	if warning == "" || slices.Contains(warnings, warning) {
+		return warnings
+	}
+
+	return append(warnings, warning)
+}
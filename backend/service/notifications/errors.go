@@ -0,0 +1,16 @@
+package notifications
+
+import (
+	"crypto-tracker/apperr"
+	"net/http"
+)
+
+var (
+	ErrNotificationNotFound  = apperr.New(http.StatusNotFound, "notification_not_found", "notification not found")
+	ErrInvalidNotificationID = apperr.New(http.StatusBadRequest, "invalid_notification_id", "invalid notification id")
+	ErrUnknownEvent          = apperr.New(http.StatusBadRequest, "unknown_event", "unknown notification event")
+	ErrWebhookNotFound       = apperr.New(http.StatusNotFound, "webhook_not_found", "webhook not found")
+	ErrInvalidWebhookURL     = apperr.New(http.StatusBadRequest, "invalid_webhook_url", "invalid webhook url")
+	ErrTooManyWebhooks       = apperr.New(http.StatusConflict, "too_many_webhooks", "too many webhooks")
+	ErrDeadLetterNotFound    = apperr.New(http.StatusNotFound, "dead_letter_not_found", "dead letter not found")
+)
@@ -0,0 +1,212 @@
+package notifications
+
+import (
+	"crypto-tracker/service/auth"
+	"crypto-tracker/types"
+	"crypto-tracker/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// RegisterRoutes expects a /notifications router that requires authentication
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("", h.ListNotifications).Methods("GET")
+	router.HandleFunc("/unread-count", h.UnreadCount).Methods("GET")
+	router.HandleFunc("/read-all", h.MarkAllRead).Methods("POST")
+	router.HandleFunc("/{id:[0-9]+}/read", h.MarkRead).Methods("POST")
+	router.HandleFunc("/preferences", h.GetPreferences).Methods("GET")
+	router.HandleFunc("/preferences", h.UpdatePreferences).Methods("PUT")
+	router.HandleFunc("/webhooks", h.ListWebhooks).Methods("GET")
+	router.HandleFunc("/webhooks", h.CreateWebhook).Methods("POST")
+	router.HandleFunc("/webhooks/{id:[0-9]+}", h.DeleteWebhook).Methods("DELETE")
+}
+
+// RegisterAdminRoutes expects the admin router
+func (h *Handler) RegisterAdminRoutes(router *mux.Router) {
+	router.HandleFunc("/webhooks/dead-letters", h.ListDeadLetters).Methods("GET")
+	router.HandleFunc("/webhooks/dead-letters/{id:[0-9]+}/retry", h.RetryDeadLetter).Methods("POST")
+}
+
+func pathID(r *http.Request, invalid error) (int64, error) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return 0, invalid
+	}
+
+	return id, nil
+}
+
+func (h *Handler) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	query := r.URL.Query()
+	unreadOnly := query.Get("unread") == "true"
+
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil {
+		limit = 0
+	}
+
+	notifications, err := h.service.List(r.Context(), userID, unreadOnly, limit)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, notifications)
+}
+
+func (h *Handler) UnreadCount(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	count, err := h.service.UnreadCount(r.Context(), userID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]int{"unread": count})
+}
+
+func (h *Handler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := pathID(r, ErrInvalidNotificationID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	if err := h.service.MarkRead(r.Context(), userID, id); err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+func (h *Handler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	count, err := h.service.MarkAllRead(r.Context(), userID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]int64{"marked": count})
+}
+
+func (h *Handler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	preferences, err := h.service.Preferences(r.Context(), userID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, preferences)
+}
+
+func (h *Handler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	var payload []types.NotificationPreference
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	preferences, err := h.service.SavePreferences(r.Context(), userID, payload)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, preferences)
+}
+
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	webhooks, err := h.service.Webhooks(r.Context(), userID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, webhooks)
+}
+
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	var payload types.WebhookPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	webhook, err := h.service.CreateWebhook(r.Context(), userID, payload)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, webhook)
+}
+
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := pathID(r, ErrWebhookNotFound)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	if err := h.service.DeleteWebhook(r.Context(), userID, id); err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+func (h *Handler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	letters, err := h.service.DeadLetters(r.Context())
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, letters)
+}
+
+func (h *Handler) RetryDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r, ErrDeadLetterNotFound)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	if err := h.service.RetryDeadLetter(r.Context(), id); err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
@@ -0,0 +1,161 @@
+package notifications
+
+import (
+	"context"
+	"crypto-tracker/config"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends plain text emails
+type Mailer interface {
+	Send(ctx context.Context, m Mail) error
+}
+
+func NewMailer(cfg *config.Config) Mailer {
+	if cfg.MailDriver == "smtp" {
+		return &SMTPMailer{
+			addr:     net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
+			host:     cfg.SMTPHost,
+			username: cfg.SMTPUsername,
+			password: cfg.SMTPPassword,
+			from:     cfg.MailFrom,
+		}
+	}
+
+	return LogMailer{}
+}
+
+// LogMailer only logs the emails, for development. The body is left out, it
+// may contain personal data.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, m Mail) error {
+	slog.InfoContext(ctx, "Email not sent, MAIL_DRIVER is log", "to", m.To, "subject", m.Subject)
+	return nil
+}
+
+type SMTPMailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+func (s *SMTPMailer) Send(ctx context.Context, m Mail) error {
+	from, err := mail.ParseAddress(s.from)
+	if err != nil {
+		return fmt.Errorf("invalid MAIL_FROM: %w", err)
+	}
+
+	to, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient: %w", err)
+	}
+
+	var msg strings.Builder
+	msg.WriteString("From: " + from.String() + "\r\n")
+	msg.WriteString("To: " + to.String() + "\r\n")
+	msg.WriteString("Subject: " + encodeHeader(m.Subject) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("error connecting to the SMTP server: %w", err)
+	}
+	defer conn.Close()
+
+	// The SMTP client takes no context, the deadline and the cancellation of
+	// ctx apply to the connection instead
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	if err := s.send(conn, from.Address, to.Address, msg.String()); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w: %v", ctx.Err(), err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// send sends the message over conn the way smtp.SendMail does
+func (s *SMTPMailer) send(conn net.Conn, from, to, msg string) error {
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return err
+		}
+	}
+
+	if s.username != "" {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// encodeHeader keeps line breaks out of a header value and encodes it
+func encodeHeader(value string) string {
+	value = strings.NewReplacer("\r", "", "\n", " ").Replace(value)
+
+	return mime.QEncoding.Encode("UTF-8", value)
+}
@@ -0,0 +1,407 @@
+package notifications
+
+import (
+	"context"
+	"crypto-tracker/types"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type Repository struct {
+	DB *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{DB: db}
+}
+
+// delivery is a pending webhook delivery joined with its webhook
+type delivery struct {
+	id        int64
+	webhookID int64
+	userID    int
+	event     string
+	payload   []byte
+	attempts  int
+	url       string
+	secret    string
+}
+
+func (r *Repository) CreateNotification(ctx context.Context, n *types.Notification) error {
+	query := `
+		INSERT INTO notifications (user_id, event, title, body, data, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		RETURNING id, created_at
+	`
+
+	return r.DB.QueryRowContext(ctx, query,
+		n.UserId,
+		n.Event,
+		n.Title,
+		n.Body,
+		nullJSON(n.Data),
+	).Scan(&n.Id, &n.CreatedAt)
+}
+
+// ReserveNotificationID takes an id from the sequence of the notifications
+// for a notification that is not stored, so that it does not collide with
+// the stored ones
+func (r *Repository) ReserveNotificationID(ctx context.Context) (int64, error) {
+	var id int64
+	err := r.DB.QueryRowContext(ctx, `SELECT nextval(pg_get_serial_sequence('notifications', 'id'))`).Scan(&id)
+	return id, err
+}
+
+func (r *Repository) GetNotifications(ctx context.Context, userID int, unreadOnly bool, limit int) ([]*types.Notification, error) {
+	query := `
+		SELECT id, user_id, event, title, body, data, read_at, created_at
+		FROM notifications
+		WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3
+	`
+
+	rows, err := r.DB.QueryContext(ctx, query, userID, unreadOnly, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := make([]*types.Notification, 0)
+	for rows.Next() {
+		var n types.Notification
+		var data []byte
+		var readAt sql.NullTime
+
+		err := rows.Scan(&n.Id, &n.UserId, &n.Event, &n.Title, &n.Body, &data, &readAt, &n.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if data != nil {
+			n.Data = json.RawMessage(data)
+		}
+		if readAt.Valid {
+			n.ReadAt = &readAt.Time
+		}
+
+		notifications = append(notifications, &n)
+	}
+
+	return notifications, rows.Err()
+}
+
+func (r *Repository) CountUnread(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := r.DB.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`,
+		userID).Scan(&count)
+
+	return count, err
+}
+
+func (r *Repository) MarkRead(ctx context.Context, userID int, id int64) error {
+	result, err := r.DB.ExecContext(ctx,
+		`UPDATE notifications SET read_at = COALESCE(read_at, NOW()) WHERE id = $1 AND user_id = $2`,
+		id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotificationNotFound
+	}
+
+	return nil
+}
+
+func (r *Repository) MarkAllRead(ctx context.Context, userID int) (int64, error) {
+	result, err := r.DB.ExecContext(ctx,
+		`UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL`,
+		userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// GetPreferences returns the channels the user chose per event, events
+// without a stored preference are missing from the map
+func (r *Repository) GetPreferences(ctx context.Context, userID int) (map[string][]string, error) {
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT event, channels FROM notification_preferences WHERE user_id = $1`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	preferences := make(map[string][]string)
+	for rows.Next() {
+		var event string
+		var channels []string
+
+		if err := rows.Scan(&event, pq.Array(&channels)); err != nil {
+			return nil, err
+		}
+
+		preferences[event] = channels
+	}
+
+	return preferences, rows.Err()
+}
+
+func (r *Repository) SavePreferences(ctx context.Context, userID int, preferences []types.NotificationPreference) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, p := range preferences {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO notification_preferences (user_id, event, channels, updated_at)
+			VALUES ($1, $2, $3, NOW())
+			ON CONFLICT (user_id, event) DO UPDATE SET channels = EXCLUDED.channels, updated_at = NOW()
+		`, userID, p.Event, pq.Array(p.Channels))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repository) CreateWebhook(ctx context.Context, webhook *types.Webhook) error {
+	query := `
+		INSERT INTO notification_webhooks (user_id, url, secret, created_at)
+		VALUES ($1, $2, $3, NOW())
+		RETURNING id, created_at
+	`
+
+	return r.DB.QueryRowContext(ctx, query, webhook.UserId, webhook.URL, webhook.Secret).
+		Scan(&webhook.Id, &webhook.CreatedAt)
+}
+
+// GetWebhooks returns the webhooks of the user with their secrets
+func (r *Repository) GetWebhooks(ctx context.Context, userID int) ([]*types.Webhook, error) {
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT id, user_id, url, secret, created_at FROM notification_webhooks WHERE user_id = $1 ORDER BY id`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := make([]*types.Webhook, 0)
+	for rows.Next() {
+		var webhook types.Webhook
+
+		if err := rows.Scan(&webhook.Id, &webhook.UserId, &webhook.URL, &webhook.Secret, &webhook.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		webhooks = append(webhooks, &webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+func (r *Repository) DeleteWebhook(ctx context.Context, userID int, id int64) error {
+	result, err := r.DB.ExecContext(ctx,
+		`DELETE FROM notification_webhooks WHERE id = $1 AND user_id = $2`,
+		id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+func (r *Repository) EnqueueDelivery(ctx context.Context, webhookID int64, userID int, event string, payload []byte) error {
+	_, err := r.DB.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, user_id, event, payload, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW())
+	`, webhookID, userID, event, payload)
+
+	return err
+}
+
+// DueDeliveries returns the deliveries whose next attempt is due, oldest first
+func (r *Repository) DueDeliveries(ctx context.Context, limit int) ([]*delivery, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT d.id, d.webhook_id, d.user_id, d.event, d.payload, d.attempts, w.url, w.secret
+		FROM webhook_deliveries d
+		JOIN notification_webhooks w ON w.id = d.webhook_id
+		WHERE d.next_attempt_at <= NOW()
+		ORDER BY d.next_attempt_at, d.id
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*delivery
+	for rows.Next() {
+		var d delivery
+
+		err := rows.Scan(&d.id, &d.webhookID, &d.userID, &d.event, &d.payload, &d.attempts, &d.url, &d.secret)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, &d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (r *Repository) DeleteDelivery(ctx context.Context, id int64) error {
+	_, err := r.DB.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE id = $1`, id)
+
+	return err
+}
+
+func (r *Repository) RetryDelivery(ctx context.Context, id int64, attempts int, lastError string, delay time.Duration) error {
+	_, err := r.DB.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET attempts = $2, last_error = $3, next_attempt_at = NOW() + $4 * INTERVAL '1 second'
+		WHERE id = $1
+	`, id, attempts, lastError, delay.Seconds())
+
+	return err
+}
+
+// DeadLetter moves a delivery that ran out of attempts to the dead letters
+func (r *Repository) DeadLetter(ctx context.Context, d *delivery, attempts int, lastError string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO webhook_dead_letters (webhook_id, user_id, event, payload, attempts, last_error, failed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+	`, d.webhookID, d.userID, d.event, d.payload, attempts, lastError)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE id = $1`, d.id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repository) GetDeadLetters(ctx context.Context, limit int) ([]*types.WebhookDeadLetter, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT id, webhook_id, user_id, event, payload, attempts, last_error, failed_at
+		FROM webhook_dead_letters
+		ORDER BY failed_at DESC, id DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	letters := make([]*types.WebhookDeadLetter, 0)
+	for rows.Next() {
+		var letter types.WebhookDeadLetter
+		var payload []byte
+
+		err := rows.Scan(
+			&letter.Id,
+			&letter.WebhookId,
+			&letter.UserId,
+			&letter.Event,
+			&payload,
+			&letter.Attempts,
+			&letter.LastError,
+			&letter.FailedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		letter.Payload = json.RawMessage(payload)
+		letters = append(letters, &letter)
+	}
+
+	return letters, rows.Err()
+}
+
+// RequeueDeadLetter queues the dead letter for delivery again with fresh
+// attempts. It fails with ErrWebhookNotFound when the webhook was deleted.
+func (r *Repository) RequeueDeadLetter(ctx context.Context, id int64) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var webhookID int64
+	var userID int
+	var event string
+	var payload []byte
+
+	err = tx.QueryRowContext(ctx, `
+		DELETE FROM webhook_dead_letters WHERE id = $1
+		RETURNING webhook_id, user_id, event, payload
+	`, id).Scan(&webhookID, &userID, &event, &payload)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (webhook_id, user_id, event, payload, next_attempt_at, created_at)
+		SELECT id, $2, $3, $4, NOW(), NOW() FROM notification_webhooks WHERE id = $1
+	`, webhookID, userID, event, payload)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrWebhookNotFound
+	}
+
+	return tx.Commit()
+}
+
+func nullJSON(data json.RawMessage) any {
+	if len(data) == 0 {
+		return nil
+	}
+
+	return []byte(data)
+}
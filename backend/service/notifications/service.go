@@ -0,0 +1,349 @@
+package notifications
+
+import (
+	"context"
+	"crypto-tracker/apperr"
+	"crypto-tracker/background"
+	"crypto-tracker/config"
+	"crypto-tracker/metrics"
+	"crypto-tracker/types"
+	"crypto-tracker/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// Channels a notification can be delivered through
+const (
+	ChannelInbox   = "inbox"
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+)
+
+const (
+	defaultLimit     = 50
+	maxLimit         = 200
+	maxWebhooks      = 5
+	deadLettersLimit = 100
+	emailTimeout     = 30 * time.Second
+)
+
+// Events lists the notification events, defaultChannels are used until the
+// user chooses otherwise
+var (
+	Events = []string{types.EventPriceAlert, types.EventPortfolioReport, types.EventSecurityLogin}
+
+	defaultChannels = map[string][]string{
+		types.EventPriceAlert:      {ChannelInbox, ChannelWebhook},
+		types.EventPortfolioReport: {ChannelInbox, ChannelEmail},
+		types.EventSecurityLogin:   {ChannelInbox, ChannelEmail},
+	}
+)
+
+// webhookPayload is the body of a webhook delivery. NotificationId is the id
+// of the notification in the inbox, or a reserved one when the inbox is not a
+// channel of the event, for the receivers to recognize a delivery sent again.
+type webhookPayload struct {
+	Event          string          `json:"event"`
+	Title          string          `json:"title"`
+	Body           string          `json:"body"`
+	Data           json.RawMessage `json:"data,omitempty"`
+	NotificationId int64           `json:"notification_id,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// Service is the Notifier of the application. It stores the in-app inbox,
+// queues the webhook deliveries and sends the emails.
+type Service struct {
+	repo        *Repository
+	users       types.UserStore
+	mailer      Mailer
+	client      *http.Client
+	maxAttempts int
+	requireTLS  bool
+}
+
+func NewService(repo *Repository, users types.UserStore, mailer Mailer, cfg *config.Config) *Service {
+	return &Service{
+		repo:        repo,
+		users:       users,
+		mailer:      mailer,
+		client:      newWebhookClient(cfg.WebhookTimeout, cfg.WebhookAllowPrivate),
+		maxAttempts: cfg.WebhookMaxAttempts,
+		requireTLS:  cfg.IsProduction(),
+	}
+}
+
+// Notify delivers msg through the channels the user chose for the event.
+// Emails are sent in the background, a failure there is only logged.
+func (s *Service) Notify(ctx context.Context, msg types.NotificationMessage) error {
+	channels, err := s.channels(ctx, msg.UserId, msg.Event)
+	if err != nil {
+		return err
+	}
+
+	n := &types.Notification{
+		UserId:    msg.UserId,
+		Event:     msg.Event,
+		Title:     msg.Title,
+		Body:      msg.Body,
+		CreatedAt: time.Now(),
+	}
+
+	if msg.Data != nil {
+		if n.Data, err = json.Marshal(msg.Data); err != nil {
+			return fmt.Errorf("error encoding notification data: %w", err)
+		}
+	}
+
+	// The notification has its id before any channel sends it, whatever
+	// their order. It is stored first for the inbox, the webhooks alone only
+	// reserve an id.
+	var idErr error
+	switch {
+	case slices.Contains(channels, ChannelInbox):
+		idErr = s.repo.CreateNotification(ctx, n)
+	case slices.Contains(channels, ChannelWebhook):
+		n.Id, idErr = s.repo.ReserveNotificationID(ctx)
+	}
+
+	var errs []error
+	for _, channel := range channels {
+		var err error
+
+		switch channel {
+		case ChannelInbox:
+			err = idErr
+		case ChannelWebhook:
+			err = idErr
+			if err == nil {
+				err = s.enqueueWebhooks(ctx, n)
+			}
+		case ChannelEmail:
+			err = s.sendEmail(msg)
+		}
+
+		result := "success"
+		if err != nil {
+			result = "failure"
+			errs = append(errs, fmt.Errorf("error sending %s notification via %s: %w", msg.Event, channel, err))
+		}
+		metrics.Notifications.WithLabelValues(msg.Event, channel, result).Inc()
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Service) channels(ctx context.Context, userID int, event string) ([]string, error) {
+	preferences, err := s.repo.GetPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if channels, ok := preferences[event]; ok {
+		return channels, nil
+	}
+
+	return defaultChannels[event], nil
+}
+
+// enqueueWebhooks queues a delivery per webhook of the user, they are sent by
+// DeliverPending
+func (s *Service) enqueueWebhooks(ctx context.Context, n *types.Notification) error {
+	webhooks, err := s.repo.GetWebhooks(ctx, n.UserId)
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+
+	payload, err := json.Marshal(webhookPayload{
+		Event:          n.Event,
+		Title:          n.Title,
+		Body:           n.Body,
+		Data:           n.Data,
+		NotificationId: n.Id,
+		CreatedAt:      n.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, webhook := range webhooks {
+		errs = append(errs, s.repo.EnqueueDelivery(ctx, webhook.Id, n.UserId, n.Event, payload))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Service) sendEmail(msg types.NotificationMessage) error {
+	user, err := s.users.GetUserById(msg.UserId)
+	if err != nil {
+		return err
+	}
+
+	mail := Mail{
+		To:      user.Email,
+		Subject: msg.Title,
+		Body:    msg.Body,
+	}
+
+	background.Go(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), emailTimeout)
+		defer cancel()
+
+		if err := s.mailer.Send(ctx, mail); err != nil {
+			slog.Error("Error sending email", "user_id", msg.UserId, "event", msg.Event, "error", err)
+		}
+	})
+
+	return nil
+}
+
+func (s *Service) List(ctx context.Context, userID int, unreadOnly bool, limit int) ([]*types.Notification, error) {
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	return s.repo.GetNotifications(ctx, userID, unreadOnly, min(limit, maxLimit))
+}
+
+func (s *Service) UnreadCount(ctx context.Context, userID int) (int, error) {
+	return s.repo.CountUnread(ctx, userID)
+}
+
+func (s *Service) MarkRead(ctx context.Context, userID int, id int64) error {
+	return s.repo.MarkRead(ctx, userID, id)
+}
+
+func (s *Service) MarkAllRead(ctx context.Context, userID int) (int64, error) {
+	return s.repo.MarkAllRead(ctx, userID)
+}
+
+// Preferences returns the channels of every event, the defaults included
+func (s *Service) Preferences(ctx context.Context, userID int) ([]types.NotificationPreference, error) {
+	stored, err := s.repo.GetPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	preferences := make([]types.NotificationPreference, 0, len(Events))
+	for _, event := range Events {
+		channels, ok := stored[event]
+		if !ok {
+			channels = defaultChannels[event]
+		}
+
+		preferences = append(preferences, types.NotificationPreference{
+			Event:    event,
+			Channels: channels,
+		})
+	}
+
+	return preferences, nil
+}
+
+// SavePreferences replaces the channels of the given events, an empty list
+// of channels turns the event off
+func (s *Service) SavePreferences(ctx context.Context, userID int, preferences []types.NotificationPreference) ([]types.NotificationPreference, error) {
+	for i, p := range preferences {
+		if err := utils.Validate.Struct(p); err != nil {
+			return nil, apperr.FromValidator(err)
+		}
+
+		if !slices.Contains(Events, p.Event) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownEvent, p.Event)
+		}
+
+		channels := make([]string, 0, len(p.Channels))
+		for _, channel := range p.Channels {
+			if !slices.Contains(channels, channel) {
+				channels = append(channels, channel)
+			}
+		}
+		preferences[i].Channels = channels
+	}
+
+	if err := s.repo.SavePreferences(ctx, userID, preferences); err != nil {
+		return nil, err
+	}
+
+	return s.Preferences(ctx, userID)
+}
+
+// Webhooks returns the webhooks of the user without their secrets
+func (s *Service) Webhooks(ctx context.Context, userID int) ([]*types.Webhook, error) {
+	webhooks, err := s.repo.GetWebhooks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, webhook := range webhooks {
+		webhook.Secret = ""
+	}
+
+	return webhooks, nil
+}
+
+// CreateWebhook registers a webhook and returns it with its secret, which is
+// not shown again
+func (s *Service) CreateWebhook(ctx context.Context, userID int, payload types.WebhookPayload) (*types.Webhook, error) {
+	if err := utils.Validate.Struct(payload); err != nil {
+		return nil, apperr.FromValidator(err)
+	}
+
+	u, err := url.Parse(payload.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidWebhookURL, payload.URL)
+	}
+
+	if s.requireTLS && u.Scheme != "https" {
+		return nil, fmt.Errorf("%w: https is required", ErrInvalidWebhookURL)
+	}
+
+	if u.User != nil {
+		return nil, fmt.Errorf("%w: credentials in the url are not allowed", ErrInvalidWebhookURL)
+	}
+
+	existing, err := s.repo.GetWebhooks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(existing) >= maxWebhooks {
+		return nil, fmt.Errorf("%w: at most %d webhooks per user", ErrTooManyWebhooks, maxWebhooks)
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	webhook := &types.Webhook{
+		UserId: userID,
+		URL:    u.String(),
+		Secret: secret,
+	}
+
+	if err := s.repo.CreateWebhook(ctx, webhook); err != nil {
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+func (s *Service) DeleteWebhook(ctx context.Context, userID int, id int64) error {
+	return s.repo.DeleteWebhook(ctx, userID, id)
+}
+
+func (s *Service) DeadLetters(ctx context.Context) ([]*types.WebhookDeadLetter, error) {
+	return s.repo.GetDeadLetters(ctx, deadLettersLimit)
+}
+
+func (s *Service) RetryDeadLetter(ctx context.Context, id int64) error {
+	return s.repo.RequeueDeadLetter(ctx, id)
+}
@@ -0,0 +1,198 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto-tracker/metrics"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	deliveryBatch   = 50
+	retryBaseDelay  = 30 * time.Second
+	retryMaxDelay   = 6 * time.Hour
+	maxErrorLength  = 500
+	secretBytes     = 32
+	secretPrefix    = "whsec_"
+	signatureHeader = "X-Webhook-Signature"
+)
+
+// sharedAddressSpace is 100.64.0.0/10, used by carrier-grade NAT
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// Sign returns the signature of a delivery: the hex HMAC-SHA256 of
+// "<timestamp>.<body>" with the secret of the webhook
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, secretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return secretPrefix + hex.EncodeToString(b), nil
+}
+
+// newWebhookClient returns a client that does not follow redirects and,
+// unless allowPrivate, refuses to connect to loopback, private and link-local
+// addresses. The check is done on the resolved address when connecting, so
+// it also holds when a public name resolves to an internal address.
+func newWebhookClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if allowPrivate {
+				return nil
+			}
+
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+
+			if !isPublic(addr) {
+				return fmt.Errorf("webhook address %s is not public", addr)
+			}
+
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	return addr.IsGlobalUnicast() &&
+		!addr.IsPrivate() &&
+		!addr.IsLoopback() &&
+		!addr.IsLinkLocalUnicast() &&
+		!sharedAddressSpace.Contains(addr)
+}
+
+// DeliverPending sends the due webhook deliveries. A failed delivery is
+// retried with an exponential backoff and moved to the dead letters after
+// WEBHOOK_MAX_ATTEMPTS attempts.
+func (s *Service) DeliverPending(ctx context.Context) error {
+	deliveries, err := s.repo.DueDeliveries(ctx, deliveryBatch)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, d := range deliveries {
+		if ctx.Err() != nil {
+			break
+		}
+
+		sendErr := s.deliver(ctx, d)
+		if sendErr == nil {
+			errs = append(errs, s.repo.DeleteDelivery(ctx, d.id))
+			continue
+		}
+
+		attempts := d.attempts + 1
+		lastError := truncate(sendErr.Error(), maxErrorLength)
+
+		if attempts >= s.maxAttempts {
+			slog.Warn("Webhook delivery failed permanently", "delivery_id", d.id, "webhook_id", d.webhookID, "attempts", attempts, "error", sendErr)
+			errs = append(errs, s.repo.DeadLetter(ctx, d, attempts, lastError))
+			continue
+		}
+
+		errs = append(errs, s.repo.RetryDelivery(ctx, d.id, attempts, lastError, backoff(attempts)))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Service) deliver(ctx context.Context, d *delivery) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.ObserveUpstream("webhook", start, err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(d.payload))
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Now().Unix()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "crypto-tracker-webhooks")
+	req.Header.Set("X-Webhook-Event", d.event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(d.id, 10))
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set(signatureHeader, Sign(d.secret, timestamp, d.payload))
+
+	response, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status code %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// backoff is 30s, 1m, 2m, ... up to 6h
+func backoff(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, retryMaxDelay)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	return strings.ToValidUTF8(s[:n], "")
+}
@@ -0,0 +1,243 @@
+package performance
+
+import (
+	"cmp"
+	"context"
+	"crypto-tracker/types"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// basketSize is the number of coins of the top10 benchmark
+const basketSize = 10
+
+type benchmark struct {
+	name string
+	// coin is empty for the market cap weighted basket
+	coin string
+}
+
+var benchmarks = map[string]benchmark{
+	"btc":   {name: "Bitcoin", coin: "bitcoin"},
+	"eth":   {name: "Ethereum", coin: "ethereum"},
+	"top10": {name: "Top 10 by market cap"},
+}
+
+// addBenchmarks compares perf with investing its flows in each benchmark.
+// returns and flows are the ones of the days of the series from replay.
+func (s *Service) addBenchmarks(ctx context.Context, perf *types.Performance, ids []string, returns []dailyReturn, flows []float64, from, to time.Time) error {
+	// days[0] is the day before the series, days[i+1] the day of Series[i]
+	days := []string{from.AddDate(0, 0, -1).Format(time.DateOnly)}
+	for _, point := range perf.Series {
+		days = append(days, point.Date)
+	}
+
+	for _, id := range ids {
+		b := benchmarks[id]
+
+		var daily []float64
+		var err error
+		if b.coin != "" {
+			daily, err = s.coinReturns(ctx, perf, b.coin, days, from, to)
+		} else {
+			daily, err = s.basketReturns(ctx, perf, days, from, to)
+		}
+		if err != nil {
+			return err
+		}
+
+		perf.Benchmarks = append(perf.Benchmarks, compare(perf, id, b.name, daily, returns, flows))
+	}
+
+	return nil
+}
+
+// compare invests the flows of perf in a benchmark with the daily returns
+func compare(perf *types.Performance, id, name string, daily []float64, returns []dailyReturn, flows []float64) types.PerformanceBenchmark {
+	result := types.PerformanceBenchmark{
+		Id:     id,
+		Name:   name,
+		Series: make([]types.BenchmarkPoint, 0, len(perf.Series)),
+	}
+
+	value, index := perf.StartValue, 1.0
+	for i, point := range perf.Series {
+		value = (value + flows[i]) * (1 + daily[i])
+		index *= 1 + daily[i]
+		result.Series = append(result.Series, types.BenchmarkPoint{
+			Date:   point.Date,
+			Value:  round(value),
+			Return: ratio(daily[i]),
+		})
+	}
+
+	result.EndValue = round(value)
+	result.TimeWeightedReturn = ratio(index - 1)
+	result.ExcessReturn = ratio(perf.TimeWeightedReturn - result.TimeWeightedReturn)
+
+	// Beta and alpha compare the days the portfolio held something
+	if len(returns) < 2 {
+		return result
+	}
+
+	paired := make([]dailyReturn, len(returns))
+	for i, r := range returns {
+		paired[i] = dailyReturn{day: r.day, r: daily[r.day]}
+	}
+
+	meanP, meanB := meanReturn(returns), meanReturn(paired)
+	var covariance, variance float64
+	for i := range returns {
+		covariance += (returns[i].r - meanP) * (paired[i].r - meanB)
+		variance += (paired[i].r - meanB) * (paired[i].r - meanB)
+	}
+
+	var beta float64
+	if variance > 0 {
+		beta = covariance / variance
+	}
+
+	result.Beta = ratio(beta)
+	result.Alpha = ratio((meanP - beta*meanB) * 365)
+
+	return result
+}
+
+// coinReturns are the daily returns of holding the coin, 0 until it has a
+// price
+func (s *Service) coinReturns(ctx context.Context, perf *types.Performance, coin string, days []string, from, to time.Time) ([]float64, error) {
+	points, err := s.repo.Prices(ctx, []string{coin}, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	prices := dailyPrices(points, days)[coin]
+	if prices == nil {
+		prices = make([]float64, len(days))
+	}
+	if prices[0] <= 0 {
+		perf.Warnings = append(perf.Warnings, fmt.Sprintf("no price of %s on %s, its benchmark is flat until it has one", coin, days[0]))
+	}
+
+	daily := make([]float64, len(days)-1)
+	for i := 1; i < len(days); i++ {
+		if prices[i-1] > 0 {
+			daily[i-1] = prices[i]/prices[i-1] - 1
+		}
+	}
+
+	return daily, nil
+}
+
+// basketReturns are the daily returns of the top coins by market cap of the
+// day before, weighted by their market cap. A day without recorded market
+// caps uses the current ones.
+func (s *Service) basketReturns(ctx context.Context, perf *types.Performance, days []string, from, to time.Time) ([]float64, error) {
+	tops, err := s.repo.TopByMarketCap(ctx, basketSize, from.AddDate(0, 0, -1), to.AddDate(0, 0, -1))
+	if err != nil {
+		return nil, err
+	}
+
+	baskets := make(map[string]map[string]float64)
+	var coins []string
+	for _, top := range tops {
+		if baskets[top.Date] == nil {
+			baskets[top.Date] = make(map[string]float64, basketSize)
+		}
+		baskets[top.Date][top.CurrencyId] = top.MarketCap
+		if !slices.Contains(coins, top.CurrencyId) {
+			coins = append(coins, top.CurrencyId)
+		}
+	}
+
+	var current map[string]float64
+	if len(baskets) < len(days)-1 {
+		if current, err = s.currentBasket(ctx); err != nil {
+			return nil, err
+		}
+		for coin := range current {
+			if !slices.Contains(coins, coin) {
+				coins = append(coins, coin)
+			}
+		}
+		perf.Warnings = append(perf.Warnings, "the top 10 benchmark uses the current market caps on the days without recorded ones")
+	}
+
+	points, err := s.repo.Prices(ctx, coins, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	prices := dailyPrices(points, days)
+	daily := make([]float64, len(days)-1)
+	for i := 1; i < len(days); i++ {
+		basket, ok := baskets[days[i-1]]
+		if !ok {
+			basket = current
+		}
+
+		// Coins without a price on both days are left out of the day
+		var sum, total float64
+		for coin, weight := range basket {
+			series := prices[coin]
+			if series == nil || series[i-1] <= 0 || series[i] <= 0 {
+				continue
+			}
+
+			sum += weight * (series[i]/series[i-1] - 1)
+			total += weight
+		}
+
+		if total > 0 {
+			daily[i-1] = sum / total
+		}
+	}
+
+	return daily, nil
+}
+
+// currentBasket returns the market caps of the current top coins
+func (s *Service) currentBasket(ctx context.Context) (map[string]float64, error) {
+	data, err := s.prices.GetCurrencyData(ctx, performanceFiat)
+	if err != nil {
+		return nil, fmt.Errorf("error getting market caps: %w", err)
+	}
+
+	data = slices.Clone(data)
+	slices.SortFunc(data, func(a, b types.CurrencyResponse) int {
+		return cmp.Compare(b.MarketCap, a.MarketCap)
+	})
+
+	basket := make(map[string]float64, basketSize)
+	for _, coin := range data[:min(basketSize, len(data))] {
+		if coin.MarketCap > 0 {
+			basket[coin.Id] = float64(coin.MarketCap)
+		}
+	}
+
+	return basket, nil
+}
+
+// dailyPrices carries the last price of every coin on or before each of the
+// days, 0 before its first price. points are oldest first.
+func dailyPrices(points []types.PricePoint, days []string) map[string][]float64 {
+	prices := make(map[string][]float64)
+	last := make(map[string]float64)
+
+	next := 0
+	for i, day := range days {
+		for ; next < len(points) && points[next].Date <= day; next++ {
+			last[points[next].CurrencyId] = points[next].Price
+		}
+
+		for coin, price := range last {
+			if prices[coin] == nil {
+				prices[coin] = make([]float64, len(days))
+			}
+			prices[coin][i] = price
+		}
+	}
+
+	return prices
+}
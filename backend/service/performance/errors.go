@@ -0,0 +1,13 @@
+package performance
+
+import (
+	"crypto-tracker/apperr"
+	"net/http"
+)
+
+var (
+	ErrInvalidPerformanceRange = apperr.New(http.StatusBadRequest, "invalid_performance_range", "invalid performance range")
+	ErrInvalidPortfolioID      = apperr.New(http.StatusBadRequest, "invalid_portfolio_id", "invalid portfolio id")
+	ErrInvalidUserID           = apperr.New(http.StatusBadRequest, "invalid_user_id", "invalid user id")
+	ErrUnknownBenchmark        = apperr.New(http.StatusBadRequest, "unknown_benchmark", "unknown benchmark")
+)
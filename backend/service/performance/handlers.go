@@ -0,0 +1,90 @@
+package performance
+
+import (
+	"crypto-tracker/service/auth"
+	"crypto-tracker/types"
+	"crypto-tracker/utils"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// RegisterRoutes expects a /deals router that requires authentication
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/users/{user_id}/performance", h.GetPerformance).Methods("GET")
+}
+
+// RegisterAdminRoutes expects the admin router
+func (h *Handler) RegisterAdminRoutes(router *mux.Router) {
+	router.HandleFunc("/price-history", h.SavePrices).Methods("PUT")
+}
+
+func (h *Handler) GetPerformance(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["user_id"], 10, 64)
+	if err != nil || userID <= 0 {
+		utils.WriteServiceError(w, ErrInvalidUserID)
+		return
+	}
+
+	// The path names the user for the client, only their own series is served
+	if userID != int64(auth.GetUserIDFromContext(r.Context())) {
+		auth.PermissionDenied(w)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := PerformanceOptions{
+		Range: query.Get("range"),
+		From:  query.Get("from"),
+		To:    query.Get("to"),
+	}
+
+	for _, id := range strings.Split(query.Get("benchmarks"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			opts.Benchmarks = append(opts.Benchmarks, strings.ToLower(id))
+		}
+	}
+
+	if value := query.Get("portfolio_id"); value != "" {
+		opts.PortfolioID, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || opts.PortfolioID <= 0 {
+			utils.WriteServiceError(w, ErrInvalidPortfolioID)
+			return
+		}
+	}
+
+	perf, err := h.service.Performance(r.Context(), userID, opts)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, perf)
+}
+
+func (h *Handler) SavePrices(w http.ResponseWriter, r *http.Request) {
+	var payload types.PriceHistoryPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.service.SavePrices(r.Context(), payload); err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]int{"saved": len(payload.Prices)})
+}
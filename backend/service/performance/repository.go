@@ -0,0 +1,116 @@
+package performance
+
+import (
+	"context"
+	"crypto-tracker/types"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type Repository struct {
+	DB *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{DB: db}
+}
+
+// SavePrices inserts or replaces the prices
+func (r *Repository) SavePrices(ctx context.Context, prices []types.PricePoint) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, price := range prices {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO price_history (currency_id, date, price, market_cap, updated_at)
+			VALUES ($1, $2, $3, NULLIF($4, 0), NOW())
+			ON CONFLICT (currency_id, date) DO UPDATE SET
+				price = EXCLUDED.price,
+				market_cap = COALESCE(EXCLUDED.market_cap, price_history.market_cap),
+				updated_at = NOW()
+		`, price.CurrencyId, price.Date, price.Price, price.MarketCap)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Prices returns the prices of the coins from the last day before from to
+// to, both days included, oldest first
+func (r *Repository) Prices(ctx context.Context, currencyIDs []string, from, to time.Time) ([]types.PricePoint, error) {
+	query := `
+		(SELECT DISTINCT ON (currency_id) currency_id, date, price
+		FROM price_history
+		WHERE currency_id = ANY($1) AND date < $2
+		ORDER BY currency_id, date DESC)
+		UNION ALL
+		(SELECT currency_id, date, price
+		FROM price_history
+		WHERE currency_id = ANY($1) AND date >= $2 AND date <= $3)
+		ORDER BY date, currency_id
+	`
+
+	rows, err := r.DB.QueryContext(ctx, query, pq.Array(currencyIDs), from.Format(time.DateOnly), to.Format(time.DateOnly))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prices []types.PricePoint
+	for rows.Next() {
+		var price types.PricePoint
+		var date time.Time
+		if err := rows.Scan(&price.CurrencyId, &date, &price.Price); err != nil {
+			return nil, err
+		}
+
+		price.Date = date.Format(time.DateOnly)
+		prices = append(prices, price)
+	}
+
+	return prices, rows.Err()
+}
+
+// TopByMarketCap returns the n coins with the largest market cap of every
+// day from from to to, both included, by day then by rank. Days without
+// market caps are missing.
+func (r *Repository) TopByMarketCap(ctx context.Context, n int, from, to time.Time) ([]types.PricePoint, error) {
+	query := `
+		SELECT currency_id, date, price, market_cap
+		FROM (
+			SELECT currency_id, date, price, market_cap,
+				ROW_NUMBER() OVER (PARTITION BY date ORDER BY market_cap DESC, currency_id) AS rank
+			FROM price_history
+			WHERE market_cap IS NOT NULL AND date >= $1 AND date <= $2
+		) ranked
+		WHERE rank <= $3
+		ORDER BY date, rank
+	`
+
+	rows, err := r.DB.QueryContext(ctx, query, from.Format(time.DateOnly), to.Format(time.DateOnly), n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prices []types.PricePoint
+	for rows.Next() {
+		var price types.PricePoint
+		var date time.Time
+		if err := rows.Scan(&price.CurrencyId, &date, &price.Price, &price.MarketCap); err != nil {
+			return nil, err
+		}
+
+		price.Date = date.Format(time.DateOnly)
+		prices = append(prices, price)
+	}
+
+	return prices, rows.Err()
+}
@@ -0,0 +1,269 @@
+package performance
+
+import (
+	"crypto-tracker/types"
+	"fmt"
+	"math"
+	"time"
+)
+
+// valuation prices the holdings day by day, the price of a coin on a day is
+// the last price on or before it. A coin without any yet is valued at the
+// price of its last deal.
+type valuation struct {
+	perf      *types.Performance
+	history   []types.PricePoint
+	next      int
+	current   map[string]types.PricePoint
+	dealPrice map[string]float64
+	warned    map[string]bool
+}
+
+// advance takes the prices up to date in
+func (v *valuation) advance(date string) {
+	for v.next < len(v.history) && v.history[v.next].Date <= date {
+		v.current[v.history[v.next].CurrencyId] = v.history[v.next]
+		v.next++
+	}
+}
+
+func (v *valuation) price(coin, date string) float64 {
+	point, ok := v.current[coin]
+	if !ok {
+		v.warn(coin, fmt.Sprintf("no price of %s on %s, it is valued at the price of its last deal", coin, date))
+		return v.dealPrice[coin]
+	}
+
+	if days(point.Date, date) > stalePriceDays {
+		v.warn(coin, fmt.Sprintf("the price of %s on %s is from %s", coin, date, point.Date))
+	}
+
+	return point.Price
+}
+
+func (v *valuation) value(holdings map[string]float64, date string) float64 {
+	var value float64
+	for coin, count := range holdings {
+		if count > dust {
+			value += count * v.price(coin, date)
+		}
+	}
+
+	return value
+}
+
+// warn adds one warning per coin
+func (v *valuation) warn(coin, message string) {
+	if v.warned[coin] {
+		return
+	}
+
+	v.warned[coin] = true
+	v.perf.Warnings = append(v.perf.Warnings, message)
+}
+
+func days(from, to string) int {
+	a, _ := time.Parse(time.DateOnly, from)
+	b, _ := time.Parse(time.DateOnly, to)
+
+	return int(b.Sub(a).Hours() / 24)
+}
+
+// dailyReturn is the return of the day at index day of the series, on the
+// days the portfolio held something
+type dailyReturn struct {
+	day int
+	r   float64
+}
+
+// replay fills the series and the metrics of perf from the deals, oldest
+// first, and the prices from the last day before from, oldest first. It
+// returns the daily returns and the flows of every day of the series.
+func replay(perf *types.Performance, deals []*types.Deal, prices []types.PricePoint, from, to time.Time) ([]dailyReturn, []float64) {
+	v := &valuation{
+		perf:      perf,
+		history:   prices,
+		current:   make(map[string]types.PricePoint),
+		dealPrice: make(map[string]float64),
+		warned:    make(map[string]bool),
+	}
+	holdings := make(map[string]float64)
+
+	i := 0
+	for ; i < len(deals) && deals[i].CreatedAt.Before(from); i++ {
+		holdings[deals[i].CurrencyId] += deals[i].Quantity()
+		v.dealPrice[deals[i].CurrencyId] = deals[i].Price
+	}
+
+	previous := from.AddDate(0, 0, -1).Format(time.DateOnly)
+	v.advance(previous)
+	prev := v.value(holdings, previous)
+	perf.StartValue = round(prev)
+
+	// The money weighted return treats the start value as invested at day 0,
+	// the flows of a day as invested at its start and the end value as taken
+	// out at the end of the last day
+	flows := []cashFlow{{days: 0, amount: -prev}}
+	var returns []dailyReturn
+	var dayFlows []float64
+	index, peak := 1.0, 1.0
+	peakDate := previous
+
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		date := d.Format(time.DateOnly)
+		v.advance(date)
+
+		var flow float64
+		end := d.AddDate(0, 0, 1)
+		for ; i < len(deals) && deals[i].CreatedAt.Before(end); i++ {
+			deal := deals[i]
+			holdings[deal.CurrencyId] += deal.Quantity()
+			v.dealPrice[deal.CurrencyId] = deal.Price
+
+			// A transfer moves coins and no money, it is valued at the price
+			// of the day so that it adds no gain or loss
+			if deal.TransferId != 0 {
+				flow += deal.Quantity() * v.price(deal.CurrencyId, date)
+			} else {
+				flow += deal.Count*deal.Price + deal.FiatFee()
+			}
+		}
+
+		value := v.value(holdings, date)
+
+		// Flows are taken at the start of the day, or at its end when they
+		// take out more than the portfolio was worth
+		var r float64
+		switch {
+		case prev+flow > dust:
+			r = value/(prev+flow) - 1
+			returns = append(returns, dailyReturn{day: len(perf.Series), r: r})
+		case prev > dust:
+			r = (value-flow)/prev - 1
+			returns = append(returns, dailyReturn{day: len(perf.Series), r: r})
+		}
+
+		index *= 1 + r
+		if index > peak {
+			peak, peakDate = index, date
+		}
+		if drawdown := (peak - index) / peak; drawdown > perf.MaxDrawdown {
+			perf.MaxDrawdown = drawdown
+			perf.DrawdownPeak, perf.DrawdownTrough = peakDate, date
+		}
+
+		flows = append(flows, cashFlow{days: float64(len(perf.Series)), amount: -flow})
+		dayFlows = append(dayFlows, flow)
+		perf.NetFlows += flow
+		perf.Series = append(perf.Series, types.PerformancePoint{
+			Date:    date,
+			Value:   round(value),
+			NetFlow: round(flow),
+			Return:  ratio(r),
+		})
+		prev = value
+	}
+
+	flows = append(flows, cashFlow{days: float64(len(perf.Series)), amount: prev})
+
+	perf.EndValue = round(prev)
+	perf.NetFlows = round(perf.NetFlows)
+	perf.TimeWeightedReturn = ratio(index - 1)
+	perf.MaxDrawdown = ratio(perf.MaxDrawdown)
+	perf.Volatility = ratio(volatility(returns))
+	if rate, ok := irr(flows); ok {
+		rate = ratio(rate)
+		perf.MoneyWeightedReturn = &rate
+	}
+
+	return returns, dayFlows
+}
+
+// volatility is the sample standard deviation of the daily returns,
+// annualized over 365 days as coins trade every day
+func volatility(returns []dailyReturn) float64 {
+	if len(returns) < 2 {
+		return 0
+	}
+
+	mean := meanReturn(returns)
+
+	var variance float64
+	for _, r := range returns {
+		variance += (r.r - mean) * (r.r - mean)
+	}
+	variance /= float64(len(returns) - 1)
+
+	return math.Sqrt(variance * 365)
+}
+
+func meanReturn(returns []dailyReturn) float64 {
+	var sum float64
+	for _, r := range returns {
+		sum += r.r
+	}
+
+	return sum / float64(len(returns))
+}
+
+type cashFlow struct {
+	days   float64
+	amount float64
+}
+
+func npv(flows []cashFlow, rate, period float64) float64 {
+	var sum float64
+	for _, f := range flows {
+		sum += f.amount * math.Pow(1+rate, -f.days/period)
+	}
+
+	return sum
+}
+
+// maxIRR bounds the search of the internal rate of return, a higher rate
+// over a few days is noise
+const maxIRR = 1e6
+
+// irr finds the rate at which the flows are worth 0 by bisection. The rate
+// is annual, or over the whole flows when they span less than a year as a
+// shorter rate is not annualized. ok is false when the flows do not change
+// sign or the rate is out of bounds.
+func irr(flows []cashFlow) (rate float64, ok bool) {
+	var in, out bool
+	for _, f := range flows {
+		in = in || f.amount < -dust
+		out = out || f.amount > dust
+	}
+	if !in || !out {
+		return 0, false
+	}
+
+	period := min(flows[len(flows)-1].days, 365)
+	lo, hi := -0.999999, 1.0
+	for npv(flows, lo, period)*npv(flows, hi, period) > 0 {
+		if hi >= maxIRR {
+			return 0, false
+		}
+		hi *= 10
+	}
+
+	for range 200 {
+		mid := (lo + hi) / 2
+		if npv(flows, lo, period)*npv(flows, mid, period) <= 0 {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+
+	return (lo + hi) / 2, true
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// ratio rounds a return to 6 decimals
+func ratio(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
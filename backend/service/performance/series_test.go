@@ -0,0 +1,255 @@
+package performance
+
+import (
+	"crypto-tracker/types"
+	"math"
+	"testing"
+	"time"
+)
+
+func parseDay(s string) time.Time {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+func pricePoints(coin string, byDate ...any) []types.PricePoint {
+	var points []types.PricePoint
+	for i := 0; i < len(byDate); i += 2 {
+		points = append(points, types.PricePoint{CurrencyId: coin, Date: byDate[i].(string), Price: float64(byDate[i+1].(int))})
+	}
+
+	return points
+}
+
+func TestReplay(t *testing.T) {
+	tests := []struct {
+		name     string
+		deals    []*types.Deal
+		prices   []types.PricePoint
+		from, to string
+
+		start, end, netFlows float64
+		returns              []float64
+		twr                  float64
+		// mwr is NaN when there is no money weighted return
+		mwr          float64
+		drawdown     float64
+		peak, trough string
+		volatility   float64
+		warnings     int
+	}{
+		{
+			// 100 held, 110, a buy of 115 at the start of a day that ends at
+			// 242, then 198: 110/100, 242/225 and 198/242. The flows
+			// -100 at 0, -115 at 1 and 198 at 3 are worth 0 at -9.5537%
+			// over the 3 days.
+			name: "buy during the range",
+			deals: []*types.Deal{
+				{CurrencyId: "btc", Count: 1, Price: 100, FeeCurrency: "usd", CreatedAt: parseDay("2023-12-31")},
+				{CurrencyId: "btc", Count: 1, Price: 115, FeeCurrency: "usd", CreatedAt: parseDay("2024-01-02").Add(10 * time.Hour)},
+			},
+			prices:     pricePoints("btc", "2023-12-31", 100, "2024-01-01", 110, "2024-01-02", 121, "2024-01-03", 99),
+			from:       "2024-01-01",
+			to:         "2024-01-03",
+			start:      100,
+			end:        198,
+			netFlows:   115,
+			returns:    []float64{0.1, 0.075556, -0.181818},
+			twr:        -0.032,
+			mwr:        -0.095537,
+			drawdown:   0.181818,
+			peak:       "2024-01-02",
+			trough:     "2024-01-03",
+			volatility: 2.982868,
+		},
+		{
+			// The sell of 120 takes out more than the 110 held, so it is
+			// taken at the end of the day: 120/110. The empty portfolio has
+			// no return. -100 at 0 and 120 at 1 over 3 days: 1.2^3 - 1.
+			name: "sell out",
+			deals: []*types.Deal{
+				{CurrencyId: "btc", Count: 1, Price: 100, FeeCurrency: "usd", CreatedAt: parseDay("2023-12-31")},
+				{CurrencyId: "btc", Count: -1, Price: 120, FeeCurrency: "usd", CreatedAt: parseDay("2024-01-02")},
+			},
+			prices:     pricePoints("btc", "2023-12-31", 100, "2024-01-01", 110, "2024-01-02", 120, "2024-01-03", 130),
+			from:       "2024-01-01",
+			to:         "2024-01-03",
+			start:      100,
+			end:        0,
+			netFlows:   -120,
+			returns:    []float64{0.1, 0.090909, 0},
+			twr:        0.2,
+			mwr:        0.728,
+			volatility: 0.122811,
+		},
+		{
+			// Held from 100: the index is the price / 100, the deepest fall
+			// is from 120 to 80 even after the recovery to 130
+			name: "drawdown",
+			deals: []*types.Deal{
+				{CurrencyId: "btc", Count: 1, Price: 100, FeeCurrency: "usd", CreatedAt: parseDay("2023-12-31")},
+			},
+			prices: pricePoints("btc", "2023-12-31", 100, "2024-01-01", 120, "2024-01-02", 90,
+				"2024-01-03", 110, "2024-01-04", 80, "2024-01-05", 130),
+			from:       "2024-01-01",
+			to:         "2024-01-05",
+			start:      100,
+			end:        130,
+			returns:    []float64{0.2, -0.25, 0.222222, -0.272727, 0.625},
+			twr:        0.3,
+			mwr:        0.3,
+			drawdown:   0.333333,
+			peak:       "2024-01-01",
+			trough:     "2024-01-04",
+			volatility: 7.160345,
+		},
+		{
+			// A transfer in is valued at the price of the day, not at the
+			// price of its deal, so it adds no return
+			name: "transfer in",
+			deals: []*types.Deal{
+				{CurrencyId: "btc", Count: 1, Price: 50, FeeCurrency: "usd", TransferId: 1, CreatedAt: parseDay("2024-01-01")},
+			},
+			prices:     pricePoints("btc", "2024-01-01", 100, "2024-01-02", 110),
+			from:       "2024-01-01",
+			to:         "2024-01-02",
+			end:        110,
+			netFlows:   100,
+			returns:    []float64{0, 0.1},
+			twr:        0.1,
+			mwr:        0.1,
+			volatility: math.Sqrt(0.005 * 365),
+		},
+		{
+			// Without any price the coin is valued at the price of its deal
+			name: "no price",
+			deals: []*types.Deal{
+				{CurrencyId: "eth", Count: 2, Price: 25, FeeCurrency: "usd", CreatedAt: parseDay("2023-12-31")},
+			},
+			from:     "2024-01-01",
+			to:       "2024-01-02",
+			start:    50,
+			end:      50,
+			returns:  []float64{0, 0},
+			mwr:      0,
+			warnings: 1,
+		},
+		{
+			name:    "nothing held",
+			from:    "2024-01-01",
+			to:      "2024-01-02",
+			returns: []float64{0, 0},
+			mwr:     math.NaN(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			perf := &types.Performance{Warnings: make([]string, 0)}
+			replay(perf, tt.deals, tt.prices, parseDay(tt.from), parseDay(tt.to))
+
+			if perf.StartValue != tt.start || perf.EndValue != tt.end || perf.NetFlows != tt.netFlows {
+				t.Errorf("start, end, flows = %g, %g, %g, want %g, %g, %g",
+					perf.StartValue, perf.EndValue, perf.NetFlows, tt.start, tt.end, tt.netFlows)
+			}
+
+			if len(perf.Series) != len(tt.returns) {
+				t.Fatalf("series = %+v, want %d days", perf.Series, len(tt.returns))
+			}
+			for i, want := range tt.returns {
+				if perf.Series[i].Return != want {
+					t.Errorf("return of %s = %g, want %g", perf.Series[i].Date, perf.Series[i].Return, want)
+				}
+			}
+
+			if perf.TimeWeightedReturn != tt.twr {
+				t.Errorf("time weighted return = %g, want %g", perf.TimeWeightedReturn, tt.twr)
+			}
+
+			switch {
+			case math.IsNaN(tt.mwr) && perf.MoneyWeightedReturn != nil:
+				t.Errorf("money weighted return = %g, want none", *perf.MoneyWeightedReturn)
+			case !math.IsNaN(tt.mwr) && perf.MoneyWeightedReturn == nil:
+				t.Errorf("no money weighted return, want %g", tt.mwr)
+			case !math.IsNaN(tt.mwr) && math.Abs(*perf.MoneyWeightedReturn-tt.mwr) > 1e-6:
+				t.Errorf("money weighted return = %g, want %g", *perf.MoneyWeightedReturn, tt.mwr)
+			}
+
+			if perf.MaxDrawdown != tt.drawdown || perf.DrawdownPeak != tt.peak || perf.DrawdownTrough != tt.trough {
+				t.Errorf("drawdown = %g from %q to %q, want %g from %q to %q",
+					perf.MaxDrawdown, perf.DrawdownPeak, perf.DrawdownTrough, tt.drawdown, tt.peak, tt.trough)
+			}
+
+			if math.Abs(perf.Volatility-tt.volatility) > 1e-5 {
+				t.Errorf("volatility = %g, want %g", perf.Volatility, tt.volatility)
+			}
+
+			if len(perf.Warnings) != tt.warnings {
+				t.Errorf("warnings = %q, want %d", perf.Warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestIRR(t *testing.T) {
+	tests := []struct {
+		name  string
+		flows []cashFlow
+		rate  float64
+		ok    bool
+	}{
+		{"a year", []cashFlow{{0, -100}, {365, 110}}, 0.1, true},
+		{"two years are annualized", []cashFlow{{0, -100}, {730, 121}}, 0.1, true},
+		{"a month is not annualized", []cashFlow{{0, -100}, {30, 105}}, 0.05, true},
+		{"a loss", []cashFlow{{0, -100}, {365, 80}}, -0.2, true},
+		{"two payments", []cashFlow{{0, -100}, {365, -100}, {730, 231}}, 0.1, true},
+		{"only payments in", []cashFlow{{0, -100}, {365, -10}}, 0, false},
+		{"only payments out", []cashFlow{{0, 100}, {365, 10}}, 0, false},
+		{"everything lost", []cashFlow{{0, -100}, {365, 0}}, 0, false},
+		{"out of bounds", []cashFlow{{0, -1}, {1, 1e12}}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, ok := irr(tt.flows)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+
+			if ok && math.Abs(rate-tt.rate) > 1e-9 {
+				t.Errorf("rate = %g, want %g", rate, tt.rate)
+			}
+		})
+	}
+}
+
+func TestVolatility(t *testing.T) {
+	tests := []struct {
+		name    string
+		returns []float64
+		want    float64
+	}{
+		{"no return", nil, 0},
+		{"one return", []float64{0.05}, 0},
+		{"flat", []float64{0.01, 0.01, 0.01}, 0},
+		// mean 0, sample variance 0.0002
+		{"up and down", []float64{0.01, -0.01}, math.Sqrt(0.0002 * 365)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			returns := make([]dailyReturn, len(tt.returns))
+			for i, r := range tt.returns {
+				returns[i] = dailyReturn{day: i, r: r}
+			}
+
+			if got := volatility(returns); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("volatility = %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
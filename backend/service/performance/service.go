@@ -0,0 +1,251 @@
+package performance
+
+import (
+	"context"
+	"crypto-tracker/apperr"
+	"crypto-tracker/types"
+	"crypto-tracker/utils"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	performanceFiat = "usd"
+	defaultRange    = "1y"
+	customRange     = "custom"
+	// dust is the holding below which a coin is considered sold out
+	dust = 1e-12
+	// stalePriceDays is how far the day of a price may be from the day it is
+	// used for before the series warns about it
+	stalePriceDays = 7
+)
+
+// ranges give the first day of a range from its last day
+var ranges = map[string]func(to time.Time) time.Time{
+	"1w":  func(to time.Time) time.Time { return to.AddDate(0, 0, -6) },
+	"1m":  func(to time.Time) time.Time { return to.AddDate(0, 0, 1).AddDate(0, -1, 0) },
+	"3m":  func(to time.Time) time.Time { return to.AddDate(0, 0, 1).AddDate(0, -3, 0) },
+	"6m":  func(to time.Time) time.Time { return to.AddDate(0, 0, 1).AddDate(0, -6, 0) },
+	"1y":  func(to time.Time) time.Time { return to.AddDate(0, 0, 1).AddDate(-1, 0, 0) },
+	"ytd": func(to time.Time) time.Time { return time.Date(to.Year(), time.January, 1, 0, 0, 0, 0, time.UTC) },
+	// all starts on the day of the first deal
+	"all": func(to time.Time) time.Time { return time.Time{} },
+}
+
+type DealStreamer interface {
+	StreamUserDeals(ctx context.Context, userID int64, from, to time.Time, fn func(*types.Deal) error) error
+}
+
+type PortfolioResolver interface {
+	ResolvePortfolio(ctx context.Context, userID, portfolioID int64) (int64, error)
+}
+
+type PriceProvider interface {
+	GetCurrencyData(ctx context.Context, currencyCode string) ([]types.CurrencyResponse, error)
+	CacheAge(currencyCode string) (time.Duration, bool)
+}
+
+type Service struct {
+	repo       *Repository
+	deals      DealStreamer
+	portfolios PortfolioResolver
+	prices     PriceProvider
+}
+
+func NewService(repo *Repository, deals DealStreamer, portfolios PortfolioResolver, prices PriceProvider) *Service {
+	return &Service{
+		repo:       repo,
+		deals:      deals,
+		portfolios: portfolios,
+		prices:     prices,
+	}
+}
+
+// PerformanceOptions choose the days and the portfolio of a performance
+// series. From and To are YYYY-MM-DD and override Range.
+type PerformanceOptions struct {
+	PortfolioID int64
+	Range       string
+	From        string
+	To          string
+	// Benchmarks are ids among btc, eth and top10
+	Benchmarks []string
+}
+
+// Performance replays the deals of the user, in a portfolio or in all of
+// them for 0, and values the holdings at the end of every day of the range
+// with the stored price history. Deals are flows into the portfolio, so are
+// transfers from and to other portfolios at the price of the day.
+func (s *Service) Performance(ctx context.Context, userID int64, opts PerformanceOptions) (*types.Performance, error) {
+	if opts.PortfolioID != 0 {
+		if _, err := s.portfolios.ResolvePortfolio(ctx, userID, opts.PortfolioID); err != nil {
+			return nil, err
+		}
+	}
+
+	name, from, to, err := parseRange(opts, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, id := range opts.Benchmarks {
+		if _, ok := benchmarks[id]; !ok {
+			return nil, fmt.Errorf("%w: %s, expected btc, eth or top10", ErrUnknownBenchmark, id)
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+
+	var deals []*types.Deal
+	err = s.deals.StreamUserDeals(ctx, userID, time.Time{}, to.AddDate(0, 0, 1), func(deal *types.Deal) error {
+		if opts.PortfolioID == 0 && deal.TransferId != 0 {
+			return nil
+		}
+		if opts.PortfolioID != 0 && deal.PortfolioId != opts.PortfolioID {
+			return nil
+		}
+
+		deals = append(deals, deal)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if from.IsZero() {
+		from = to
+		if len(deals) > 0 {
+			from = day(deals[0].CreatedAt)
+		}
+	}
+
+	var coins []string
+	for _, deal := range deals {
+		if !slices.Contains(coins, deal.CurrencyId) {
+			coins = append(coins, deal.CurrencyId)
+		}
+	}
+
+	var prices []types.PricePoint
+	if len(coins) > 0 {
+		if prices, err = s.repo.Prices(ctx, coins, from, to); err != nil {
+			return nil, err
+		}
+	}
+
+	perf := &types.Performance{
+		UserId:      userID,
+		PortfolioId: opts.PortfolioID,
+		Range:       name,
+		Fiat:        performanceFiat,
+		From:        from.Format(time.DateOnly),
+		To:          to.Format(time.DateOnly),
+		Series:      make([]types.PerformancePoint, 0, int(to.Sub(from).Hours()/24)+1),
+		Warnings:    make([]string, 0),
+		GeneratedAt: time.Now(),
+	}
+
+	returns, flows := replay(perf, deals, prices, from, to)
+
+	if err := s.addBenchmarks(ctx, perf, ids, returns, flows, from, to); err != nil {
+		return nil, err
+	}
+	slices.Sort(perf.Warnings)
+
+	return perf, nil
+}
+
+// parseRange returns the first and the last day of the series, the first
+// day is zero for a range starting with the first deal
+func parseRange(opts PerformanceOptions, now time.Time) (name string, from, to time.Time, err error) {
+	name = opts.Range
+	if name == "" {
+		name = defaultRange
+	}
+
+	start, ok := ranges[name]
+	if !ok {
+		return "", from, to, fmt.Errorf("%w: %s, expected one of 1w, 1m, 3m, 6m, ytd, 1y or all", ErrInvalidPerformanceRange, name)
+	}
+
+	to = day(now)
+	if opts.To != "" {
+		if to, err = time.Parse(time.DateOnly, opts.To); err != nil {
+			return "", from, to, fmt.Errorf("%w: to: %s", ErrInvalidPerformanceRange, opts.To)
+		}
+		if to.After(day(now)) {
+			return "", from, to, fmt.Errorf("%w: to is in the future", ErrInvalidPerformanceRange)
+		}
+	}
+
+	from = start(to)
+	if opts.From != "" {
+		name = customRange
+		if from, err = time.Parse(time.DateOnly, opts.From); err != nil {
+			return "", from, to, fmt.Errorf("%w: from: %s", ErrInvalidPerformanceRange, opts.From)
+		}
+		if from.After(to) {
+			return "", from, to, fmt.Errorf("%w: from must not be after to", ErrInvalidPerformanceRange)
+		}
+	}
+
+	return name, from, to, nil
+}
+
+func day(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// RecordPrices stores the current USD prices and market caps as the ones of
+// the day they were fetched on
+func (s *Service) RecordPrices(ctx context.Context) error {
+	age, ok := s.prices.CacheAge(performanceFiat)
+	if !ok {
+		return nil
+	}
+
+	data, err := s.prices.GetCurrencyData(ctx, performanceFiat)
+	if err != nil {
+		return fmt.Errorf("error getting prices: %w", err)
+	}
+
+	date := time.Now().Add(-age).UTC().Format(time.DateOnly)
+	prices := make([]types.PricePoint, 0, len(data))
+	for _, coin := range data {
+		if coin.CurrentPrice <= 0 {
+			continue
+		}
+
+		prices = append(prices, types.PricePoint{
+			CurrencyId: coin.Id,
+			Date:       date,
+			Price:      coin.CurrentPrice,
+			MarketCap:  float64(coin.MarketCap),
+		})
+	}
+
+	if len(prices) == 0 {
+		return nil
+	}
+
+	return s.repo.SavePrices(ctx, prices)
+}
+
+// SavePrices stores prices given by an admin, to fill the history before
+// the prices were recorded
+func (s *Service) SavePrices(ctx context.Context, payload types.PriceHistoryPayload) error {
+	if err := utils.Validate.Struct(payload); err != nil {
+		return apperr.FromValidator(err)
+	}
+
+	for i := range payload.Prices {
+		payload.Prices[i].CurrencyId = strings.ToLower(payload.Prices[i].CurrencyId)
+	}
+
+	return s.repo.SavePrices(ctx, payload.Prices)
+}
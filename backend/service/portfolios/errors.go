@@ -0,0 +1,20 @@
+package portfolios
+
+import (
+	"crypto-tracker/apperr"
+	"net/http"
+)
+
+var (
+	ErrPortfolioNotFound      = apperr.New(http.StatusNotFound, "portfolio_not_found", "portfolio not found")
+	ErrInvalidPortfolioID     = apperr.New(http.StatusBadRequest, "invalid_portfolio_id", "invalid portfolio id")
+	ErrPortfolioNameTaken     = apperr.New(http.StatusConflict, "portfolio_name_taken", "a portfolio with this name already exists")
+	ErrTooManyPortfolios      = apperr.New(http.StatusConflict, "too_many_portfolios", "too many portfolios")
+	ErrDefaultPortfolio       = apperr.New(http.StatusConflict, "default_portfolio", "the default portfolio cannot be deleted")
+	ErrPortfolioNotEmpty      = apperr.New(http.StatusConflict, "portfolio_not_empty", "the portfolio still has deals")
+	ErrTransferNotFound       = apperr.New(http.StatusNotFound, "transfer_not_found", "transfer not found")
+	ErrInvalidTransferID      = apperr.New(http.StatusBadRequest, "invalid_transfer_id", "invalid transfer id")
+	ErrInsufficientHoldings   = apperr.New(http.StatusConflict, "insufficient_holdings", "not enough coins in the portfolio")
+	ErrNoTargets              = apperr.New(http.StatusConflict, "no_portfolio_targets", "the portfolio has no target allocation")
+	ErrInvalidRebalanceOption = apperr.New(http.StatusBadRequest, "invalid_rebalance_option", "invalid rebalance option")
+)
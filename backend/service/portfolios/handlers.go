@@ -0,0 +1,283 @@
+package portfolios
+
+import (
+	"crypto-tracker/service/auth"
+	"crypto-tracker/types"
+	"crypto-tracker/utils"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// RegisterRoutes expects a /portfolios router that requires authentication
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("", h.ListPortfolios).Methods("GET")
+	router.HandleFunc("", h.CreatePortfolio).Methods("POST")
+	router.HandleFunc("/holdings", h.GetAllHoldings).Methods("GET")
+	router.HandleFunc("/transfers", h.ListTransfers).Methods("GET")
+	router.HandleFunc("/transfers", h.CreateTransfer).Methods("POST")
+	router.HandleFunc("/transfers/{id:[0-9]+}", h.DeleteTransfer).Methods("DELETE")
+	router.HandleFunc("/{id:[0-9]+}", h.GetPortfolio).Methods("GET")
+	router.HandleFunc("/{id:[0-9]+}", h.RenamePortfolio).Methods("PUT")
+	router.HandleFunc("/{id:[0-9]+}", h.DeletePortfolio).Methods("DELETE")
+	router.HandleFunc("/{id:[0-9]+}/targets", h.GetTargets).Methods("GET")
+	router.HandleFunc("/{id:[0-9]+}/targets", h.SetTargets).Methods("PUT")
+	router.HandleFunc("/{id:[0-9]+}/rebalance", h.GetRebalancePlan).Methods("GET")
+}
+
+func pathID(r *http.Request, invalid error) (int64, error) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return 0, invalid
+	}
+
+	return id, nil
+}
+
+func (h *Handler) ListPortfolios(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	portfolios, err := h.service.List(r.Context(), userID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, portfolios)
+}
+
+func (h *Handler) CreatePortfolio(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	var payload types.UserPortfolioPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	portfolio, err := h.service.Create(r.Context(), userID, payload)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, portfolio)
+}
+
+// GetAllHoldings returns the holdings of the user over all the portfolios
+func (h *Handler) GetAllHoldings(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	holdings, err := h.service.Holdings(userID, 0)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, holdings)
+}
+
+// GetPortfolio returns the portfolio with its holdings
+func (h *Handler) GetPortfolio(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := pathID(r, ErrInvalidPortfolioID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	view, err := h.service.Get(r.Context(), userID, id)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, view)
+}
+
+func (h *Handler) RenamePortfolio(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := pathID(r, ErrInvalidPortfolioID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	var payload types.UserPortfolioPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	portfolio, err := h.service.Rename(r.Context(), userID, id, payload)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, portfolio)
+}
+
+func (h *Handler) DeletePortfolio(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := pathID(r, ErrInvalidPortfolioID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), userID, id); err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+func (h *Handler) ListTransfers(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	transfers, err := h.service.Transfers(r.Context(), userID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, transfers)
+}
+
+func (h *Handler) CreateTransfer(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	var payload types.PortfolioTransferPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	transfer, err := h.service.Transfer(r.Context(), userID, payload)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, transfer)
+}
+
+func (h *Handler) DeleteTransfer(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := pathID(r, ErrInvalidTransferID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	if err := h.service.DeleteTransfer(r.Context(), userID, id); err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+func (h *Handler) GetTargets(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := pathID(r, ErrInvalidPortfolioID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	targets, err := h.service.Targets(r.Context(), userID, id)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, targets)
+}
+
+func (h *Handler) SetTargets(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := pathID(r, ErrInvalidPortfolioID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	var payload types.PortfolioTargetsPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	targets, err := h.service.SetTargets(r.Context(), userID, id, payload)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, targets)
+}
+
+// GetRebalancePlan returns the trades that bring the portfolio back to its
+// targets, as draft deals too with drafts=true
+func (h *Handler) GetRebalancePlan(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := pathID(r, ErrInvalidPortfolioID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	var opts RebalanceOptions
+
+	for name, option := range map[string]**float64{"drift": &opts.DriftThreshold, "min_trade": &opts.MinTrade} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			utils.WriteServiceError(w, fmt.Errorf("%w: %s: %s", ErrInvalidRebalanceOption, name, value))
+			return
+		}
+		*option = &number
+	}
+
+	if value := query.Get("drafts"); value != "" {
+		if opts.Drafts, err = strconv.ParseBool(value); err != nil {
+			utils.WriteServiceError(w, fmt.Errorf("%w: drafts: %s", ErrInvalidRebalanceOption, value))
+			return
+		}
+	}
+
+	plan, err := h.service.Rebalance(r.Context(), userID, id, opts)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, plan)
+}
@@ -0,0 +1,303 @@
+package portfolios
+
+import (
+	"context"
+	"crypto-tracker/apperr"
+	"crypto-tracker/service/currency"
+	"crypto-tracker/types"
+	"crypto-tracker/utils"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	rebalanceFiat = "usd"
+	// weightTolerance absorbs the rounding of the weights, stored with 4
+	// decimals
+	weightTolerance       = 0.01
+	defaultDriftThreshold = 5
+	defaultMinTrade       = 10
+	maxMinTrade           = 1e9
+)
+
+type PriceProvider interface {
+	GetCurrencyData(ctx context.Context, currencyCode string) ([]types.CurrencyResponse, error)
+}
+
+// RebalanceOptions choose when and how much to trade, nil values take the
+// defaults and 0 is a valid choice for both
+type RebalanceOptions struct {
+	// DriftThreshold is in percentage points
+	DriftThreshold *float64
+	// MinTrade is the smallest trade value in USD
+	MinTrade *float64
+	Drafts   bool
+}
+
+func (s *Service) Targets(ctx context.Context, userID int, id int64) ([]types.PortfolioTarget, error) {
+	if _, err := s.repo.GetByID(ctx, userID, id); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetTargets(ctx, id)
+}
+
+// SetTargets replaces the targets of the portfolio
+func (s *Service) SetTargets(ctx context.Context, userID int, id int64, payload types.PortfolioTargetsPayload) ([]types.PortfolioTarget, error) {
+	if err := utils.Validate.Struct(payload); err != nil {
+		return nil, apperr.FromValidator(err)
+	}
+
+	if _, err := s.repo.GetByID(ctx, userID, id); err != nil {
+		return nil, err
+	}
+
+	var sum float64
+	var coins []string
+	for i := range payload.Targets {
+		target := &payload.Targets[i]
+		target.CurrencyId = strings.ToLower(strings.TrimSpace(target.CurrencyId))
+		target.Weight = math.Round(target.Weight*1e4) / 1e4
+
+		if slices.Contains(coins, target.CurrencyId) {
+			return nil, apperr.Validation(types.FieldError{
+				Field:   "targets",
+				Rule:    "unique",
+				Message: fmt.Sprintf("%s has more than one target", target.CurrencyId),
+			})
+		}
+
+		coins = append(coins, target.CurrencyId)
+		sum += target.Weight
+	}
+
+	if len(payload.Targets) > 0 && math.Abs(sum-100) > weightTolerance {
+		return nil, apperr.Validation(types.FieldError{
+			Field:   "targets",
+			Rule:    "sum",
+			Message: fmt.Sprintf("the weights must add up to 100, not %g", sum),
+		})
+	}
+
+	if err := s.knownCoins(ctx, coins); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.ReplaceTargets(ctx, id, payload.Targets); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetTargets(ctx, id)
+}
+
+// knownCoins checks that the price provider knows the coins
+func (s *Service) knownCoins(ctx context.Context, coins []string) error {
+	if len(coins) == 0 {
+		return nil
+	}
+
+	data, err := s.prices.GetCurrencyData(ctx, rebalanceFiat)
+	if err != nil {
+		return fmt.Errorf("error getting prices: %w", err)
+	}
+
+	known := make(map[string]bool, len(data))
+	for _, coin := range data {
+		known[coin.Id] = true
+	}
+
+	for _, coin := range coins {
+		if !known[coin] {
+			return fmt.Errorf("%w: %s", currency.ErrUnknownCoin, coin)
+		}
+	}
+
+	return nil
+}
+
+// Rebalance values the holdings of the portfolio at live prices and
+// compares their weights with the targets. When a coin drifts from its
+// target by the threshold or more, every coin is traded back to its target,
+// coins without a target are sold, and trades under the minimum are left
+// out. Fees are not taken into account.
+func (s *Service) Rebalance(ctx context.Context, userID int, id int64, opts RebalanceOptions) (*types.RebalancePlan, error) {
+	driftThreshold, minTrade := float64(defaultDriftThreshold), float64(defaultMinTrade)
+	if opts.DriftThreshold != nil {
+		driftThreshold = *opts.DriftThreshold
+	}
+	if opts.MinTrade != nil {
+		minTrade = *opts.MinTrade
+	}
+	if !(driftThreshold >= 0 && driftThreshold <= 100) {
+		return nil, fmt.Errorf("%w: drift must be between 0 and 100", ErrInvalidRebalanceOption)
+	}
+	if !(minTrade >= 0 && minTrade <= maxMinTrade) {
+		return nil, fmt.Errorf("%w: min_trade must be between 0 and %g", ErrInvalidRebalanceOption, float64(maxMinTrade))
+	}
+
+	targets, err := s.Targets(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(targets) == 0 {
+		return nil, ErrNoTargets
+	}
+
+	holdings, err := s.Holdings(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.prices.GetCurrencyData(ctx, rebalanceFiat)
+	if err != nil {
+		return nil, fmt.Errorf("error getting prices: %w", err)
+	}
+
+	prices := make(map[string]float64, len(data))
+	for _, coin := range data {
+		prices[coin.Id] = coin.CurrentPrice
+	}
+
+	return newRebalancePlan(userID, id, targets, holdings, prices, driftThreshold, minTrade, opts.Drafts), nil
+}
+
+func newRebalancePlan(userID int, id int64, targets []types.PortfolioTarget, holdings map[string]*types.Portfolio, prices map[string]float64, driftThreshold, minTrade float64, drafts bool) *types.RebalancePlan {
+	plan := &types.RebalancePlan{
+		PortfolioId:    id,
+		Fiat:           rebalanceFiat,
+		DriftThreshold: driftThreshold,
+		MinTrade:       minTrade,
+		Allocations:    make([]types.RebalanceAllocation, 0, len(targets)+len(holdings)),
+		Warnings:       make([]string, 0),
+		GeneratedAt:    time.Now(),
+	}
+
+	// Targets come first, largest first, then the other holdings by coin
+	weights := make(map[string]float64, len(targets))
+	for _, target := range targets {
+		weights[target.CurrencyId] = target.Weight
+		plan.Allocations = append(plan.Allocations, types.RebalanceAllocation{
+			CurrencyId:   target.CurrencyId,
+			TargetWeight: target.Weight,
+		})
+	}
+
+	var others []string
+	for coin, holding := range holdings {
+		if _, ok := weights[coin]; !ok && holding.TotalCount > countTolerance {
+			others = append(others, coin)
+		}
+	}
+	slices.Sort(others)
+	for _, coin := range others {
+		plan.Allocations = append(plan.Allocations, types.RebalanceAllocation{CurrencyId: coin})
+	}
+
+	// A coin without a live price cannot be traded, it is valued at its
+	// average cost and stays as it is. It is still part of the value the
+	// weights and the trades are taken from, so that the trades bring every
+	// other coin to its target weight.
+	for i := range plan.Allocations {
+		a := &plan.Allocations[i]
+		if holding, ok := holdings[a.CurrencyId]; ok && holding.TotalCount > countTolerance {
+			a.Count = holding.TotalCount
+		}
+
+		a.Price = prices[a.CurrencyId]
+		if a.Price > 0 {
+			a.Value = a.Count * a.Price
+		} else {
+			a.Price = 0
+			if a.Count > 0 {
+				a.Value = a.Count * holdings[a.CurrencyId].AvgPrice
+			}
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("no live price of %s, it is not traded", a.CurrencyId))
+		}
+
+		plan.TotalValue += a.Value
+	}
+
+	if plan.TotalValue <= 0 {
+		plan.Warnings = append(plan.Warnings, "the portfolio holds nothing to rebalance, buy coins to fund it first")
+	}
+
+	for i := range plan.Allocations {
+		a := &plan.Allocations[i]
+		if plan.TotalValue > 0 {
+			a.Weight = a.Value / plan.TotalValue * 100
+		}
+		a.Drift = a.Weight - a.TargetWeight
+		plan.MaxDrift = max(plan.MaxDrift, math.Abs(a.Drift))
+	}
+
+	plan.Rebalance = plan.TotalValue > 0 && plan.MaxDrift >= driftThreshold
+
+	var trades int
+	for i := range plan.Allocations {
+		a := &plan.Allocations[i]
+		if plan.Rebalance && a.Price > 0 {
+			trade := a.TargetWeight/100*plan.TotalValue - a.Value
+			if math.Abs(trade) >= minTrade {
+				// A sell never takes more than the holding, all of it for a
+				// coin without a target
+				a.TradeCount = roundCount(trade / a.Price)
+				if a.TargetWeight == 0 || a.TradeCount < -a.Count {
+					a.TradeCount = -a.Count
+				}
+			}
+
+			// A trade rounded to no coin at all is left out
+			if a.TradeCount != 0 {
+				trades++
+				a.TradeValue = round(a.TradeCount * a.Price)
+
+				a.Side = "buy"
+				if a.TradeCount < 0 {
+					a.Side = "sell"
+				}
+
+				if drafts {
+					plan.Drafts = append(plan.Drafts, types.Deal{
+						UserId:      int64(userID),
+						CurrencyId:  a.CurrencyId,
+						Count:       a.TradeCount,
+						Price:       a.Price,
+						FeeCurrency: types.FeeFiat,
+						PortfolioId: id,
+					})
+				}
+			}
+		}
+
+		a.Value = round(a.Value)
+		a.Weight = ratio(a.Weight)
+		a.Drift = ratio(a.Drift)
+	}
+
+	if plan.Rebalance && trades == 0 {
+		plan.Warnings = append(plan.Warnings, "no trade reaches the minimum trade size")
+	}
+
+	plan.TotalValue = round(plan.TotalValue)
+	plan.MaxDrift = ratio(plan.MaxDrift)
+
+	return plan
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// ratio rounds a weight in percent to 4 decimals
+func ratio(v float64) float64 {
+	return math.Round(v*1e4) / 1e4
+}
+
+// roundCount rounds a count to the 8 decimals the deals are stored with
+func roundCount(v float64) float64 {
+	return math.Round(v*1e8) / 1e8
+}
@@ -0,0 +1,426 @@
+package portfolios
+
+import (
+	"context"
+	"crypto-tracker/types"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+const (
+	portfolioColumns = `id, user_id, name, is_default, created_at, updated_at`
+	transferColumns  = `id, user_id, from_portfolio_id, to_portfolio_id, currency_id, count, cost, created_at`
+
+	// defaultName is the name of the portfolio created for the deals of a
+	// user without a portfolio
+	defaultName = "Main"
+)
+
+// Postgres error codes
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+type Repository struct {
+	DB *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{DB: db}
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPortfolio(row scanner) (*types.UserPortfolio, error) {
+	var portfolio types.UserPortfolio
+
+	err := row.Scan(
+		&portfolio.Id,
+		&portfolio.UserId,
+		&portfolio.Name,
+		&portfolio.IsDefault,
+		&portfolio.CreatedAt,
+		&portfolio.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &portfolio, nil
+}
+
+func scanTransfer(row scanner) (*types.PortfolioTransfer, error) {
+	var transfer types.PortfolioTransfer
+
+	err := row.Scan(
+		&transfer.Id,
+		&transfer.UserId,
+		&transfer.FromPortfolioId,
+		&transfer.ToPortfolioId,
+		&transfer.CurrencyId,
+		&transfer.Count,
+		&transfer.UnitCost,
+		&transfer.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &transfer, nil
+}
+
+func isViolation(err error, code string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && string(pqErr.Code) == code
+}
+
+// nameTaken converts the violation of the unique (user_id, name) constraint
+func nameTaken(err error) error {
+	if isViolation(err, uniqueViolation) {
+		return ErrPortfolioNameTaken
+	}
+
+	return err
+}
+
+// EnsureDefault returns the id of the default portfolio of the user and
+// creates it when missing
+func (r *Repository) EnsureDefault(ctx context.Context, userID int64) (int64, error) {
+	query := `
+		INSERT INTO portfolios (user_id, name, is_default, created_at, updated_at)
+		VALUES ($1, $2, TRUE, NOW(), NOW())
+		ON CONFLICT (user_id) WHERE is_default DO UPDATE SET is_default = TRUE
+		RETURNING id
+	`
+
+	var id int64
+	err := r.DB.QueryRowContext(ctx, query, userID, defaultName).Scan(&id)
+
+	return id, nameTaken(err)
+}
+
+// ResolvePortfolio implements deals.PortfolioResolver
+func (r *Repository) ResolvePortfolio(ctx context.Context, userID, portfolioID int64) (int64, error) {
+	if portfolioID == 0 {
+		return r.EnsureDefault(ctx, userID)
+	}
+
+	if _, err := r.GetByID(ctx, int(userID), portfolioID); err != nil {
+		return 0, err
+	}
+
+	return portfolioID, nil
+}
+
+func (r *Repository) Create(ctx context.Context, portfolio *types.UserPortfolio) error {
+	query := `
+		INSERT INTO portfolios (user_id, name, created_at, updated_at)
+		VALUES ($1, $2, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`
+
+	err := r.DB.QueryRowContext(ctx, query, portfolio.UserId, portfolio.Name).
+		Scan(&portfolio.Id, &portfolio.CreatedAt, &portfolio.UpdatedAt)
+
+	return nameTaken(err)
+}
+
+// GetByID returns the portfolio of the user, ErrPortfolioNotFound when it
+// does not exist or belongs to someone else
+func (r *Repository) GetByID(ctx context.Context, userID int, id int64) (*types.UserPortfolio, error) {
+	query := `SELECT ` + portfolioColumns + ` FROM portfolios WHERE id = $1 AND user_id = $2`
+
+	portfolio, err := scanPortfolio(r.DB.QueryRowContext(ctx, query, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPortfolioNotFound
+	}
+
+	return portfolio, err
+}
+
+// GetByUserID returns the portfolios of the user, the default one first
+func (r *Repository) GetByUserID(ctx context.Context, userID int) ([]*types.UserPortfolio, error) {
+	query := `SELECT ` + portfolioColumns + ` FROM portfolios WHERE user_id = $1 ORDER BY is_default DESC, name`
+
+	rows, err := r.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	portfolios := make([]*types.UserPortfolio, 0)
+	for rows.Next() {
+		portfolio, err := scanPortfolio(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		portfolios = append(portfolios, portfolio)
+	}
+
+	return portfolios, rows.Err()
+}
+
+func (r *Repository) CountByUserID(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := r.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM portfolios WHERE user_id = $1`, userID).Scan(&count)
+
+	return count, err
+}
+
+func (r *Repository) Rename(ctx context.Context, portfolio *types.UserPortfolio) error {
+	query := `
+		UPDATE portfolios SET name = $3, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+		RETURNING updated_at
+	`
+
+	err := r.DB.QueryRowContext(ctx, query, portfolio.Id, portfolio.UserId, portfolio.Name).Scan(&portfolio.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPortfolioNotFound
+	}
+
+	return nameTaken(err)
+}
+
+// Delete removes a portfolio that is not the default one and has no deals
+func (r *Repository) Delete(ctx context.Context, userID int, id int64) error {
+	result, err := r.DB.ExecContext(ctx,
+		`DELETE FROM portfolios WHERE id = $1 AND user_id = $2 AND NOT is_default`,
+		id, userID)
+	if isViolation(err, foreignKeyViolation) {
+		return ErrPortfolioNotEmpty
+	}
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrPortfolioNotFound
+	}
+
+	return nil
+}
+
+// lockHolding locks the portfolio of the user until the end of tx and
+// returns its holding of the coin, so that the transfers out of it run one
+// after the other
+func lockHolding(ctx context.Context, tx *sql.Tx, userID int, portfolioID int64, currencyID string) (*types.Portfolio, error) {
+	var id int64
+	err := tx.QueryRowContext(ctx, `SELECT id FROM portfolios WHERE id = $1 AND user_id = $2 FOR UPDATE`, portfolioID, userID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPortfolioNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT count, price, fee, fee_currency
+		FROM deals
+		WHERE user_id = $1 AND portfolio_id = $2 AND currency_id = $3
+	`, userID, portfolioID, currencyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holding := &types.Portfolio{CurrencyID: currencyID}
+	for rows.Next() {
+		deal := types.Deal{CurrencyId: currencyID}
+		if err := rows.Scan(&deal.Count, &deal.Price, &deal.Fee, &deal.FeeCurrency); err != nil {
+			return nil, err
+		}
+
+		holding.Add(&deal)
+	}
+
+	return holding, rows.Err()
+}
+
+// CreateTransfer stores the transfer with its two deals, one taking the
+// coins out of the source portfolio and one adding them to the target, both
+// at the unit cost of the transfer. check is given the holding of the source
+// portfolio while it is locked, it sets the unit cost or returns why the
+// transfer is not possible.
+func (r *Repository) CreateTransfer(ctx context.Context, transfer *types.PortfolioTransfer, check func(holding *types.Portfolio) error) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	holding, err := lockHolding(ctx, tx, transfer.UserId, transfer.FromPortfolioId, transfer.CurrencyId)
+	if err != nil {
+		return err
+	}
+
+	if err := check(holding); err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO portfolio_transfers (user_id, from_portfolio_id, to_portfolio_id, currency_id, count, cost, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		RETURNING id, created_at
+	`,
+		transfer.UserId,
+		transfer.FromPortfolioId,
+		transfer.ToPortfolioId,
+		transfer.CurrencyId,
+		transfer.Count,
+		transfer.UnitCost,
+	).Scan(&transfer.Id, &transfer.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	legs := []struct {
+		portfolioID int64
+		count       float64
+	}{
+		{transfer.FromPortfolioId, -transfer.Count},
+		{transfer.ToPortfolioId, transfer.Count},
+	}
+
+	for _, leg := range legs {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO deals (user_id, currency_id, count, price, portfolio_id, transfer_id, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		`, transfer.UserId, transfer.CurrencyId, leg.count, transfer.UnitCost, leg.portfolioID, transfer.Id, transfer.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repository) GetTransfer(ctx context.Context, userID int, id int64) (*types.PortfolioTransfer, error) {
+	query := `SELECT ` + transferColumns + ` FROM portfolio_transfers WHERE id = $1 AND user_id = $2`
+
+	transfer, err := scanTransfer(r.DB.QueryRowContext(ctx, query, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTransferNotFound
+	}
+
+	return transfer, err
+}
+
+// GetTransfers returns the transfers of the user, newest first
+func (r *Repository) GetTransfers(ctx context.Context, userID int) ([]*types.PortfolioTransfer, error) {
+	query := `SELECT ` + transferColumns + ` FROM portfolio_transfers WHERE user_id = $1 ORDER BY created_at DESC, id DESC`
+
+	rows, err := r.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transfers := make([]*types.PortfolioTransfer, 0)
+	for rows.Next() {
+		transfer, err := scanTransfer(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		transfers = append(transfers, transfer)
+	}
+
+	return transfers, rows.Err()
+}
+
+// DeleteTransfer removes the transfer, its deals are deleted with it. check
+// is given the holding of the target portfolio while it is locked.
+func (r *Repository) DeleteTransfer(ctx context.Context, transfer *types.PortfolioTransfer, check func(holding *types.Portfolio) error) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	holding, err := lockHolding(ctx, tx, transfer.UserId, transfer.ToPortfolioId, transfer.CurrencyId)
+	if err != nil {
+		return err
+	}
+
+	if err := check(holding); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM portfolio_transfers WHERE id = $1 AND user_id = $2`, transfer.Id, transfer.UserId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrTransferNotFound
+	}
+
+	return tx.Commit()
+}
+
+// GetTargets returns the targets of the portfolio, largest first
+func (r *Repository) GetTargets(ctx context.Context, portfolioID int64) ([]types.PortfolioTarget, error) {
+	rows, err := r.DB.QueryContext(ctx, `
+		SELECT currency_id, weight
+		FROM portfolio_targets
+		WHERE portfolio_id = $1
+		ORDER BY weight DESC, currency_id
+	`, portfolioID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	targets := make([]types.PortfolioTarget, 0)
+	for rows.Next() {
+		var target types.PortfolioTarget
+		if err := rows.Scan(&target.CurrencyId, &target.Weight); err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+
+	return targets, rows.Err()
+}
+
+// ReplaceTargets deletes the targets of the portfolio and inserts targets
+func (r *Repository) ReplaceTargets(ctx context.Context, portfolioID int64, targets []types.PortfolioTarget) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM portfolio_targets WHERE portfolio_id = $1`, portfolioID); err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO portfolio_targets (portfolio_id, currency_id, weight)
+			VALUES ($1, $2, $3)
+		`, portfolioID, target.CurrencyId, target.Weight)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,191 @@
+package portfolios
+
+import (
+	"context"
+	"crypto-tracker/apperr"
+	"crypto-tracker/types"
+	"crypto-tracker/utils"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxPortfolios = 20
+	// countTolerance absorbs the rounding of the counts, stored with 8 decimals
+	countTolerance = 1e-8
+)
+
+// HoldingsProvider sums the deals of a user by coin, over all portfolios
+// for 0
+type HoldingsProvider interface {
+	GetUserPortfolio(userID string, portfolioID int64) (map[string]*types.Portfolio, error)
+}
+
+type Service struct {
+	repo     *Repository
+	holdings HoldingsProvider
+	prices   PriceProvider
+}
+
+func NewService(repo *Repository, holdings HoldingsProvider, prices PriceProvider) *Service {
+	return &Service{
+		repo:     repo,
+		holdings: holdings,
+		prices:   prices,
+	}
+}
+
+// List returns the portfolios of the user, with the default one created
+// when missing
+func (s *Service) List(ctx context.Context, userID int) ([]*types.UserPortfolio, error) {
+	if _, err := s.repo.EnsureDefault(ctx, int64(userID)); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetByUserID(ctx, userID)
+}
+
+// Get returns the portfolio with its holdings
+func (s *Service) Get(ctx context.Context, userID int, id int64) (*types.UserPortfolioView, error) {
+	portfolio, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	holdings, err := s.Holdings(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.UserPortfolioView{UserPortfolio: *portfolio, Holdings: holdings}, nil
+}
+
+// Holdings returns the holdings of the user in a portfolio, or in all of
+// them for 0
+func (s *Service) Holdings(userID int, portfolioID int64) (map[string]*types.Portfolio, error) {
+	return s.holdings.GetUserPortfolio(strconv.Itoa(userID), portfolioID)
+}
+
+func (s *Service) Create(ctx context.Context, userID int, payload types.UserPortfolioPayload) (*types.UserPortfolio, error) {
+	if err := utils.Validate.Struct(payload); err != nil {
+		return nil, apperr.FromValidator(err)
+	}
+
+	// The default portfolio is created first so it keeps its name
+	if _, err := s.repo.EnsureDefault(ctx, int64(userID)); err != nil {
+		return nil, err
+	}
+
+	count, err := s.repo.CountByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if count >= maxPortfolios {
+		return nil, fmt.Errorf("%w: at most %d portfolios per user", ErrTooManyPortfolios, maxPortfolios)
+	}
+
+	portfolio := &types.UserPortfolio{
+		UserId: userID,
+		Name:   strings.TrimSpace(payload.Name),
+	}
+
+	if err := s.repo.Create(ctx, portfolio); err != nil {
+		return nil, err
+	}
+
+	return portfolio, nil
+}
+
+func (s *Service) Rename(ctx context.Context, userID int, id int64, payload types.UserPortfolioPayload) (*types.UserPortfolio, error) {
+	if err := utils.Validate.Struct(payload); err != nil {
+		return nil, apperr.FromValidator(err)
+	}
+
+	portfolio, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	portfolio.Name = strings.TrimSpace(payload.Name)
+	if err := s.repo.Rename(ctx, portfolio); err != nil {
+		return nil, err
+	}
+
+	return portfolio, nil
+}
+
+// Delete removes an empty portfolio, the default one is kept
+func (s *Service) Delete(ctx context.Context, userID int, id int64) error {
+	portfolio, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	if portfolio.IsDefault {
+		return ErrDefaultPortfolio
+	}
+
+	return s.repo.Delete(ctx, userID, id)
+}
+
+func (s *Service) Transfers(ctx context.Context, userID int) ([]*types.PortfolioTransfer, error) {
+	return s.repo.GetTransfers(ctx, userID)
+}
+
+// Transfer moves coins to another portfolio of the user at their average
+// cost in the source portfolio. The holdings and the cost basis over all the
+// portfolios do not change, so it is not a taxable sell.
+func (s *Service) Transfer(ctx context.Context, userID int, payload types.PortfolioTransferPayload) (*types.PortfolioTransfer, error) {
+	if err := utils.Validate.Struct(payload); err != nil {
+		return nil, apperr.FromValidator(err)
+	}
+
+	for _, id := range []int64{payload.FromPortfolioId, payload.ToPortfolioId} {
+		if _, err := s.repo.GetByID(ctx, userID, id); err != nil {
+			return nil, err
+		}
+	}
+
+	transfer := &types.PortfolioTransfer{
+		UserId:          userID,
+		FromPortfolioId: payload.FromPortfolioId,
+		ToPortfolioId:   payload.ToPortfolioId,
+		CurrencyId:      payload.CurrencyId,
+		Count:           payload.Count,
+	}
+
+	err := s.repo.CreateTransfer(ctx, transfer, func(holding *types.Portfolio) error {
+		if holding.TotalCount <= countTolerance || holding.TotalCount < payload.Count-countTolerance {
+			return fmt.Errorf("%w: %g %s held, %g requested",
+				ErrInsufficientHoldings, max(holding.TotalCount, 0), payload.CurrencyId, payload.Count)
+		}
+
+		transfer.UnitCost = max(holding.TotalCost/holding.TotalCount, 0)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transfer, nil
+}
+
+// DeleteTransfer undoes a transfer, as long as the target portfolio still
+// holds the coins
+func (s *Service) DeleteTransfer(ctx context.Context, userID int, id int64) error {
+	transfer, err := s.repo.GetTransfer(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.DeleteTransfer(ctx, transfer, func(holding *types.Portfolio) error {
+		if holding.TotalCount < transfer.Count-countTolerance {
+			return fmt.Errorf("%w: the target portfolio holds %g %s, the transfer added %g",
+				ErrInsufficientHoldings, holding.TotalCount, transfer.CurrencyId, transfer.Count)
+		}
+
+		return nil
+	})
+}
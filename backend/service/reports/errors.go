@@ -0,0 +1,12 @@
+package reports
+
+import (
+	"crypto-tracker/apperr"
+	"net/http"
+)
+
+var (
+	ErrUnknownExportFormat = apperr.New(http.StatusBadRequest, "unknown_export_format", "unknown export format")
+	ErrInvalidExportRange  = apperr.New(http.StatusBadRequest, "invalid_date_range", "invalid date range")
+	ErrInvalidPortfolioID  = apperr.New(http.StatusBadRequest, "invalid_portfolio_id", "invalid portfolio id")
+)
@@ -0,0 +1,183 @@
+package reports
+
+import (
+	"context"
+	"crypto-tracker/types"
+	"fmt"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+var (
+	dealColumns = []string{
+		"id", "date", "portfolio_id", "currency_id", "side", "count", "price", "total", "fee", "fee_currency",
+	}
+
+	portfolioColumns = []string{
+		"currency_id", "count", "avg_price", "cost_basis", "price", "value", "profit_loss", "profit_loss_percent",
+	}
+)
+
+type DealStreamer interface {
+	StreamUserDeals(ctx context.Context, userID int64, from, to time.Time, fn func(*types.Deal) error) error
+}
+
+// ExportRange is the half-open range [From, To) of an export, a zero bound
+// is open. A non zero PortfolioID limits the export to one portfolio.
+type ExportRange struct {
+	From        time.Time
+	To          time.Time
+	PortfolioID int64
+}
+
+// ParseExportRange parses the from and to query values. They are dates,
+// YYYY-MM-DD with to inclusive, or RFC 3339 times.
+func ParseExportRange(from, to string) (ExportRange, error) {
+	var rng ExportRange
+	var err error
+
+	if from != "" {
+		if rng.From, _, err = parseBound(from); err != nil {
+			return rng, fmt.Errorf("%w: from: %s", ErrInvalidExportRange, from)
+		}
+	}
+
+	if to != "" {
+		var date bool
+		if rng.To, date, err = parseBound(to); err != nil {
+			return rng, fmt.Errorf("%w: to: %s", ErrInvalidExportRange, to)
+		}
+
+		if date {
+			rng.To = rng.To.AddDate(0, 0, 1)
+		}
+	}
+
+	if !rng.From.IsZero() && !rng.To.IsZero() && !rng.From.Before(rng.To) {
+		return rng, fmt.Errorf("%w: from must be before to", ErrInvalidExportRange)
+	}
+
+	return rng, nil
+}
+
+func parseBound(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(dateLayout, value); err == nil {
+		return t, true, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	return t.UTC(), false, err
+}
+
+// DealsFileName is the same for the same user, range and format, like
+// deals-user42-2024-01-01-all.csv. A date to is named by its last day.
+func DealsFileName(userID int64, rng ExportRange, format string) string {
+	to := rng.To
+	if !to.IsZero() && to.Equal(to.Truncate(24*time.Hour)) {
+		to = to.AddDate(0, 0, -1)
+	}
+
+	return fmt.Sprintf("deals-user%d%s-%s-%s.%s", userID, portfolioName(rng.PortfolioID), boundName(rng.From), boundName(to), format)
+}
+
+// PortfolioFileName names the snapshot of the user by its UTC date
+func PortfolioFileName(userID, portfolioID int64, at time.Time, format string) string {
+	return fmt.Sprintf("portfolio-user%d%s-%s.%s", userID, portfolioName(portfolioID), at.UTC().Format(dateLayout), format)
+}
+
+func portfolioName(portfolioID int64) string {
+	if portfolioID == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("-portfolio%d", portfolioID)
+}
+
+func boundName(t time.Time) string {
+	if t.IsZero() {
+		return "all"
+	}
+
+	if t.Equal(t.Truncate(24 * time.Hour)) {
+		return t.Format(dateLayout)
+	}
+
+	return t.Format("20060102T150405Z")
+}
+
+// ExportDeals writes the deals of the user in rng, oldest first. The deals
+// are read and written one at a time, the history is never held in memory.
+func (s *Service) ExportDeals(ctx context.Context, userID int64, rng ExportRange, table TableWriter) error {
+	if err := table.WriteHeader(dealColumns...); err != nil {
+		return err
+	}
+
+	err := s.deals.StreamUserDeals(ctx, userID, rng.From, rng.To, func(deal *types.Deal) error {
+		if rng.PortfolioID != 0 && deal.PortfolioId != rng.PortfolioID {
+			return nil
+		}
+
+		return table.WriteRow(
+			deal.Id,
+			deal.CreatedAt,
+			deal.PortfolioId,
+			deal.CurrencyId,
+			dealSide(deal),
+			deal.Count,
+			deal.Price,
+			deal.Count*deal.Price,
+			deal.Fee,
+			deal.FeeCurrency,
+		)
+	})
+	if err != nil {
+		return err
+	}
+
+	return table.Close()
+}
+
+func dealSide(deal *types.Deal) string {
+	switch {
+	case deal.TransferId != 0 && deal.Count < 0:
+		return "transfer_out"
+	case deal.TransferId != 0:
+		return "transfer_in"
+	case deal.Count < 0:
+		return "sell"
+	default:
+		return "buy"
+	}
+}
+
+// ExportPortfolio writes the holdings of report with their cost basis and
+// P&L, followed by a TOTAL row
+func ExportPortfolio(report *types.PortfolioReport, table TableWriter) error {
+	if err := table.WriteHeader(portfolioColumns...); err != nil {
+		return err
+	}
+
+	for _, h := range report.Holdings {
+		err := table.WriteRow(
+			h.CurrencyID,
+			h.Count,
+			h.AvgPrice,
+			h.Cost,
+			h.Price,
+			h.Value,
+			h.ProfitLoss,
+			h.ProfitLossPercent,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := table.WriteRow("TOTAL", "", "", report.Cost, "", report.Value, report.ProfitLoss, report.ProfitLossPercent)
+	if err != nil {
+		return err
+	}
+
+	return table.Close()
+}
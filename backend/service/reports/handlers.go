@@ -0,0 +1,123 @@
+package reports
+
+import (
+	"crypto-tracker/logging"
+	"crypto-tracker/service/auth"
+	"crypto-tracker/utils"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// RegisterRoutes expects a /deals router that requires authentication
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/export", h.ExportDeals).Methods("GET")
+	router.HandleFunc("/portfolio/export", h.ExportPortfolio).Methods("GET")
+}
+
+func exportFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+
+	return "csv"
+}
+
+// parsePortfolioID reads the optional portfolio_id, 0 for all the portfolios
+func parsePortfolioID(r *http.Request) (int64, error) {
+	value := r.URL.Query().Get("portfolio_id")
+	if value == "" {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, ErrInvalidPortfolioID
+	}
+
+	return id, nil
+}
+
+func setAttachment(w http.ResponseWriter, contentType, fileName string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+func (h *Handler) ExportDeals(w http.ResponseWriter, r *http.Request) {
+	userID := int64(auth.GetUserIDFromContext(r.Context()))
+	format := exportFormat(r)
+
+	rng, err := ParseExportRange(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	if rng.PortfolioID, err = parsePortfolioID(r); err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	if err := h.service.CheckPortfolio(r.Context(), userID, rng.PortfolioID); err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	contentType, err := ContentType(format)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	setAttachment(w, contentType, DealsFileName(userID, rng, format))
+	table, _ := NewTableWriter(format, w, "Deals")
+
+	// The status is sent with the first row, an error after it can only
+	// cut the file short
+	if err := h.service.ExportDeals(r.Context(), userID, rng, table); err != nil {
+		logging.FromContext(r.Context()).Error("Error exporting deals", "user_id", userID, "error", err)
+	}
+}
+
+func (h *Handler) ExportPortfolio(w http.ResponseWriter, r *http.Request) {
+	userID := int64(auth.GetUserIDFromContext(r.Context()))
+	format := exportFormat(r)
+
+	contentType, err := ContentType(format)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	portfolioID, err := parsePortfolioID(r)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	report, err := h.service.Snapshot(r.Context(), userID, portfolioID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	setAttachment(w, contentType, PortfolioFileName(userID, portfolioID, report.GeneratedAt, format))
+	table, _ := NewTableWriter(format, w, "Portfolio")
+
+	if err := ExportPortfolio(report, table); err != nil {
+		logging.FromContext(r.Context()).Error("Error exporting portfolio", "user_id", userID, "error", err)
+	}
+}
@@ -0,0 +1,201 @@
+package reports
+
+import (
+	"context"
+	"crypto-tracker/logging"
+	"crypto-tracker/types"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reportFiat is the currency the deals are recorded in
+const reportFiat = "usd"
+
+type PortfolioProvider interface {
+	GetUserIDs() ([]int64, error)
+	GetUserPortfolio(userID string, portfolioID int64) (map[string]*types.Portfolio, error)
+	ResolvePortfolio(ctx context.Context, userID, portfolioID int64) (int64, error)
+}
+
+type PriceProvider interface {
+	GetCurrencyData(ctx context.Context, currencyCode string) ([]types.CurrencyResponse, error)
+}
+
+// Service sends the periodic portfolio report to every user with deals and
+// exports the deals and holdings of a user
+type Service struct {
+	portfolios PortfolioProvider
+	deals      DealStreamer
+	prices     PriceProvider
+	notifier   types.Notifier
+}
+
+func NewService(portfolios PortfolioProvider, deals DealStreamer, prices PriceProvider, notifier types.Notifier) *Service {
+	return &Service{
+		portfolios: portfolios,
+		deals:      deals,
+		prices:     prices,
+		notifier:   notifier,
+	}
+}
+
+// SendPortfolioReports builds and sends the report of every user. A failure
+// for one user is logged and does not stop the others.
+func (s *Service) SendPortfolioReports(ctx context.Context) error {
+	userIDs, err := s.portfolios.GetUserIDs()
+	if err != nil {
+		return err
+	}
+
+	prices, err := s.usdPrices(ctx)
+	if err != nil {
+		return err
+	}
+
+	logger := logging.FromContext(ctx)
+	failed := 0
+
+	for _, userID := range userIDs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		report, err := s.Report(userID, 0, prices)
+		if err != nil {
+			logger.Error("Error building portfolio report", "user_id", userID, "error", err)
+			failed++
+			continue
+		}
+
+		if len(report.Holdings) == 0 {
+			continue
+		}
+
+		if err := s.notifier.Notify(ctx, reportMessage(int(userID), report)); err != nil {
+			logger.Error("Error sending portfolio report", "user_id", userID, "error", err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d portfolio reports failed", failed, len(userIDs))
+	}
+
+	return nil
+}
+
+// Snapshot values the holdings of the user in a portfolio, or in all of them
+// for 0, at the current prices
+func (s *Service) Snapshot(ctx context.Context, userID, portfolioID int64) (*types.PortfolioReport, error) {
+	if err := s.CheckPortfolio(ctx, userID, portfolioID); err != nil {
+		return nil, err
+	}
+
+	prices, err := s.usdPrices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Report(userID, portfolioID, prices)
+}
+
+// CheckPortfolio fails unless portfolioID is 0 or a portfolio of the user
+func (s *Service) CheckPortfolio(ctx context.Context, userID, portfolioID int64) error {
+	if portfolioID == 0 {
+		return nil
+	}
+
+	_, err := s.portfolios.ResolvePortfolio(ctx, userID, portfolioID)
+	return err
+}
+
+func (s *Service) usdPrices(ctx context.Context) (map[string]float64, error) {
+	data, err := s.prices.GetCurrencyData(ctx, reportFiat)
+	if err != nil {
+		return nil, fmt.Errorf("error getting prices: %w", err)
+	}
+
+	prices := make(map[string]float64, len(data))
+	for _, coin := range data {
+		prices[coin.Id] = coin.CurrentPrice
+	}
+
+	return prices, nil
+}
+
+// Report values the holdings of the user in a portfolio, or in all of them
+// for 0, with prices. Coins without a price are valued at their cost.
+func (s *Service) Report(userID, portfolioID int64, prices map[string]float64) (*types.PortfolioReport, error) {
+	portfolio, err := s.portfolios.GetUserPortfolio(strconv.FormatInt(userID, 10), portfolioID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &types.PortfolioReport{
+		Fiat:        reportFiat,
+		Holdings:    make([]types.PortfolioReportHolding, 0, len(portfolio)),
+		GeneratedAt: time.Now(),
+	}
+
+	for _, entry := range portfolio {
+		if entry.TotalCount <= 0 {
+			continue
+		}
+
+		price, ok := prices[entry.CurrencyID]
+		if !ok {
+			price = entry.AvgPrice
+		}
+
+		holding := types.PortfolioReportHolding{
+			CurrencyID: entry.CurrencyID,
+			Count:      entry.TotalCount,
+			AvgPrice:   entry.AvgPrice,
+			Price:      price,
+			Value:      entry.TotalCount * price,
+			Cost:       entry.TotalCost,
+		}
+		holding.ProfitLoss = holding.Value - holding.Cost
+		if holding.Cost > 0 {
+			holding.ProfitLossPercent = holding.ProfitLoss / holding.Cost * 100
+		}
+
+		report.Value += holding.Value
+		report.Cost += holding.Cost
+		report.Holdings = append(report.Holdings, holding)
+	}
+
+	sort.Slice(report.Holdings, func(i, j int) bool {
+		return report.Holdings[i].Value > report.Holdings[j].Value
+	})
+
+	report.ProfitLoss = report.Value - report.Cost
+	if report.Cost > 0 {
+		report.ProfitLossPercent = report.ProfitLoss / report.Cost * 100
+	}
+
+	return report, nil
+}
+
+func reportMessage(userID int, report *types.PortfolioReport) types.NotificationMessage {
+	fiat := strings.ToUpper(report.Fiat)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Your portfolio is worth %.2f %s, %+.2f %s (%+.2f%%) against its cost of %.2f %s.\n\n",
+		report.Value, fiat, report.ProfitLoss, fiat, report.ProfitLossPercent, report.Cost, fiat)
+
+	for _, h := range report.Holdings {
+		fmt.Fprintf(&body, "- %s: %.8g at %.2f = %.2f %s (%+.2f)\n", h.CurrencyID, h.Count, h.Price, h.Value, fiat, h.ProfitLoss)
+	}
+
+	return types.NotificationMessage{
+		UserId: userID,
+		Event:  types.EventPortfolioReport,
+		Title:  fmt.Sprintf("Portfolio report: %.2f %s", report.Value, fiat),
+		Body:   body.String(),
+		Data:   report,
+	}
+}
@@ -0,0 +1,273 @@
+package reports
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TableWriter streams a table row by row in one of the export formats.
+// Values are strings, numbers or times.
+type TableWriter interface {
+	WriteHeader(columns ...string) error
+	WriteRow(values ...any) error
+	// Close finishes the file, it does not close the underlying writer
+	Close() error
+}
+
+type tableFormat struct {
+	contentType string
+	new         func(w io.Writer, sheet string) TableWriter
+}
+
+var tableFormats = map[string]tableFormat{
+	"csv": {
+		contentType: "text/csv; charset=utf-8",
+		new:         newCSVTable,
+	},
+	"json": {
+		contentType: "application/json",
+		new:         newJSONTable,
+	},
+	"xlsx": {
+		contentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		new:         newXLSXTable,
+	},
+}
+
+// ContentType returns the content type of format, csv, json or xlsx
+func ContentType(format string) (string, error) {
+	f, ok := tableFormats[format]
+	if !ok {
+		return "", fmt.Errorf("%w: %s, expected csv, json or xlsx", ErrUnknownExportFormat, format)
+	}
+
+	return f.contentType, nil
+}
+
+// NewTableWriter returns the writer of format. sheet names the worksheet of
+// an xlsx file. The xlsx writer starts writing to w right away, so headers
+// have to be set before.
+func NewTableWriter(format string, w io.Writer, sheet string) (TableWriter, error) {
+	f, ok := tableFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s, expected csv, json or xlsx", ErrUnknownExportFormat, format)
+	}
+
+	return f.new(w, sheet), nil
+}
+
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+type csvTable struct {
+	w *csv.Writer
+}
+
+func newCSVTable(w io.Writer, _ string) TableWriter {
+	return &csvTable{w: csv.NewWriter(w)}
+}
+
+func (t *csvTable) WriteHeader(columns ...string) error {
+	return t.w.Write(columns)
+}
+
+func (t *csvTable) WriteRow(values ...any) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = formatValue(v)
+	}
+
+	return t.w.Write(record)
+}
+
+func (t *csvTable) Close() error {
+	t.w.Flush()
+	return t.w.Error()
+}
+
+// jsonTable writes an array of objects with the columns as keys, in order
+type jsonTable struct {
+	w       *bufio.Writer
+	columns []string
+	rows    int
+}
+
+func newJSONTable(w io.Writer, _ string) TableWriter {
+	return &jsonTable{w: bufio.NewWriter(w)}
+}
+
+func (t *jsonTable) WriteHeader(columns ...string) error {
+	t.columns = columns
+	_, err := t.w.WriteString("[")
+	return err
+}
+
+func (t *jsonTable) WriteRow(values ...any) error {
+	if t.rows > 0 {
+		t.w.WriteString(",")
+	}
+	t.rows++
+
+	t.w.WriteString("\n{")
+	for i, v := range values {
+		if i > 0 {
+			t.w.WriteString(",")
+		}
+
+		key, _ := json.Marshal(t.columns[i])
+		if tm, ok := v.(time.Time); ok {
+			v = formatValue(tm)
+		}
+
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		t.w.Write(key)
+		t.w.WriteString(":")
+		t.w.Write(value)
+	}
+
+	_, err := t.w.WriteString("}")
+	return err
+}
+
+func (t *jsonTable) Close() error {
+	t.w.WriteString("\n]\n")
+	return t.w.Flush()
+}
+
+// xlsxTable writes a workbook with one worksheet. The sheet is written
+// while the rows come, strings are inline so no shared strings table has to
+// be kept in memory.
+type xlsxTable struct {
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	err   error
+}
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+
+	xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+func newXLSXTable(w io.Writer, sheet string) TableWriter {
+	t := &xlsxTable{zip: zip.NewWriter(w)}
+
+	var name strings.Builder
+	xml.EscapeText(&name, []byte(sheet))
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, name.String())},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+
+	for _, part := range parts {
+		f, err := t.zip.Create(part.name)
+		if err != nil {
+			t.err = err
+			return t
+		}
+
+		if _, err := io.WriteString(f, part.content); err != nil {
+			t.err = err
+			return t
+		}
+	}
+
+	f, err := t.zip.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		t.err = err
+		return t
+	}
+
+	t.sheet = bufio.NewWriter(f)
+	_, t.err = t.sheet.WriteString(xlsxSheetStart)
+
+	return t
+}
+
+func (t *xlsxTable) WriteHeader(columns ...string) error {
+	values := make([]any, len(columns))
+	for i, column := range columns {
+		values[i] = column
+	}
+
+	return t.WriteRow(values...)
+}
+
+func (t *xlsxTable) WriteRow(values ...any) error {
+	if t.err != nil {
+		return t.err
+	}
+
+	t.sheet.WriteString("<row>")
+	for _, v := range values {
+		switch v := v.(type) {
+		case float64, int, int64:
+			t.sheet.WriteString("<c><v>" + formatValue(v) + "</v></c>")
+		default:
+			t.sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+			xml.EscapeText(t.sheet, []byte(formatValue(v)))
+			t.sheet.WriteString("</t></is></c>")
+		}
+	}
+	_, t.err = t.sheet.WriteString("</row>")
+
+	return t.err
+}
+
+func (t *xlsxTable) Close() error {
+	if t.err != nil {
+		return t.err
+	}
+
+	if _, err := t.sheet.WriteString(xlsxSheetEnd); err != nil {
+		return err
+	}
+
+	if err := t.sheet.Flush(); err != nil {
+		return err
+	}
+
+	return t.zip.Close()
+}
@@ -0,0 +1,15 @@
+package tax
+
+import (
+	"crypto-tracker/apperr"
+	"net/http"
+)
+
+var (
+	ErrInvalidTaxYear     = apperr.New(http.StatusBadRequest, "invalid_tax_year", "invalid tax year")
+	ErrUnknownCostMethod  = apperr.New(http.StatusBadRequest, "unknown_cost_method", "unknown cost basis method")
+	ErrUnsupportedFiat    = apperr.New(http.StatusBadRequest, "unsupported_currency", "unsupported currency")
+	ErrUnknownTaxFormat   = apperr.New(http.StatusBadRequest, "unknown_report_format", "unknown report format")
+	ErrFXRateUnavailable  = apperr.New(http.StatusUnprocessableEntity, "fx_rate_unavailable", "exchange rate not available")
+	ErrInvalidHoldingTerm = apperr.New(http.StatusBadRequest, "invalid_holding_term", "invalid long term holding period")
+)
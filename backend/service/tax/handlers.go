@@ -0,0 +1,119 @@
+package tax
+
+import (
+	"bytes"
+	"crypto-tracker/service/auth"
+	"crypto-tracker/service/reports"
+	"crypto-tracker/types"
+	"crypto-tracker/utils"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// RegisterRoutes expects a /tax router that requires authentication
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("/report", h.GetReport).Methods("GET")
+}
+
+// RegisterAdminRoutes expects the admin router
+func (h *Handler) RegisterAdminRoutes(router *mux.Router) {
+	router.HandleFunc("/fx-rates", h.SaveRates).Methods("PUT")
+}
+
+func (h *Handler) GetReport(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" && format != "html" {
+		utils.WriteServiceError(w, fmt.Errorf("%w: %s, expected json, csv or html", ErrUnknownTaxFormat, format))
+		return
+	}
+
+	year, err := strconv.Atoi(query.Get("year"))
+	if err != nil {
+		utils.WriteServiceError(w, fmt.Errorf("%w: year is required", ErrInvalidTaxYear))
+		return
+	}
+
+	months := 0
+	if value := query.Get("long_term_months"); value != "" {
+		if months, err = strconv.Atoi(value); err != nil {
+			utils.WriteServiceError(w, fmt.Errorf("%w: %s", ErrInvalidHoldingTerm, value))
+			return
+		}
+	}
+
+	report, err := h.service.Report(r.Context(), userID, ReportOptions{
+		Year:           year,
+		YearStart:      query.Get("year_start"),
+		Method:         query.Get("method"),
+		Fiat:           query.Get("fiat"),
+		LongTermMonths: months,
+	})
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	if format == "json" {
+		utils.WriteJSON(w, http.StatusOK, report)
+		return
+	}
+
+	// The report is small, it is rendered first so an error is still sent
+	// as an error response
+	var body bytes.Buffer
+	contentType := "text/html; charset=utf-8"
+	disposition := "inline"
+
+	if format == "csv" {
+		contentType, _ = reports.ContentType("csv")
+		disposition = "attachment"
+		err = WriteCSV(&body, report)
+	} else {
+		err = WriteHTML(&body, report)
+	}
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": FileName(userID, report, format)}))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	body.WriteTo(w)
+}
+
+func (h *Handler) SaveRates(w http.ResponseWriter, r *http.Request) {
+	var payload types.FXRatesPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.service.SaveRates(r.Context(), payload); err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]int{"saved": len(payload.Rates)})
+}
@@ -0,0 +1,107 @@
+package tax
+
+import (
+	"slices"
+	"time"
+)
+
+// Cost basis methods
+const (
+	MethodFIFO    = "fifo"
+	MethodLIFO    = "lifo"
+	MethodHIFO    = "hifo"
+	MethodAverage = "average"
+)
+
+var Methods = []string{MethodFIFO, MethodLIFO, MethodHIFO, MethodAverage}
+
+// dust is the count below which a lot is considered used up, it absorbs the
+// rounding errors of float arithmetic
+const dust = 1e-12
+
+// lot is what is left of a buy
+type lot struct {
+	acquiredAt time.Time
+	count      float64
+	// unitCost is in USD
+	unitCost float64
+}
+
+// match is the part of a sell taken from one lot
+type match struct {
+	acquiredAt time.Time
+	count      float64
+	cost       float64
+}
+
+// book holds the open lots of one coin
+type book struct {
+	method string
+	lots   []*lot
+}
+
+func (b *book) buy(at time.Time, count, unitCost float64) {
+	b.lots = append(b.lots, &lot{acquiredAt: at, count: count, unitCost: unitCost})
+}
+
+// sell takes count from the lots in the order of the method. It returns the
+// matches and the count that no lot covered.
+func (b *book) sell(count float64) ([]match, float64) {
+	if b.method == MethodAverage {
+		b.average()
+	}
+
+	var matches []match
+	for count > dust && len(b.lots) > 0 {
+		i := b.next()
+		l := b.lots[i]
+
+		taken := min(count, l.count)
+		matches = append(matches, match{acquiredAt: l.acquiredAt, count: taken, cost: taken * l.unitCost})
+
+		l.count -= taken
+		count -= taken
+
+		if l.count <= dust {
+			b.lots = slices.Delete(b.lots, i, i+1)
+		}
+	}
+
+	return matches, max(count, 0)
+}
+
+// next returns the index of the lot the method sells first. The average
+// method sells the oldest lots first for the holding periods.
+func (b *book) next() int {
+	switch b.method {
+	case MethodLIFO:
+		return len(b.lots) - 1
+	case MethodHIFO:
+		highest := 0
+		for i, l := range b.lots {
+			if l.unitCost > b.lots[highest].unitCost {
+				highest = i
+			}
+		}
+		return highest
+	default:
+		return 0
+	}
+}
+
+// average gives every lot the average unit cost of the holdings
+func (b *book) average() {
+	var count, cost float64
+	for _, l := range b.lots {
+		count += l.count
+		cost += l.count * l.unitCost
+	}
+
+	if count <= 0 {
+		return
+	}
+
+	for _, l := range b.lots {
+		l.unitCost = cost / count
+	}
+}
@@ -0,0 +1,223 @@
+package tax
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var (
+	day1 = time.Date(2023, 1, 10, 0, 0, 0, 0, time.UTC)
+	day2 = time.Date(2023, 2, 10, 0, 0, 0, 0, time.UTC)
+	day3 = time.Date(2023, 3, 10, 0, 0, 0, 0, time.UTC)
+)
+
+// newBook holds 1 at 100 of day1, 2 at 200 of day2 and 1 at 150 of day3
+func newBook(method string) *book {
+	b := &book{method: method}
+	b.buy(day1, 1, 100)
+	b.buy(day2, 2, 200)
+	b.buy(day3, 1, 150)
+
+	return b
+}
+
+func TestBookSell(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		count     float64
+		matches   []match
+		uncovered float64
+		// left is what remains of the lots, in their order
+		left []lot
+	}{
+		{
+			name:    "fifo takes the oldest lots and splits the last one",
+			method:  MethodFIFO,
+			count:   2.5,
+			matches: []match{{day1, 1, 100}, {day2, 1.5, 300}},
+			left:    []lot{{day2, 0.5, 200}, {day3, 1, 150}},
+		},
+		{
+			name:    "lifo takes the newest lots",
+			method:  MethodLIFO,
+			count:   2.5,
+			matches: []match{{day3, 1, 150}, {day2, 1.5, 300}},
+			left:    []lot{{day1, 1, 100}, {day2, 0.5, 200}},
+		},
+		{
+			name:    "hifo takes the most expensive lots",
+			method:  MethodHIFO,
+			count:   2.5,
+			matches: []match{{day2, 2, 400}, {day3, 0.5, 75}},
+			left:    []lot{{day1, 1, 100}, {day3, 0.5, 150}},
+		},
+		{
+			name:    "average costs every lot at 650 / 4 and takes the oldest",
+			method:  MethodAverage,
+			count:   2.5,
+			matches: []match{{day1, 1, 162.5}, {day2, 1.5, 243.75}},
+			left:    []lot{{day2, 0.5, 162.5}, {day3, 1, 162.5}},
+		},
+		{
+			name:    "a sell within the first lot leaves the rest of it",
+			method:  MethodFIFO,
+			count:   0.25,
+			matches: []match{{day1, 0.25, 25}},
+			left:    []lot{{day1, 0.75, 100}, {day2, 2, 200}, {day3, 1, 150}},
+		},
+		{
+			name:      "fifo oversell",
+			method:    MethodFIFO,
+			count:     5,
+			matches:   []match{{day1, 1, 100}, {day2, 2, 400}, {day3, 1, 150}},
+			uncovered: 1,
+		},
+		{
+			name:      "lifo oversell",
+			method:    MethodLIFO,
+			count:     5,
+			matches:   []match{{day3, 1, 150}, {day2, 2, 400}, {day1, 1, 100}},
+			uncovered: 1,
+		},
+		{
+			name:      "hifo oversell",
+			method:    MethodHIFO,
+			count:     5,
+			matches:   []match{{day2, 2, 400}, {day3, 1, 150}, {day1, 1, 100}},
+			uncovered: 1,
+		},
+		{
+			name:      "average oversell",
+			method:    MethodAverage,
+			count:     5,
+			matches:   []match{{day1, 1, 162.5}, {day2, 2, 325}, {day3, 1, 162.5}},
+			uncovered: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBook(tt.method)
+
+			matches, uncovered := b.sell(tt.count)
+
+			checkMatches(t, matches, tt.matches)
+			if !near(uncovered, tt.uncovered) {
+				t.Errorf("uncovered = %g, want %g", uncovered, tt.uncovered)
+			}
+			checkLots(t, b.lots, tt.left)
+		})
+	}
+}
+
+func TestBookSellEmpty(t *testing.T) {
+	b := &book{method: MethodFIFO}
+
+	matches, uncovered := b.sell(2)
+	if len(matches) != 0 || uncovered != 2 {
+		t.Errorf("sell from an empty book = %v, %g, want no match and 2 uncovered", matches, uncovered)
+	}
+}
+
+// TestBookAverageReset checks that the average is taken over the lots held
+// at the time of each sell, so that the cost of the coins sold before does
+// not carry over
+func TestBookAverageReset(t *testing.T) {
+	type step struct {
+		at    time.Time
+		buy   float64
+		price float64
+		sell  float64
+		// cost is the cost of the sell
+		cost float64
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "a holding sold out starts over",
+			steps: []step{
+				{at: day1, buy: 1, price: 100},
+				{sell: 1, cost: 100},
+				{at: day2, buy: 1, price: 200},
+				{sell: 1, cost: 200},
+			},
+		},
+		{
+			name: "a buy after a partial sell averages with what is left",
+			steps: []step{
+				{at: day1, buy: 1, price: 100},
+				{at: day2, buy: 1, price: 200},
+				{sell: 1, cost: 150},
+				{at: day3, buy: 1, price: 300},
+				{sell: 2, cost: 450},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &book{method: MethodAverage}
+
+			for i, s := range tt.steps {
+				if s.buy > 0 {
+					b.buy(s.at, s.buy, s.price)
+					continue
+				}
+
+				matches, uncovered := b.sell(s.sell)
+				if uncovered != 0 {
+					t.Fatalf("step %d: uncovered = %g, want 0", i, uncovered)
+				}
+
+				var cost float64
+				for _, m := range matches {
+					cost += m.cost
+				}
+				if !near(cost, s.cost) {
+					t.Errorf("step %d: cost = %g, want %g", i, cost, s.cost)
+				}
+			}
+
+			if len(b.lots) != 0 {
+				t.Errorf("%d lots left, want none", len(b.lots))
+			}
+		})
+	}
+}
+
+func checkMatches(t *testing.T, got, want []match) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("matches = %+v, want %+v", got, want)
+	}
+
+	for i := range want {
+		if !got[i].acquiredAt.Equal(want[i].acquiredAt) || !near(got[i].count, want[i].count) || !near(got[i].cost, want[i].cost) {
+			t.Errorf("match %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func checkLots(t *testing.T, got []*lot, want []lot) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("%d lots left, want %d", len(got), len(want))
+	}
+
+	for i := range want {
+		if !got[i].acquiredAt.Equal(want[i].acquiredAt) || !near(got[i].count, want[i].count) || !near(got[i].unitCost, want[i].unitCost) {
+			t.Errorf("lot %d = %+v, want %+v", i, *got[i], want[i])
+		}
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
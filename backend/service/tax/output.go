@@ -0,0 +1,102 @@
+package tax
+
+import (
+	"crypto-tracker/service/reports"
+	"crypto-tracker/types"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var disposalColumns = []string{
+	"deal_id", "currency_id", "count", "acquired_at", "disposed_at", "term", "proceeds", "cost_basis", "gain",
+}
+
+var methodNames = map[string]string{
+	MethodFIFO:    "first in, first out",
+	MethodLIFO:    "last in, first out",
+	MethodHIFO:    "highest in, first out",
+	MethodAverage: "average cost",
+}
+
+//go:embed report.html
+var reportHTML string
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"date": func(t any) string {
+		switch t := t.(type) {
+		case time.Time:
+			return t.UTC().Format(time.DateOnly)
+		case *time.Time:
+			return t.UTC().Format(time.DateOnly)
+		}
+		return ""
+	},
+	"lastDay": func(t time.Time) time.Time {
+		return t.AddDate(0, 0, -1)
+	},
+	"upper":      strings.ToUpper,
+	"methodName": func(method string) string { return methodNames[method] },
+	"money":      money,
+	"totalsRow": func(label string, totals types.TaxTotals) map[string]any {
+		return map[string]any{"Label": label, "Totals": totals}
+	},
+}).Parse(reportHTML))
+
+// money formats an amount with two decimals and thousands separators
+func money(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 2, 64)
+
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+
+	whole, cents, _ := strings.Cut(s, ".")
+	for i := len(whole) - 3; i > 0; i -= 3 {
+		whole = whole[:i] + "," + whole[i:]
+	}
+
+	return sign + whole + "." + cents
+}
+
+// FileName is the same for the same user, year, method and fiat, like
+// tax-user42-2024-fifo-eur.csv
+func FileName(userID int, report *types.TaxReport, ext string) string {
+	return fmt.Sprintf("tax-user%d-%d-%s-%s.%s", userID, report.Year, report.Method, report.Fiat, ext)
+}
+
+// WriteCSV writes one row per disposal
+func WriteCSV(w io.Writer, report *types.TaxReport) error {
+	table, err := reports.NewTableWriter("csv", w, "")
+	if err != nil {
+		return err
+	}
+
+	if err := table.WriteHeader(disposalColumns...); err != nil {
+		return err
+	}
+
+	for _, d := range report.Disposals {
+		acquiredAt := ""
+		if d.AcquiredAt != nil {
+			acquiredAt = d.AcquiredAt.UTC().Format(time.RFC3339)
+		}
+
+		err := table.WriteRow(d.DealId, d.CurrencyId, d.Count, acquiredAt, d.DisposedAt, d.Term, d.Proceeds, d.CostBasis, d.Gain)
+		if err != nil {
+			return err
+		}
+	}
+
+	return table.Close()
+}
+
+// WriteHTML writes a printable summary with the disposals
+func WriteHTML(w io.Writer, report *types.TaxReport) error {
+	return reportTemplate.Execute(w, report)
+}
@@ -0,0 +1,63 @@
+package tax
+
+import (
+	"context"
+	"crypto-tracker/types"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type Repository struct {
+	DB *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{DB: db}
+}
+
+// SaveRates inserts or replaces the rates
+func (r *Repository) SaveRates(ctx context.Context, rates []types.FXRate) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, rate := range rates {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO fx_rates (currency, date, rate, updated_at)
+			VALUES ($1, $2, $3, NOW())
+			ON CONFLICT (currency, date) DO UPDATE SET rate = EXCLUDED.rate, updated_at = NOW()
+		`, rate.Currency, rate.Date, rate.Rate)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RateAt returns the rate of currency on date or on the closest day before.
+// Without an earlier rate it returns the first rate after date. ok is false
+// when there is no rate of currency at all.
+func (r *Repository) RateAt(ctx context.Context, currency string, date time.Time) (rate float64, day time.Time, ok bool, err error) {
+	queries := []string{
+		`SELECT rate, date FROM fx_rates WHERE currency = $1 AND date <= $2 ORDER BY date DESC LIMIT 1`,
+		`SELECT rate, date FROM fx_rates WHERE currency = $1 AND date > $2 ORDER BY date LIMIT 1`,
+	}
+
+	for _, query := range queries {
+		err = r.DB.QueryRowContext(ctx, query, currency, date.Format(time.DateOnly)).Scan(&rate, &day)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, time.Time{}, false, err
+		}
+
+		return rate, day, true, nil
+	}
+
+	return 0, time.Time{}, false, nil
+}
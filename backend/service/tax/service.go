@@ -0,0 +1,331 @@
+package tax
+
+import (
+	"context"
+	"crypto-tracker/apperr"
+	"crypto-tracker/types"
+	"crypto-tracker/utils"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLongTermMonths = 12
+	maxLongTermMonths     = 120
+	// staleRateDays is how far the day of a rate may be from the day it is
+	// used for before the report warns about it
+	staleRateDays = 7
+)
+
+type DealStreamer interface {
+	StreamUserDeals(ctx context.Context, userID int64, from, to time.Time, fn func(*types.Deal) error) error
+}
+
+type RateProvider interface {
+	GetAllSupportedCurrencies() []string
+	ExchangeRates() (map[string]float64, time.Time)
+}
+
+type Service struct {
+	repo  *Repository
+	deals DealStreamer
+	rates RateProvider
+}
+
+func NewService(repo *Repository, deals DealStreamer, rates RateProvider) *Service {
+	return &Service{
+		repo:  repo,
+		deals: deals,
+		rates: rates,
+	}
+}
+
+// ReportOptions choose the fiscal year and the rules of a tax report
+type ReportOptions struct {
+	Year int
+	// YearStart is the first day of the fiscal year as MM-DD, 01-01 by default
+	YearStart string
+	Method    string
+	Fiat      string
+	// LongTermMonths is the holding period after which a gain is long term
+	LongTermMonths int
+}
+
+// Report computes the gains realized by the user in the fiscal year. The
+// whole deal history before the end of the year is replayed to build the
+// lots, the sells within the year are reported. Proceeds are converted to
+// the fiat at the rate of the day of the sell and costs at the rate of the
+// day of the buy.
+func (s *Service) Report(ctx context.Context, userID int, opts ReportOptions) (*types.TaxReport, error) {
+	report, err := s.newReport(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	fx := &fxRates{ctx: ctx, repo: s.repo, report: report, days: make(map[string]float64)}
+	books := make(map[string]*book)
+
+	err = s.deals.StreamUserDeals(ctx, int64(userID), time.Time{}, report.To, func(deal *types.Deal) error {
+		// Transfers between portfolios do not change the holdings of the user
+		if deal.TransferId != 0 {
+			return nil
+		}
+
+		b, ok := books[deal.CurrencyId]
+		if !ok {
+			b = &book{method: report.Method}
+			books[deal.CurrencyId] = b
+		}
+
+		// A fee paid in fiat is part of the cost of a buy and lowers the
+		// proceeds of a sell, a fee paid in the coin changes the quantity
+		quantity := deal.Quantity()
+		if deal.Count > 0 {
+			if quantity > 0 {
+				b.buy(deal.CreatedAt, quantity, (deal.Count*deal.Price+deal.FiatFee())/quantity)
+			}
+			return nil
+		}
+
+		matches, uncovered := b.sell(-quantity)
+		if deal.CreatedAt.Before(report.From) {
+			return nil
+		}
+
+		if uncovered > dust {
+			report.Warnings = append(report.Warnings, fmt.Sprintf(
+				"deal %d sells %g %s more than was bought, its cost basis is taken as 0",
+				deal.Id, uncovered, deal.CurrencyId))
+			matches = append(matches, match{count: uncovered})
+		}
+
+		return s.addDisposals(report, fx, deal, matches)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.Total = sumTotals(report.ShortTerm, report.LongTerm)
+
+	return report, nil
+}
+
+func (s *Service) newReport(opts ReportOptions) (*types.TaxReport, error) {
+	if opts.Year < 2009 || opts.Year > time.Now().Year() {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidTaxYear, opts.Year)
+	}
+
+	yearStart := opts.YearStart
+	if yearStart == "" {
+		yearStart = "01-01"
+	}
+
+	from, err := time.Parse(time.DateOnly, fmt.Sprintf("%d-%s", opts.Year, yearStart))
+	if err != nil {
+		return nil, fmt.Errorf("%w: year_start must be MM-DD", ErrInvalidTaxYear)
+	}
+
+	method := strings.ToLower(opts.Method)
+	if method == "" {
+		method = MethodFIFO
+	}
+	if !slices.Contains(Methods, method) {
+		return nil, fmt.Errorf("%w: %s, expected one of %s", ErrUnknownCostMethod, opts.Method, strings.Join(Methods, ", "))
+	}
+
+	fiat := strings.ToLower(opts.Fiat)
+	if fiat == "" {
+		fiat = "usd"
+	}
+	if !slices.Contains(s.rates.GetAllSupportedCurrencies(), fiat) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFiat, opts.Fiat)
+	}
+
+	months := opts.LongTermMonths
+	if months == 0 {
+		months = defaultLongTermMonths
+	}
+	if months < 1 || months > maxLongTermMonths {
+		return nil, fmt.Errorf("%w: %d months, expected 1 to %d", ErrInvalidHoldingTerm, months, maxLongTermMonths)
+	}
+
+	return &types.TaxReport{
+		Year:           opts.Year,
+		Method:         method,
+		Fiat:           fiat,
+		From:           from,
+		To:             from.AddDate(1, 0, 0),
+		LongTermMonths: months,
+		Disposals:      make([]types.TaxDisposal, 0),
+		Warnings:       make([]string, 0),
+		GeneratedAt:    time.Now(),
+	}, nil
+}
+
+func (s *Service) addDisposals(report *types.TaxReport, fx *fxRates, deal *types.Deal, matches []match) error {
+	saleRate, err := fx.at(deal.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	// The proceeds net of the fee are spread over the coins that left,
+	// including the ones paid as fee
+	unitProceeds := (-deal.Count*deal.Price - deal.FiatFee()) / -deal.Quantity()
+
+	for _, m := range matches {
+		disposal := types.TaxDisposal{
+			DealId:     deal.Id,
+			CurrencyId: deal.CurrencyId,
+			Count:      m.count,
+			DisposedAt: deal.CreatedAt,
+			Term:       "short",
+			Proceeds:   round(m.count * unitProceeds * saleRate),
+		}
+
+		if !m.acquiredAt.IsZero() {
+			buyRate, err := fx.at(m.acquiredAt)
+			if err != nil {
+				return err
+			}
+
+			acquiredAt := m.acquiredAt
+			disposal.AcquiredAt = &acquiredAt
+			disposal.CostBasis = round(m.cost * buyRate)
+
+			if deal.CreatedAt.After(acquiredAt.AddDate(0, report.LongTermMonths, 0)) {
+				disposal.Term = "long"
+			}
+		}
+
+		disposal.Gain = round(disposal.Proceeds - disposal.CostBasis)
+
+		totals := &report.ShortTerm
+		if disposal.Term == "long" {
+			totals = &report.LongTerm
+		}
+		addDisposal(totals, disposal)
+
+		report.Disposals = append(report.Disposals, disposal)
+	}
+
+	return nil
+}
+
+func addDisposal(t *types.TaxTotals, d types.TaxDisposal) {
+	t.Disposals++
+	t.Proceeds = round(t.Proceeds + d.Proceeds)
+	t.CostBasis = round(t.CostBasis + d.CostBasis)
+	if d.Gain >= 0 {
+		t.Gains = round(t.Gains + d.Gain)
+	} else {
+		t.Losses = round(t.Losses - d.Gain)
+	}
+	t.Net = round(t.Gains - t.Losses)
+}
+
+func sumTotals(a, b types.TaxTotals) types.TaxTotals {
+	return types.TaxTotals{
+		Disposals: a.Disposals + b.Disposals,
+		Proceeds:  round(a.Proceeds + b.Proceeds),
+		CostBasis: round(a.CostBasis + b.CostBasis),
+		Gains:     round(a.Gains + b.Gains),
+		Losses:    round(a.Losses + b.Losses),
+		Net:       round(a.Net + b.Net),
+	}
+}
+
+// round keeps the cents, amounts are reported in fiat
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// rateHistory is where fxRates reads the rates from, the Repository
+type rateHistory interface {
+	RateAt(ctx context.Context, currency string, date time.Time) (rate float64, day time.Time, ok bool, err error)
+}
+
+// fxRates looks up the rates of the report fiat by day
+type fxRates struct {
+	ctx    context.Context
+	repo   rateHistory
+	report *types.TaxReport
+	days   map[string]float64
+	warned bool
+}
+
+func (f *fxRates) at(t time.Time) (float64, error) {
+	if f.report.Fiat == "usd" {
+		return 1, nil
+	}
+
+	day := t.UTC().Format(time.DateOnly)
+	if rate, ok := f.days[day]; ok {
+		return rate, nil
+	}
+
+	currency := strings.ToUpper(f.report.Fiat)
+	rate, rateDay, ok, err := f.repo.RateAt(f.ctx, currency, t.UTC())
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("%w: no %s rates are stored", ErrFXRateUnavailable, currency)
+	}
+
+	if gap := math.Abs(t.Sub(rateDay).Hours() / 24); gap > staleRateDays && !f.warned {
+		f.report.Warnings = append(f.report.Warnings, fmt.Sprintf(
+			"the %s rate of %s is used for %s, the rates of some days are missing",
+			currency, rateDay.Format(time.DateOnly), day))
+		f.warned = true
+	}
+
+	f.days[day] = rate
+	return rate, nil
+}
+
+// RecordRates stores the latest rates of the supported fiat currencies for
+// the day they were fetched, so later reports convert at that day's rate
+func (s *Service) RecordRates(ctx context.Context) error {
+	latest, updatedAt := s.rates.ExchangeRates()
+	if updatedAt.IsZero() {
+		return nil
+	}
+
+	var rates []types.FXRate
+	for _, fiat := range s.rates.GetAllSupportedCurrencies() {
+		currency := strings.ToUpper(fiat)
+		rate, ok := latest[currency]
+		if !ok || currency == "USD" {
+			continue
+		}
+
+		rates = append(rates, types.FXRate{
+			Currency: currency,
+			Date:     updatedAt.UTC().Format(time.DateOnly),
+			Rate:     rate,
+		})
+	}
+
+	if len(rates) == 0 {
+		return nil
+	}
+
+	return s.repo.SaveRates(ctx, rates)
+}
+
+// SaveRates stores historical rates, to cover the days before the rates were
+// recorded
+func (s *Service) SaveRates(ctx context.Context, payload types.FXRatesPayload) error {
+	if err := utils.Validate.Struct(payload); err != nil {
+		return apperr.FromValidator(err)
+	}
+
+	for i := range payload.Rates {
+		payload.Rates[i].Currency = strings.ToUpper(payload.Rates[i].Currency)
+	}
+
+	return s.repo.SaveRates(ctx, payload.Rates)
+}
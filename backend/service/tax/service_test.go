@@ -0,0 +1,209 @@
+package tax
+
+import (
+	"context"
+	"crypto-tracker/types"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeDeals streams deals, oldest first, like DealService.StreamUserDeals
+type fakeDeals []*types.Deal
+
+func (f fakeDeals) StreamUserDeals(ctx context.Context, userID int64, from, to time.Time, fn func(*types.Deal) error) error {
+	for _, deal := range f {
+		if !to.IsZero() && !deal.CreatedAt.Before(to) {
+			continue
+		}
+
+		if err := fn(deal); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type fakeRates struct{}
+
+func (fakeRates) GetAllSupportedCurrencies() []string {
+	return []string{"usd", "eur"}
+}
+
+func (fakeRates) ExchangeRates() (map[string]float64, time.Time) {
+	return nil, time.Time{}
+}
+
+// fakeHistory has the EUR rates of a few days, see Repository.RateAt
+type fakeHistory map[string]float64
+
+func (f fakeHistory) RateAt(ctx context.Context, currency string, date time.Time) (float64, time.Time, bool, error) {
+	var day time.Time
+	for d := range f {
+		t, _ := time.Parse(time.DateOnly, d)
+		if !t.After(date) && t.After(day) {
+			day = t
+		}
+	}
+
+	if day.IsZero() {
+		return 0, time.Time{}, false, nil
+	}
+
+	return f[day.Format(time.DateOnly)], day, true, nil
+}
+
+func date(s string) time.Time {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+// TestReport replays a history with fees in fiat and in the coin, a
+// transfer, a sell before the year and an oversell, FIFO in USD:
+//
+//	buy 2 at 100 with a fee of 10 USD: 2 at 105
+//	buy 1 at 400 with a fee of 0.1 BTC: 0.9 at 444.44
+//	sell 0.5 in 2022: 1.5 at 105 left
+//	sell 2 at 500 with a fee of 20 USD: 490 per coin, 1.5 long term at 105
+//	  and 0.5 short term at 444.44
+//	sell 1 at 600 with a fee of 0.01 BTC: 594.06 per coin, 0.4 at 444.44
+//	  and 0.61 not covered
+func TestReport(t *testing.T) {
+	deals := fakeDeals{
+		{Id: 1, CurrencyId: "btc", Count: 2, Price: 100, Fee: 10, FeeCurrency: "usd", CreatedAt: date("2022-01-10")},
+		{Id: 2, CurrencyId: "btc", Count: 1, Price: 400, Fee: 0.1, FeeCurrency: "btc", CreatedAt: date("2022-06-01")},
+		{Id: 3, CurrencyId: "btc", Count: -1, Price: 105, FeeCurrency: "usd", TransferId: 1, CreatedAt: date("2022-07-01")},
+		{Id: 4, CurrencyId: "btc", Count: -0.5, Price: 300, Fee: 5, FeeCurrency: "usd", CreatedAt: date("2022-12-01")},
+		{Id: 5, CurrencyId: "btc", Count: -2, Price: 500, Fee: 20, FeeCurrency: "usd", CreatedAt: date("2023-03-01")},
+		{Id: 6, CurrencyId: "btc", Count: -1, Price: 600, Fee: 0.01, FeeCurrency: "btc", CreatedAt: date("2023-05-01")},
+		{Id: 7, CurrencyId: "btc", Count: -0.1, Price: 700, FeeCurrency: "usd", CreatedAt: date("2024-02-01")},
+	}
+
+	s := NewService(nil, deals, fakeRates{})
+
+	report, err := s.Report(context.Background(), 1, ReportOptions{Year: 2023, Method: MethodFIFO})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantDisposals := []types.TaxDisposal{
+		{DealId: 5, Count: 1.5, Term: "long", Proceeds: 735, CostBasis: 157.5, Gain: 577.5},
+		{DealId: 5, Count: 0.5, Term: "short", Proceeds: 245, CostBasis: 222.22, Gain: 22.78},
+		{DealId: 6, Count: 0.4, Term: "short", Proceeds: 237.62, CostBasis: 177.78, Gain: 59.84},
+		{DealId: 6, Count: 0.61, Term: "short", Proceeds: 362.38, CostBasis: 0, Gain: 362.38},
+	}
+
+	if len(report.Disposals) != len(wantDisposals) {
+		t.Fatalf("disposals = %+v, want %d", report.Disposals, len(wantDisposals))
+	}
+
+	for i, want := range wantDisposals {
+		got := report.Disposals[i]
+		if got.DealId != want.DealId || !near(got.Count, want.Count) || got.Term != want.Term ||
+			got.Proceeds != want.Proceeds || got.CostBasis != want.CostBasis || got.Gain != want.Gain {
+			t.Errorf("disposal %d = %+v, want %+v", i, got, want)
+		}
+	}
+
+	if report.Disposals[3].AcquiredAt != nil {
+		t.Errorf("the uncovered disposal is acquired at %v, want nil", report.Disposals[3].AcquiredAt)
+	}
+
+	totals := []struct {
+		name      string
+		got, want types.TaxTotals
+	}{
+		{"short term", report.ShortTerm, types.TaxTotals{Disposals: 3, Proceeds: 845, CostBasis: 400, Gains: 445, Net: 445}},
+		{"long term", report.LongTerm, types.TaxTotals{Disposals: 1, Proceeds: 735, CostBasis: 157.5, Gains: 577.5, Net: 577.5}},
+		{"total", report.Total, types.TaxTotals{Disposals: 4, Proceeds: 1580, CostBasis: 557.5, Gains: 1022.5, Net: 1022.5}},
+	}
+
+	for _, tt := range totals {
+		if tt.got != tt.want {
+			t.Errorf("%s = %+v, want %+v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	if len(report.Warnings) != 1 {
+		t.Errorf("warnings = %q, want the oversell of deal 6", report.Warnings)
+	}
+}
+
+func TestReportLoss(t *testing.T) {
+	deals := fakeDeals{
+		{Id: 1, CurrencyId: "eth", Count: 1, Price: 3000, FeeCurrency: "usd", CreatedAt: date("2023-01-10")},
+		{Id: 2, CurrencyId: "eth", Count: -1, Price: 2000, Fee: 10, FeeCurrency: "usd", CreatedAt: date("2023-02-10")},
+	}
+
+	report, err := NewService(nil, deals, fakeRates{}).Report(context.Background(), 1, ReportOptions{Year: 2023})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := types.TaxTotals{Disposals: 1, Proceeds: 1990, CostBasis: 3000, Losses: 1010, Net: -1010}
+	if report.ShortTerm != want {
+		t.Errorf("short term = %+v, want %+v", report.ShortTerm, want)
+	}
+}
+
+// TestAddDisposalsFX converts the proceeds at the rate of the day of the sell
+// and the cost at the rate of the day of the buy
+func TestAddDisposalsFX(t *testing.T) {
+	tests := []struct {
+		name     string
+		history  fakeHistory
+		proceeds float64
+		cost     float64
+		warnings int
+		err      error
+	}{
+		{
+			name:     "rates of both days",
+			history:  fakeHistory{"2023-01-10": 0.8, "2023-06-01": 0.9},
+			proceeds: 180,
+			cost:     80,
+		},
+		{
+			name:     "the rate of the buy is used for the sell and is stale",
+			history:  fakeHistory{"2023-01-10": 0.8},
+			proceeds: 160,
+			cost:     80,
+			warnings: 1,
+		},
+		{
+			name:    "no rate",
+			history: fakeHistory{},
+			err:     ErrFXRateUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := &types.TaxReport{Fiat: "eur", LongTermMonths: 12}
+			fx := &fxRates{ctx: context.Background(), repo: tt.history, report: report, days: make(map[string]float64)}
+			deal := &types.Deal{Id: 1, CurrencyId: "btc", Count: -1, Price: 200, FeeCurrency: "usd", CreatedAt: date("2023-06-01")}
+
+			err := (&Service{}).addDisposals(report, fx, deal, []match{{acquiredAt: date("2023-01-10"), count: 1, cost: 100}})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+
+			got := report.Disposals[0]
+			if got.Proceeds != tt.proceeds || got.CostBasis != tt.cost || got.Gain != tt.proceeds-tt.cost {
+				t.Errorf("disposal = %+v, want proceeds %g and cost %g", got, tt.proceeds, tt.cost)
+			}
+
+			if len(report.Warnings) != tt.warnings {
+				t.Errorf("warnings = %q, want %d", report.Warnings, tt.warnings)
+			}
+		})
+	}
+}
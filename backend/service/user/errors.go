@@ -0,0 +1,12 @@
+package user
+
+import (
+	"crypto-tracker/apperr"
+	"net/http"
+)
+
+var (
+	ErrUserNotFound       = apperr.New(http.StatusNotFound, "user_not_found", "user not found")
+	ErrInvalidCredentials = apperr.New(http.StatusUnauthorized, "invalid_credentials", "invalid email or password")
+	ErrEmailTaken         = apperr.New(http.StatusConflict, "email_taken", "user with this email already exists")
+)
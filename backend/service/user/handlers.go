@@ -2,30 +2,37 @@ package user
 
 import (
 	"crypto-tracker/config"
+	"crypto-tracker/logging"
 	"crypto-tracker/service/auth"
 	"crypto-tracker/types"
 	"crypto-tracker/utils"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"time"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
 )
 
 type Handler struct {
-	store types.UserStore
+	store    types.UserStore
+	notifier types.Notifier
+	clientIP func(*http.Request) string
 }
 
-func NewHandler(store types.UserStore) *Handler {
+// NewHandler takes clientIP to report the address of a new login, it must
+// honour the trusted proxies
+func NewHandler(store types.UserStore, notifier types.Notifier, clientIP func(*http.Request) string) *Handler {
 	return &Handler{
-		store: store,
+		store:    store,
+		notifier: notifier,
+		clientIP: clientIP,
 	}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
-	router.HandleFunc("/login", h.handleLogin).Methods("POST", "OPTIONS")
-	router.HandleFunc("/register", h.handleRegister).Methods("POST", "OPTIONS")
+	router.HandleFunc("/login", h.handleLogin).Methods("POST")
+	router.HandleFunc("/register", h.handleRegister).Methods("POST")
 }
 
 func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
@@ -37,35 +44,60 @@ func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := utils.Validate.Struct(payload); err != nil {
-		errors := err.(validator.ValidationErrors)
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("Invalid payload &v", errors))
+		utils.WriteServiceError(w, err)
 		return
 	}
 
-	fmt.Println("test")
-
 	user, err := h.store.GetUserByEmail(payload.Email)
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("Not Found. Invalid Email or Password."))
+		if errors.Is(err, ErrUserNotFound) {
+			err = ErrInvalidCredentials
+		}
+		utils.WriteServiceError(w, err)
 		return
 	}
 
 	if !auth.ComparePasswords(user.Password, []byte(payload.Password)) {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("Not Found. Invalid Email or Password."))
+		utils.WriteServiceError(w, ErrInvalidCredentials)
 		return
 	}
 
 	secret := []byte(config.Envs.JWTSecret)
 	token, err := auth.CreateJWT(secret, user.Id)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteServiceError(w, err)
 		return
 	}
+
+	h.notifyLogin(r, user)
+
 	utils.WriteJSON(w, http.StatusOK, map[string]string{"token": token})
 }
 
+// notifyLogin sends the security_login event, a failure does not fail the login
+func (h *Handler) notifyLogin(r *http.Request, user *types.User) {
+	ip := h.clientIP(r)
+	userAgent := r.UserAgent()
+	now := time.Now().UTC()
+
+	err := h.notifier.Notify(r.Context(), types.NotificationMessage{
+		UserId: user.Id,
+		Event:  types.EventSecurityLogin,
+		Title:  "New login to your account",
+		Body: fmt.Sprintf("Your account was signed in to at %s from %s (%s).\nIf this was not you, change your password.",
+			now.Format(time.RFC1123), ip, userAgent),
+		Data: map[string]any{
+			"ip":         ip,
+			"user_agent": userAgent,
+			"time":       now,
+		},
+	})
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Error sending login notification", "user_id", user.Id, "error", err)
+	}
+}
+
 func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
-	log.Print(r.Body)
 	var payload *types.RegisterPayload
 
 	if err := utils.ParseJSON(r, &payload); err != nil {
@@ -74,20 +106,24 @@ func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := utils.Validate.Struct(payload); err != nil {
-		errors := err.(validator.ValidationErrors)
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("Invalid payload &v", errors))
+		utils.WriteServiceError(w, err)
 		return
 	}
 
 	_, err := h.store.GetUserByEmail(payload.Email)
 	if err == nil {
-		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("User with email %s already exist.", payload.Email))
+		utils.WriteServiceError(w, fmt.Errorf("%w: %s", ErrEmailTaken, payload.Email))
+		return
+	}
+
+	if !errors.Is(err, ErrUserNotFound) {
+		utils.WriteServiceError(w, err)
 		return
 	}
 
 	hashedPassword, err := auth.HashPassword(payload.Password)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteServiceError(w, err)
 		return
 	}
 
@@ -98,7 +134,7 @@ func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 		Password:  hashedPassword,
 	})
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		utils.WriteServiceError(w, err)
 		return
 	}
 
@@ -3,7 +3,6 @@ package user
 import (
 	"crypto-tracker/types"
 	"database/sql"
-	"fmt"
 )
 
 type Repository struct {
@@ -47,7 +46,7 @@ func (s *Repository) GetUserByEmail(email string) (*types.User, error) {
 	}
 
 	if user.Id == 0 {
-		return nil, fmt.Errorf("User not found.")
+		return nil, ErrUserNotFound
 	}
 
 	return user, nil
@@ -76,7 +75,7 @@ func (s *Repository) GetUserById(id int) (*types.User, error) {
 	}
 
 	if user.Id == 0 {
-		return nil, fmt.Errorf("User not found.")
+		return nil, ErrUserNotFound
 	}
 
 	return user, nil
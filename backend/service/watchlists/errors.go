@@ -0,0 +1,17 @@
+package watchlists
+
+import (
+	"crypto-tracker/apperr"
+	"net/http"
+)
+
+var (
+	ErrWatchlistNotFound  = apperr.New(http.StatusNotFound, "watchlist_not_found", "watchlist not found")
+	ErrInvalidWatchlistID = apperr.New(http.StatusBadRequest, "invalid_watchlist_id", "invalid watchlist id")
+	ErrWatchlistNameTaken = apperr.New(http.StatusConflict, "watchlist_name_taken", "a watchlist with this name already exists")
+	ErrTooManyWatchlists  = apperr.New(http.StatusConflict, "too_many_watchlists", "too many watchlists")
+	ErrTooManyCoins       = apperr.New(http.StatusBadRequest, "too_many_coins", "too many coins in the watchlist")
+	ErrCoinNotInWatchlist = apperr.New(http.StatusNotFound, "coin_not_in_watchlist", "coin not in the watchlist")
+	ErrInvalidOrder       = apperr.New(http.StatusBadRequest, "invalid_order", "the order must list every coin of the watchlist once")
+	ErrUnsupportedFiat    = apperr.New(http.StatusBadRequest, "unsupported_currency", "unsupported currency")
+)
@@ -0,0 +1,252 @@
+package watchlists
+
+import (
+	"crypto-tracker/service/auth"
+	"crypto-tracker/types"
+	"crypto-tracker/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// RegisterRoutes expects a /watchlists router that requires authentication
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.HandleFunc("", h.ListWatchlists).Methods("GET")
+	router.HandleFunc("", h.CreateWatchlist).Methods("POST")
+	router.HandleFunc("/{id:[0-9]+}", h.GetWatchlist).Methods("GET")
+	router.HandleFunc("/{id:[0-9]+}", h.UpdateWatchlist).Methods("PUT")
+	router.HandleFunc("/{id:[0-9]+}", h.DeleteWatchlist).Methods("DELETE")
+	router.HandleFunc("/{id:[0-9]+}/coins", h.AddCoins).Methods("POST")
+	router.HandleFunc("/{id:[0-9]+}/coins/{coin}", h.RemoveCoin).Methods("DELETE")
+	router.HandleFunc("/{id:[0-9]+}/order", h.ReorderCoins).Methods("PUT")
+	router.HandleFunc("/{id:[0-9]+}/share", h.ShareWatchlist).Methods("POST")
+	router.HandleFunc("/{id:[0-9]+}/share", h.UnshareWatchlist).Methods("DELETE")
+}
+
+// RegisterPublicRoutes registers the read-only link of shared watchlists, it
+// does not require authentication
+func (h *Handler) RegisterPublicRoutes(router *mux.Router) {
+	router.HandleFunc("/watchlists/shared/{token}", h.GetSharedWatchlist).Methods("GET")
+}
+
+func watchlistID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return 0, ErrInvalidWatchlistID
+	}
+
+	return id, nil
+}
+
+func (h *Handler) ListWatchlists(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	watchlists, err := h.service.List(r.Context(), userID)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, watchlists)
+}
+
+func (h *Handler) CreateWatchlist(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	var payload types.WatchlistPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	watchlist, err := h.service.Create(r.Context(), userID, payload)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, watchlist)
+}
+
+// GetWatchlist returns the watchlist with the market data of its coins in
+// the ?fiat= currency, usd by default
+func (h *Handler) GetWatchlist(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := watchlistID(r)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	view, err := h.service.View(r.Context(), userID, id, r.URL.Query().Get("fiat"))
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, view)
+}
+
+func (h *Handler) UpdateWatchlist(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := watchlistID(r)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	var payload types.WatchlistPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	watchlist, err := h.service.Update(r.Context(), userID, id, payload)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, watchlist)
+}
+
+func (h *Handler) DeleteWatchlist(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := watchlistID(r)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), userID, id); err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+func (h *Handler) AddCoins(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := watchlistID(r)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	var payload types.WatchlistCoinsPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	watchlist, err := h.service.AddCoins(r.Context(), userID, id, payload)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, watchlist)
+}
+
+func (h *Handler) RemoveCoin(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := watchlistID(r)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	watchlist, err := h.service.RemoveCoin(r.Context(), userID, id, mux.Vars(r)["coin"])
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, watchlist)
+}
+
+func (h *Handler) ReorderCoins(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := watchlistID(r)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	var payload types.WatchlistCoinsPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	watchlist, err := h.service.Reorder(r.Context(), userID, id, payload)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, watchlist)
+}
+
+func (h *Handler) ShareWatchlist(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := watchlistID(r)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	watchlist, err := h.service.Share(r.Context(), userID, id)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, watchlist)
+}
+
+func (h *Handler) UnshareWatchlist(w http.ResponseWriter, r *http.Request) {
+	userID := auth.GetUserIDFromContext(r.Context())
+
+	id, err := watchlistID(r)
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	if err := h.service.Unshare(r.Context(), userID, id); err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"result": "success"})
+}
+
+func (h *Handler) GetSharedWatchlist(w http.ResponseWriter, r *http.Request) {
+	view, err := h.service.SharedView(r.Context(), mux.Vars(r)["token"], r.URL.Query().Get("fiat"))
+	if err != nil {
+		utils.WriteServiceError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, view)
+}
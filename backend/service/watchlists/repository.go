@@ -0,0 +1,184 @@
+package watchlists
+
+import (
+	"context"
+	"crypto-tracker/types"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+const watchlistColumns = `id, user_id, name, coins, share_token, created_at, updated_at`
+
+// uniqueViolation is the Postgres error code of a unique constraint violation
+const uniqueViolation = "23505"
+
+type Repository struct {
+	DB *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{DB: db}
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanWatchlist(row scanner) (*types.Watchlist, error) {
+	var watchlist types.Watchlist
+	var shareToken sql.NullString
+
+	err := row.Scan(
+		&watchlist.Id,
+		&watchlist.UserId,
+		&watchlist.Name,
+		pq.Array(&watchlist.Coins),
+		&shareToken,
+		&watchlist.CreatedAt,
+		&watchlist.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if watchlist.Coins == nil {
+		watchlist.Coins = []string{}
+	}
+	watchlist.ShareToken = shareToken.String
+
+	return &watchlist, nil
+}
+
+// nameTaken converts the violation of the unique (user_id, name) constraint
+func nameTaken(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return ErrWatchlistNameTaken
+	}
+
+	return err
+}
+
+func (r *Repository) Create(ctx context.Context, watchlist *types.Watchlist) error {
+	query := `
+		INSERT INTO watchlists (user_id, name, coins, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		RETURNING id, created_at, updated_at
+	`
+
+	err := r.DB.QueryRowContext(ctx, query, watchlist.UserId, watchlist.Name, pq.Array(watchlist.Coins)).
+		Scan(&watchlist.Id, &watchlist.CreatedAt, &watchlist.UpdatedAt)
+
+	return nameTaken(err)
+}
+
+// GetByID returns the watchlist of the user, ErrWatchlistNotFound when it
+// does not exist or belongs to someone else
+func (r *Repository) GetByID(ctx context.Context, userID int, id int64) (*types.Watchlist, error) {
+	query := `SELECT ` + watchlistColumns + ` FROM watchlists WHERE id = $1 AND user_id = $2`
+
+	watchlist, err := scanWatchlist(r.DB.QueryRowContext(ctx, query, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrWatchlistNotFound
+	}
+
+	return watchlist, err
+}
+
+func (r *Repository) GetByShareToken(ctx context.Context, token string) (*types.Watchlist, error) {
+	query := `SELECT ` + watchlistColumns + ` FROM watchlists WHERE share_token = $1`
+
+	watchlist, err := scanWatchlist(r.DB.QueryRowContext(ctx, query, token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrWatchlistNotFound
+	}
+
+	return watchlist, err
+}
+
+func (r *Repository) GetByUserID(ctx context.Context, userID int) ([]*types.Watchlist, error) {
+	query := `SELECT ` + watchlistColumns + ` FROM watchlists WHERE user_id = $1 ORDER BY name`
+
+	rows, err := r.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	watchlists := make([]*types.Watchlist, 0)
+	for rows.Next() {
+		watchlist, err := scanWatchlist(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		watchlists = append(watchlists, watchlist)
+	}
+
+	return watchlists, rows.Err()
+}
+
+func (r *Repository) CountByUserID(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := r.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM watchlists WHERE user_id = $1`, userID).Scan(&count)
+
+	return count, err
+}
+
+// Update saves the name and the coins of the watchlist
+func (r *Repository) Update(ctx context.Context, watchlist *types.Watchlist) error {
+	query := `
+		UPDATE watchlists SET name = $3, coins = $4, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+		RETURNING updated_at
+	`
+
+	err := r.DB.QueryRowContext(ctx, query, watchlist.Id, watchlist.UserId, watchlist.Name, pq.Array(watchlist.Coins)).
+		Scan(&watchlist.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrWatchlistNotFound
+	}
+
+	return nameTaken(err)
+}
+
+// SetShareToken shares the watchlist under token, an empty token stops sharing
+func (r *Repository) SetShareToken(ctx context.Context, userID int, id int64, token string) error {
+	result, err := r.DB.ExecContext(ctx,
+		`UPDATE watchlists SET share_token = NULLIF($3, ''), updated_at = NOW() WHERE id = $1 AND user_id = $2`,
+		id, userID, token)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrWatchlistNotFound
+	}
+
+	return nil
+}
+
+func (r *Repository) Delete(ctx context.Context, userID int, id int64) error {
+	result, err := r.DB.ExecContext(ctx, `DELETE FROM watchlists WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrWatchlistNotFound
+	}
+
+	return nil
+}
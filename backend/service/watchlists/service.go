@@ -0,0 +1,342 @@
+package watchlists
+
+import (
+	"context"
+	"crypto-tracker/apperr"
+	"crypto-tracker/service/currency"
+	"crypto-tracker/types"
+	"crypto-tracker/utils"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	maxWatchlists = 20
+	maxCoins      = 100
+	defaultFiat   = "usd"
+	tokenBytes    = 24
+)
+
+// CurrencyProvider is the part of currency.Service the watchlists need
+type CurrencyProvider interface {
+	IsCurrencySupported(currency string) bool
+	GetCurrencyData(ctx context.Context, currencyCode string) ([]types.CurrencyResponse, error)
+}
+
+type Service struct {
+	repo       *Repository
+	currencies CurrencyProvider
+}
+
+func NewService(repo *Repository, currencies CurrencyProvider) *Service {
+	return &Service{
+		repo:       repo,
+		currencies: currencies,
+	}
+}
+
+func (s *Service) List(ctx context.Context, userID int) ([]*types.Watchlist, error) {
+	return s.repo.GetByUserID(ctx, userID)
+}
+
+func (s *Service) Get(ctx context.Context, userID int, id int64) (*types.Watchlist, error) {
+	return s.repo.GetByID(ctx, userID, id)
+}
+
+func (s *Service) Create(ctx context.Context, userID int, payload types.WatchlistPayload) (*types.Watchlist, error) {
+	if err := utils.Validate.Struct(payload); err != nil {
+		return nil, apperr.FromValidator(err)
+	}
+
+	coins, err := s.validCoins(ctx, payload.Coins)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := s.repo.CountByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if count >= maxWatchlists {
+		return nil, fmt.Errorf("%w: at most %d watchlists per user", ErrTooManyWatchlists, maxWatchlists)
+	}
+
+	watchlist := &types.Watchlist{
+		UserId: userID,
+		Name:   strings.TrimSpace(payload.Name),
+		Coins:  appendCoins(nil, coins),
+	}
+
+	if err := s.repo.Create(ctx, watchlist); err != nil {
+		return nil, err
+	}
+
+	return watchlist, nil
+}
+
+// Update renames the watchlist and, when coins are given, replaces them
+func (s *Service) Update(ctx context.Context, userID int, id int64, payload types.WatchlistPayload) (*types.Watchlist, error) {
+	if err := utils.Validate.Struct(payload); err != nil {
+		return nil, apperr.FromValidator(err)
+	}
+
+	watchlist, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	watchlist.Name = strings.TrimSpace(payload.Name)
+
+	if payload.Coins != nil {
+		coins, err := s.validCoins(ctx, payload.Coins)
+		if err != nil {
+			return nil, err
+		}
+
+		watchlist.Coins = appendCoins(nil, coins)
+	}
+
+	if err := s.repo.Update(ctx, watchlist); err != nil {
+		return nil, err
+	}
+
+	return watchlist, nil
+}
+
+func (s *Service) Delete(ctx context.Context, userID int, id int64) error {
+	return s.repo.Delete(ctx, userID, id)
+}
+
+// AddCoins appends the coins that are not in the watchlist yet
+func (s *Service) AddCoins(ctx context.Context, userID int, id int64, payload types.WatchlistCoinsPayload) (*types.Watchlist, error) {
+	if err := utils.Validate.Struct(payload); err != nil {
+		return nil, apperr.FromValidator(err)
+	}
+
+	coins, err := s.validCoins(ctx, payload.Coins)
+	if err != nil {
+		return nil, err
+	}
+
+	watchlist, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	watchlist.Coins = appendCoins(watchlist.Coins, coins)
+	if len(watchlist.Coins) > maxCoins {
+		return nil, fmt.Errorf("%w: at most %d coins", ErrTooManyCoins, maxCoins)
+	}
+
+	if err := s.repo.Update(ctx, watchlist); err != nil {
+		return nil, err
+	}
+
+	return watchlist, nil
+}
+
+func (s *Service) RemoveCoin(ctx context.Context, userID int, id int64, coinID string) (*types.Watchlist, error) {
+	watchlist, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	i := slices.Index(watchlist.Coins, normalizeCoin(coinID))
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrCoinNotInWatchlist, coinID)
+	}
+
+	watchlist.Coins = slices.Delete(watchlist.Coins, i, i+1)
+
+	if err := s.repo.Update(ctx, watchlist); err != nil {
+		return nil, err
+	}
+
+	return watchlist, nil
+}
+
+// Reorder sets the order of the coins, payload must list every coin of the
+// watchlist exactly once
+func (s *Service) Reorder(ctx context.Context, userID int, id int64, payload types.WatchlistCoinsPayload) (*types.Watchlist, error) {
+	if err := utils.Validate.Struct(payload); err != nil {
+		return nil, apperr.FromValidator(err)
+	}
+
+	watchlist, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	order := make([]string, len(payload.Coins))
+	for i, coin := range payload.Coins {
+		order[i] = normalizeCoin(coin)
+	}
+
+	current := slices.Clone(watchlist.Coins)
+	sorted := slices.Clone(order)
+	slices.Sort(current)
+	slices.Sort(sorted)
+
+	if !slices.Equal(current, sorted) {
+		return nil, ErrInvalidOrder
+	}
+
+	watchlist.Coins = order
+
+	if err := s.repo.Update(ctx, watchlist); err != nil {
+		return nil, err
+	}
+
+	return watchlist, nil
+}
+
+// Share returns the watchlist with a share token, a new one only when the
+// watchlist is not shared yet
+func (s *Service) Share(ctx context.Context, userID int, id int64) (*types.Watchlist, error) {
+	watchlist, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if watchlist.ShareToken != "" {
+		return watchlist, nil
+	}
+
+	token, err := newShareToken()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SetShareToken(ctx, userID, id, token); err != nil {
+		return nil, err
+	}
+
+	watchlist.ShareToken = token
+
+	return watchlist, nil
+}
+
+// Unshare revokes the share token, the public link stops working
+func (s *Service) Unshare(ctx context.Context, userID int, id int64) error {
+	return s.repo.SetShareToken(ctx, userID, id, "")
+}
+
+// View returns the watchlist of the user with the market data in fiat
+func (s *Service) View(ctx context.Context, userID int, id int64, fiat string) (*types.WatchlistView, error) {
+	watchlist, err := s.repo.GetByID(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.view(ctx, watchlist, fiat)
+}
+
+// SharedView returns the watchlist shared under token with the market data
+// in fiat
+func (s *Service) SharedView(ctx context.Context, token, fiat string) (*types.WatchlistView, error) {
+	watchlist, err := s.repo.GetByShareToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.view(ctx, watchlist, fiat)
+}
+
+func (s *Service) view(ctx context.Context, watchlist *types.Watchlist, fiat string) (*types.WatchlistView, error) {
+	fiat = strings.ToLower(strings.TrimSpace(fiat))
+	if fiat == "" {
+		fiat = defaultFiat
+	}
+
+	if !s.currencies.IsCurrencySupported(fiat) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFiat, fiat)
+	}
+
+	data, err := s.currencies.GetCurrencyData(ctx, fiat)
+	if err != nil {
+		return nil, err
+	}
+
+	markets := make(map[string]*types.CurrencyResponse, len(data))
+	for i := range data {
+		markets[data[i].Id] = &data[i]
+	}
+
+	view := &types.WatchlistView{
+		Id:        watchlist.Id,
+		Name:      watchlist.Name,
+		Fiat:      fiat,
+		Coins:     make([]types.WatchlistCoin, 0, len(watchlist.Coins)),
+		UpdatedAt: watchlist.UpdatedAt,
+	}
+
+	for _, coin := range watchlist.Coins {
+		view.Coins = append(view.Coins, types.WatchlistCoin{
+			Id:     coin,
+			Market: markets[coin],
+		})
+	}
+
+	return view, nil
+}
+
+// validCoins normalizes the coin ids and checks that the currency service
+// knows them
+func (s *Service) validCoins(ctx context.Context, coins []string) ([]string, error) {
+	if len(coins) == 0 {
+		return nil, nil
+	}
+
+	data, err := s.currencies.GetCurrencyData(ctx, defaultFiat)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(data))
+	for _, coin := range data {
+		known[coin.Id] = true
+	}
+
+	valid := make([]string, len(coins))
+	for i, coin := range coins {
+		valid[i] = normalizeCoin(coin)
+
+		if !known[valid[i]] {
+			return nil, fmt.Errorf("%w: %s", currency.ErrUnknownCoin, coin)
+		}
+	}
+
+	return valid, nil
+}
+
+// appendCoins appends the coins missing from list, keeping the order
+func appendCoins(list, coins []string) []string {
+	if list == nil {
+		list = []string{}
+	}
+
+	for _, coin := range coins {
+		if !slices.Contains(list, coin) {
+			list = append(list, coin)
+		}
+	}
+
+	return list
+}
+
+func normalizeCoin(coin string) string {
+	return strings.ToLower(strings.TrimSpace(coin))
+}
+
+func newShareToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
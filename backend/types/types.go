@@ -1,6 +1,8 @@
 package types
 
 import (
+	"context"
+	"encoding/json"
 	"time"
 )
 
@@ -33,8 +35,18 @@ type UserStore interface {
 
 // AI CHAT structures
 type ChatRequest struct {
-	Messages     []ChatMessage `json:"messages"`
-	SystemPrompt string        `json:"system_prompt,omitempty"`
+	Messages []ChatMessage `json:"messages"`
+	// Template is the name of the server-side prompt template, the default one is used when empty
+	Template string `json:"template,omitempty"`
+	// SystemPrompt is ignored unless CHAT_ALLOW_CLIENT_SYSTEM_PROMPT is enabled,
+	// then it is appended to the rendered template
+	SystemPrompt string `json:"system_prompt,omitempty"`
+}
+
+type ChatTemplate struct {
+	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
 }
 
 type ChatMessage struct {
@@ -57,6 +69,8 @@ type CurrencyResponse struct {
 	CurrentPrice      float64 `json:"current_price"`
 	MarketCap         int     `json:"market_cap"`
 	PriceChange24Hour float64 `json:"price_change_24h"`
+	// PriceChangePercentage24Hour is the same in every currency, it is not converted
+	PriceChangePercentage24Hour float64 `json:"price_change_percentage_24h"`
 }
 
 type ExchangeRateResponse struct {
@@ -64,14 +78,55 @@ type ExchangeRateResponse struct {
 	Rates   map[string]float64 `json:"conversion_rates"`
 }
 
+// Deal is a buy, or a sell with a negative Count, priced in USD. Its Fee is
+// paid in FeeCurrency, usd or the CurrencyId of the deal. A zero PortfolioId
+// is the default portfolio of the user on create and the current one on
+// update. The two deals of a transfer between portfolios have its
+// TransferId.
 type Deal struct {
-	Id         int64     `json:"id"`
-	UserId     int64     `json:"user_id" validate:"required"`
-	CurrencyId string    `json:"currency_id" validate:"required"`
-	Count      float64   `json:"count" validate:"required"`
-	Price      float64   `json:"price" validate:"required"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	Id          int64     `json:"id"`
+	UserId      int64     `json:"user_id" validate:"required"`
+	CurrencyId  string    `json:"currency_id" validate:"required"`
+	Count       float64   `json:"count" validate:"required"`
+	Price       float64   `json:"price" validate:"required"`
+	Fee         float64   `json:"fee" validate:"gte=0"`
+	FeeCurrency string    `json:"fee_currency" validate:"omitempty,max=100"`
+	PortfolioId int64     `json:"portfolio_id" validate:"gte=0"`
+	TransferId  int64     `json:"transfer_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// FeeFiat is the currency of a fee paid in fiat, the currency of the prices
+const FeeFiat = "usd"
+
+// Quantity is the change of the holdings, the count less a fee paid in the
+// coin itself
+func (d *Deal) Quantity() float64 {
+	if d.FeeCurrency == d.CurrencyId {
+		return d.Count - d.Fee
+	}
+
+	return d.Count
+}
+
+// FiatFee is the fee paid in fiat, 0 when the fee is paid in the coin
+func (d *Deal) FiatFee() float64 {
+	if d.FeeCurrency == d.CurrencyId {
+		return 0
+	}
+
+	return d.Fee
+}
+
+// FeeValue is the fee in fiat, a fee paid in the coin is valued at the price
+// of the deal
+func (d *Deal) FeeValue() float64 {
+	if d.FeeCurrency == d.CurrencyId {
+		return d.Fee * d.Price
+	}
+
+	return d.Fee
 }
 
 type Portfolio struct {
@@ -79,4 +134,589 @@ type Portfolio struct {
 	TotalCount float64 `json:"total_count"`
 	AvgPrice   float64 `json:"avg_price"`
 	TotalCost  float64 `json:"total_cost"`
+	TotalFees  float64 `json:"total_fees"`
+}
+
+// Add adds a deal of the coin to the holding. A fee paid in fiat raises the
+// cost of a buy and lowers the proceeds of a sell, a fee paid in the coin
+// lowers the holding instead.
+func (p *Portfolio) Add(deal *Deal) {
+	p.TotalCount += deal.Quantity()
+	p.TotalCost += deal.Count*deal.Price + deal.FiatFee()
+	p.TotalFees += deal.FeeValue()
+
+	if p.TotalCount > 0 {
+		p.AvgPrice = p.TotalCost / p.TotalCount
+	}
+}
+
+// DealImportMapping names the CSV column of every deal field, columns that
+// are not mapped are recognized by their usual header names
+type DealImportMapping struct {
+	Coin  string `json:"coin,omitempty"`
+	Count string `json:"count,omitempty"`
+	Price string `json:"price,omitempty"`
+	Date  string `json:"date,omitempty"`
+	// Side is an optional buy/sell column, a sell is stored with a negative count
+	Side string `json:"side,omitempty"`
+	// Fee and FeeCurrency are optional, the fee currency is usd or the coin
+	Fee         string `json:"fee,omitempty"`
+	FeeCurrency string `json:"fee_currency,omitempty"`
+}
+
+type DealImportReport struct {
+	DryRun     bool            `json:"dry_run"`
+	Rows       int             `json:"rows"`
+	Valid      int             `json:"valid"`
+	Invalid    int             `json:"invalid"`
+	Duplicates int             `json:"duplicates"`
+	Imported   int             `json:"imported"`
+	Results    []DealImportRow `json:"results"`
+}
+
+// DealImportRow is the outcome of one CSV row, Line is its line in the file
+type DealImportRow struct {
+	Line   int          `json:"line"`
+	Status string       `json:"status"`
+	Deal   *Deal        `json:"deal,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+	// Warnings are conversions the user should check, like a price converted
+	// at the current rate
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// PortfolioReport values the holdings of a user at the current prices
+type PortfolioReport struct {
+	Fiat              string                   `json:"fiat"`
+	Value             float64                  `json:"value"`
+	Cost              float64                  `json:"cost"`
+	ProfitLoss        float64                  `json:"profit_loss"`
+	ProfitLossPercent float64                  `json:"profit_loss_percent"`
+	Holdings          []PortfolioReportHolding `json:"holdings"`
+	GeneratedAt       time.Time                `json:"generated_at"`
+}
+
+type PortfolioReportHolding struct {
+	CurrencyID        string  `json:"currency_id"`
+	Count             float64 `json:"count"`
+	AvgPrice          float64 `json:"avg_price"`
+	Price             float64 `json:"price"`
+	Value             float64 `json:"value"`
+	Cost              float64 `json:"cost"`
+	ProfitLoss        float64 `json:"profit_loss"`
+	ProfitLossPercent float64 `json:"profit_loss_percent"`
+}
+
+type HealthStatus string
+
+const (
+	HealthOK       HealthStatus = "ok"
+	HealthDegraded HealthStatus = "degraded"
+	HealthFailed   HealthStatus = "failed"
+)
+
+type HealthCheck struct {
+	Name    string       `json:"name"`
+	Status  HealthStatus `json:"status"`
+	Message string       `json:"message,omitempty"`
+}
+
+type HealthReport struct {
+	Status    HealthStatus  `json:"status"`
+	Checks    []HealthCheck `json:"checks,omitempty"`
+	CheckedAt time.Time     `json:"checked_at"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ErrorResponse is the envelope of every error returned by the API
+type ErrorResponse struct {
+	Error     string       `json:"error"`
+	Code      string       `json:"code"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// PriceAlert fires when the price of a coin crosses Threshold, or with the
+// percent_change condition when the 24h change exceeds Threshold percent in
+// either direction.
+type PriceAlert struct {
+	Id              int64      `json:"id"`
+	UserId          int        `json:"user_id"`
+	CoinId          string     `json:"coin_id"`
+	Fiat            string     `json:"fiat"`
+	Condition       string     `json:"condition"`
+	Threshold       float64    `json:"threshold"`
+	Mode            string     `json:"mode"`
+	Active          bool       `json:"active"`
+	Armed           bool       `json:"armed"`
+	LastTriggeredAt *time.Time `json:"last_triggered_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+type PriceAlertPayload struct {
+	CoinId    string  `json:"coin_id" validate:"required,max=100"`
+	Fiat      string  `json:"fiat" validate:"required"`
+	Condition string  `json:"condition" validate:"required,oneof=above below percent_change"`
+	Threshold float64 `json:"threshold" validate:"required,gt=0"`
+	Mode      string  `json:"mode" validate:"omitempty,oneof=once recurring"`
+	Active    *bool   `json:"active,omitempty"`
+}
+
+type AlertTrigger struct {
+	Id          int64     `json:"id"`
+	AlertId     int64     `json:"alert_id"`
+	UserId      int       `json:"user_id"`
+	CoinId      string    `json:"coin_id"`
+	Fiat        string    `json:"fiat"`
+	Condition   string    `json:"condition"`
+	Threshold   float64   `json:"threshold"`
+	Price       float64   `json:"price"`
+	Change24h   float64   `json:"change_24h"`
+	TriggeredAt time.Time `json:"triggered_at"`
+}
+
+// Notification events
+const (
+	EventPriceAlert      = "price_alert"
+	EventPortfolioReport = "portfolio_report"
+	EventSecurityLogin   = "security_login"
+)
+
+// NotificationMessage is what the features hand to the Notifier, which
+// delivers it through the channels the user chose for the event
+type NotificationMessage struct {
+	UserId int
+	Event  string
+	Title  string
+	Body   string
+	Data   any
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, msg NotificationMessage) error
+}
+
+type Notification struct {
+	Id        int64           `json:"id"`
+	UserId    int             `json:"user_id"`
+	Event     string          `json:"event"`
+	Title     string          `json:"title"`
+	Body      string          `json:"body"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	ReadAt    *time.Time      `json:"read_at,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type NotificationPreference struct {
+	Event    string   `json:"event" validate:"required"`
+	Channels []string `json:"channels" validate:"dive,oneof=inbox email webhook"`
+}
+
+type Webhook struct {
+	Id     int64  `json:"id"`
+	UserId int    `json:"user_id"`
+	URL    string `json:"url"`
+	// Secret signs the deliveries, it is returned only when the webhook is created
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookPayload struct {
+	URL string `json:"url" validate:"required,url,max=2048"`
+}
+
+type WebhookDeadLetter struct {
+	Id        int64           `json:"id"`
+	WebhookId int64           `json:"webhook_id"`
+	UserId    int             `json:"user_id"`
+	Event     string          `json:"event"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error"`
+	FailedAt  time.Time       `json:"failed_at"`
+}
+
+type Watchlist struct {
+	Id     int64  `json:"id"`
+	UserId int    `json:"user_id"`
+	Name   string `json:"name"`
+	// Coins are CoinGecko ids in the order chosen by the user
+	Coins []string `json:"coins"`
+	// ShareToken is set while the watchlist is shared through a public link
+	ShareToken string    `json:"share_token,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type WatchlistPayload struct {
+	Name  string   `json:"name" validate:"required,max=100"`
+	Coins []string `json:"coins" validate:"max=100,dive,required,max=100"`
+}
+
+type WatchlistCoinsPayload struct {
+	Coins []string `json:"coins" validate:"required,min=1,max=100,dive,required,max=100"`
+}
+
+// WatchlistView is a watchlist with the market data of its coins in Fiat
+type WatchlistView struct {
+	Id        int64           `json:"id"`
+	Name      string          `json:"name"`
+	Fiat      string          `json:"fiat"`
+	Coins     []WatchlistCoin `json:"coins"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+type WatchlistCoin struct {
+	Id string `json:"id"`
+	// Market is null when the coin is not in the market data anymore
+	Market *CurrencyResponse `json:"market"`
+}
+
+// TaxReport holds the realized gains of a user for a fiscal year, in Fiat
+type TaxReport struct {
+	Year   int    `json:"year"`
+	Method string `json:"method"`
+	Fiat   string `json:"fiat"`
+	// From and To bound the fiscal year, To is exclusive
+	From           time.Time     `json:"from"`
+	To             time.Time     `json:"to"`
+	LongTermMonths int           `json:"long_term_months"`
+	Disposals      []TaxDisposal `json:"disposals"`
+	ShortTerm      TaxTotals     `json:"short_term"`
+	LongTerm       TaxTotals     `json:"long_term"`
+	Total          TaxTotals     `json:"total"`
+	Warnings       []string      `json:"warnings"`
+	GeneratedAt    time.Time     `json:"generated_at"`
+}
+
+// TaxDisposal is the part of a sell matched with one acquisition
+type TaxDisposal struct {
+	DealId     int64   `json:"deal_id"`
+	CurrencyId string  `json:"currency_id"`
+	Count      float64 `json:"count"`
+	// AcquiredAt is null when the sell exceeds the holdings and the cost is unknown
+	AcquiredAt *time.Time `json:"acquired_at"`
+	DisposedAt time.Time  `json:"disposed_at"`
+	// Term is short or long
+	Term      string  `json:"term"`
+	Proceeds  float64 `json:"proceeds"`
+	CostBasis float64 `json:"cost_basis"`
+	Gain      float64 `json:"gain"`
+}
+
+type TaxTotals struct {
+	Disposals int     `json:"disposals"`
+	Proceeds  float64 `json:"proceeds"`
+	CostBasis float64 `json:"cost_basis"`
+	Gains     float64 `json:"gains"`
+	Losses    float64 `json:"losses"`
+	Net       float64 `json:"net"`
+}
+
+type FXRate struct {
+	// Currency is an ISO code like EUR
+	Currency string `json:"currency" validate:"required,len=3,alpha"`
+	// Date is YYYY-MM-DD
+	Date string `json:"date" validate:"required,datetime=2006-01-02"`
+	// Rate is the amount of Currency for 1 USD
+	Rate float64 `json:"rate" validate:"required,gt=0"`
+}
+
+type FXRatesPayload struct {
+	Rates []FXRate `json:"rates" validate:"required,min=1,max=10000,dive"`
+}
+
+// UserPortfolio is a named portfolio of a user, each deal is in one of them
+type UserPortfolio struct {
+	Id     int64  `json:"id"`
+	UserId int    `json:"user_id"`
+	Name   string `json:"name"`
+	// IsDefault is set for the portfolio of the deals created without one
+	IsDefault bool      `json:"is_default"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type UserPortfolioPayload struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// UserPortfolioView is a portfolio with its holdings by currency id
+type UserPortfolioView struct {
+	UserPortfolio
+	Holdings map[string]*Portfolio `json:"holdings"`
+}
+
+// PortfolioTransfer moves coins between two portfolios of a user at their
+// average cost, it is not a sell
+type PortfolioTransfer struct {
+	Id              int64     `json:"id"`
+	UserId          int       `json:"user_id"`
+	FromPortfolioId int64     `json:"from_portfolio_id"`
+	ToPortfolioId   int64     `json:"to_portfolio_id"`
+	CurrencyId      string    `json:"currency_id"`
+	Count           float64   `json:"count"`
+	UnitCost        float64   `json:"unit_cost"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type PortfolioTransferPayload struct {
+	FromPortfolioId int64   `json:"from_portfolio_id" validate:"required,gt=0"`
+	ToPortfolioId   int64   `json:"to_portfolio_id" validate:"required,gt=0,nefield=FromPortfolioId"`
+	CurrencyId      string  `json:"currency_id" validate:"required,max=100"`
+	Count           float64 `json:"count" validate:"required,gt=0"`
+}
+
+// PricePoint is the USD price of a coin at the end of a day
+type PricePoint struct {
+	CurrencyId string `json:"currency_id" validate:"required,max=100"`
+	// Date is YYYY-MM-DD
+	Date  string  `json:"date" validate:"required,datetime=2006-01-02"`
+	Price float64 `json:"price" validate:"required,gt=0"`
+	// MarketCap is optional, 0 when unknown
+	MarketCap float64 `json:"market_cap,omitempty" validate:"gte=0"`
+}
+
+type PriceHistoryPayload struct {
+	Prices []PricePoint `json:"prices" validate:"required,min=1,max=10000,dive"`
+}
+
+// Performance is the daily value of the holdings of a user over a range of
+// days, in Fiat, with the returns over the range
+type Performance struct {
+	UserId int64 `json:"user_id"`
+	// PortfolioId is 0 for all the portfolios
+	PortfolioId int64  `json:"portfolio_id"`
+	Range       string `json:"range"`
+	Fiat        string `json:"fiat"`
+	// From and To are the first and the last day of the series, YYYY-MM-DD
+	From   string             `json:"from"`
+	To     string             `json:"to"`
+	Series []PerformancePoint `json:"series"`
+	// StartValue is the value at the end of the day before From
+	StartValue float64 `json:"start_value"`
+	EndValue   float64 `json:"end_value"`
+	NetFlows   float64 `json:"net_flows"`
+	// TimeWeightedReturn chains the daily returns over the range, it is not annualized
+	TimeWeightedReturn float64 `json:"time_weighted_return"`
+	// MoneyWeightedReturn is the internal rate of return of the flows,
+	// annualized for a range of a year or more, null when it has no solution
+	MoneyWeightedReturn *float64 `json:"money_weighted_return"`
+	// MaxDrawdown is the largest fall of the time weighted index from a
+	// previous peak, as a fraction of the peak
+	MaxDrawdown    float64 `json:"max_drawdown"`
+	DrawdownPeak   string  `json:"drawdown_peak,omitempty"`
+	DrawdownTrough string  `json:"drawdown_trough,omitempty"`
+	// Volatility is the annualized standard deviation of the daily returns
+	Volatility  float64                `json:"volatility"`
+	Benchmarks  []PerformanceBenchmark `json:"benchmarks,omitempty"`
+	Warnings    []string               `json:"warnings"`
+	GeneratedAt time.Time              `json:"generated_at"`
+}
+
+type PerformancePoint struct {
+	// Date is YYYY-MM-DD
+	Date  string  `json:"date"`
+	Value float64 `json:"value"`
+	// NetFlow is the money put in minus the money taken out during the day
+	NetFlow float64 `json:"net_flow"`
+	// Return is the time weighted return of the day
+	Return float64 `json:"return"`
+}
+
+// PerformanceBenchmark compares a performance with holding a benchmark
+// instead, with the same flows in and out
+type PerformanceBenchmark struct {
+	// Id is btc, eth or top10
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	// Series is aligned with the series of the performance
+	Series   []BenchmarkPoint `json:"series"`
+	EndValue float64          `json:"end_value"`
+	// TimeWeightedReturn is the return of the benchmark over the range
+	TimeWeightedReturn float64 `json:"time_weighted_return"`
+	// ExcessReturn is the time weighted return of the portfolio minus the
+	// one of the benchmark
+	ExcessReturn float64 `json:"excess_return"`
+	// Beta is the sensitivity of the daily returns of the portfolio to the
+	// ones of the benchmark
+	Beta float64 `json:"beta"`
+	// Alpha is the annualized daily return of the portfolio beyond Beta
+	// times the one of the benchmark
+	Alpha float64 `json:"alpha"`
+}
+
+type BenchmarkPoint struct {
+	// Date is YYYY-MM-DD
+	Date string `json:"date"`
+	// Value is what the flows of the portfolio would be worth invested in
+	// the benchmark, it is negative when they take out more than that
+	Value  float64 `json:"value"`
+	Return float64 `json:"return"`
+}
+
+// PortfolioTarget is the share of a coin in the value of a portfolio that
+// rebalancing aims for
+type PortfolioTarget struct {
+	CurrencyId string `json:"currency_id" validate:"required,max=100"`
+	// Weight is in percent
+	Weight float64 `json:"weight" validate:"gt=0,lte=100"`
+}
+
+// PortfolioTargetsPayload replaces the targets of a portfolio, the weights
+// add up to 100 and an empty list removes them
+type PortfolioTargetsPayload struct {
+	Targets []PortfolioTarget `json:"targets" validate:"max=100,dive"`
+}
+
+// RebalancePlan compares the allocation of a portfolio at live prices with
+// its targets and gives the trades that bring it back to them
+type RebalancePlan struct {
+	PortfolioId int64   `json:"portfolio_id"`
+	Fiat        string  `json:"fiat"`
+	TotalValue  float64 `json:"total_value"`
+	// DriftThreshold is in percentage points, MinTrade in Fiat
+	DriftThreshold float64 `json:"drift_threshold"`
+	MinTrade       float64 `json:"min_trade"`
+	// MaxDrift is the largest drift of a coin from its target weight
+	MaxDrift float64 `json:"max_drift"`
+	// Rebalance is set when MaxDrift reaches DriftThreshold, the trades are
+	// empty otherwise
+	Rebalance   bool                  `json:"rebalance"`
+	Allocations []RebalanceAllocation `json:"allocations"`
+	// Drafts are the trades as deals that are not saved
+	Drafts      []Deal    `json:"drafts,omitempty"`
+	Warnings    []string  `json:"warnings"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+type RebalanceAllocation struct {
+	CurrencyId string  `json:"currency_id"`
+	Count      float64 `json:"count"`
+	Price      float64 `json:"price"`
+	Value      float64 `json:"value"`
+	// Weight, TargetWeight and Drift are in percent
+	Weight       float64 `json:"weight"`
+	TargetWeight float64 `json:"target_weight"`
+	Drift        float64 `json:"drift"`
+	// Side is buy, sell or empty without a trade
+	Side       string  `json:"side"`
+	TradeCount float64 `json:"trade_count"`
+	TradeValue float64 `json:"trade_value"`
+}
+
+// DCAPlan buys Amount of Fiat worth of a coin every Interval, the deals are
+// created by a job in auto mode or confirmed by the user in confirm mode
+type DCAPlan struct {
+	Id          int64   `json:"id"`
+	UserId      int     `json:"user_id"`
+	PortfolioId int64   `json:"portfolio_id"`
+	CurrencyId  string  `json:"currency_id"`
+	Amount      float64 `json:"amount"`
+	Fiat        string  `json:"fiat"`
+	// Interval is daily, weekly, biweekly or monthly
+	Interval string `json:"interval"`
+	// Mode is auto or confirm
+	Mode      string    `json:"mode"`
+	StartAt   time.Time `json:"start_at"`
+	NextRunAt time.Time `json:"next_run_at"`
+	// Runs counts the purchases scheduled so far
+	Runs      int       `json:"runs"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type DCAPlanPayload struct {
+	CurrencyId string  `json:"currency_id" validate:"required,max=100"`
+	Amount     float64 `json:"amount" validate:"required,gt=0,lte=1000000000"`
+	// Fiat is usd by default
+	Fiat     string `json:"fiat" validate:"omitempty,max=10"`
+	Interval string `json:"interval" validate:"required,oneof=daily weekly biweekly monthly"`
+	// Mode is confirm by default
+	Mode string `json:"mode" validate:"omitempty,oneof=auto confirm"`
+	// PortfolioId is the default portfolio when 0
+	PortfolioId int64 `json:"portfolio_id" validate:"gte=0"`
+	// StartAt is the first purchase, now by default
+	StartAt *time.Time `json:"start_at"`
+	// Active pauses or resumes the plan, true by default
+	Active *bool `json:"active"`
+}
+
+// DCAExecution is one scheduled purchase of a plan
+type DCAExecution struct {
+	Id          int64     `json:"id"`
+	PlanId      int64     `json:"plan_id"`
+	UserId      int       `json:"user_id"`
+	CurrencyId  string    `json:"currency_id"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+	// Status is pending, executed, confirmed, dismissed or failed
+	Status string `json:"status"`
+	// Count and Price are in USD at the time of the run
+	Count     float64   `json:"count"`
+	Price     float64   `json:"price"`
+	DealId    int64     `json:"deal_id,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DCAConfirmPayload records a pending purchase, Count and Price default to
+// the ones of the run
+type DCAConfirmPayload struct {
+	Count float64 `json:"count" validate:"gte=0"`
+	Price float64 `json:"price" validate:"gte=0"`
+	// Fee is in USD
+	Fee float64 `json:"fee" validate:"gte=0"`
+}
+
+// DCAProjectionPayload backtests a plan from From to To, YYYY-MM-DD
+type DCAProjectionPayload struct {
+	CurrencyId string  `json:"currency_id" validate:"required,max=100"`
+	Amount     float64 `json:"amount" validate:"required,gt=0,lte=1000000000"`
+	Fiat       string  `json:"fiat" validate:"omitempty,max=10"`
+	Interval   string  `json:"interval" validate:"required,oneof=daily weekly biweekly monthly"`
+	From       string  `json:"from" validate:"required,datetime=2006-01-02"`
+	// To is today by default
+	To string `json:"to" validate:"omitempty,datetime=2006-01-02"`
+}
+
+// DCAProjection is the result of buying with a plan over past days at the
+// stored prices, in Fiat
+type DCAProjection struct {
+	CurrencyId string        `json:"currency_id"`
+	Fiat       string        `json:"fiat"`
+	Interval   string        `json:"interval"`
+	From       string        `json:"from"`
+	To         string        `json:"to"`
+	Purchases  []DCAPurchase `json:"purchases"`
+	Invested   float64       `json:"invested"`
+	Count      float64       `json:"count"`
+	AvgPrice   float64       `json:"avg_price"`
+	EndPrice   float64       `json:"end_price"`
+	EndValue   float64       `json:"end_value"`
+	// Return is EndValue over Invested minus 1
+	Return float64 `json:"return"`
+	// LumpSumReturn is the return of investing the same total on the first
+	// purchase day
+	LumpSumReturn float64   `json:"lump_sum_return"`
+	Warnings      []string  `json:"warnings"`
+	GeneratedAt   time.Time `json:"generated_at"`
+}
+
+type DCAPurchase struct {
+	// Date is YYYY-MM-DD
+	Date  string  `json:"date"`
+	Price float64 `json:"price"`
+	Count float64 `json:"count"`
+	// Invested, TotalCount and Value are running totals after the purchase
+	Invested   float64 `json:"invested"`
+	TotalCount float64 `json:"total_count"`
+	Value      float64 `json:"value"`
 }
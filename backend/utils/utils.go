@@ -1,8 +1,12 @@
 package utils
 
 import (
+	"crypto-tracker/apperr"
+	"crypto-tracker/logging"
+	"crypto-tracker/types"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"strings"
 
@@ -26,8 +30,43 @@ func WriteJSON(w http.ResponseWriter, status int, v any) error {
 	return json.NewEncoder(w).Encode(v)
 }
 
+// WriteError writes err with an explicit status. The code is the one of err
+// when it is an apperr.Error, otherwise the generic code of the status.
 func WriteError(w http.ResponseWriter, status int, err error) {
-	WriteJSON(w, status, map[string]string{"error": err.Error()})
+	err = apperr.FromValidator(err)
+
+	code := apperr.ForStatus(status).Code
+	if resolved := apperr.Resolve(err); resolved != apperr.ErrInternal {
+		code = resolved.Code
+	}
+
+	WriteJSON(w, status, types.ErrorResponse{
+		Error:     err.Error(),
+		Code:      code,
+		Details:   apperr.FieldErrors(err),
+		RequestID: w.Header().Get(logging.RequestIDHeader),
+	})
+}
+
+// WriteServiceError maps err to its status and code with apperr.Resolve.
+// Internal errors are logged and their message is not sent to the client.
+func WriteServiceError(w http.ResponseWriter, err error) {
+	err = apperr.FromValidator(err)
+	resolved := apperr.Resolve(err)
+	requestID := w.Header().Get(logging.RequestIDHeader)
+
+	message := err.Error()
+	if resolved == apperr.ErrInternal {
+		slog.Error("Internal error", "request_id", requestID, "error", err)
+		message = resolved.Message
+	}
+
+	WriteJSON(w, resolved.Status, types.ErrorResponse{
+		Error:     message,
+		Code:      resolved.Code,
+		Details:   apperr.FieldErrors(err),
+		RequestID: requestID,
+	})
 }
 
 func GetTokenFromRequest(r *http.Request) string {
@@ -8,12 +8,242 @@ CREATE TABLE IF NOT EXISTS users (
 );
 
 
+CREATE TABLE portfolios (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+-- Deals created without a portfolio go to the default portfolio of the user
+CREATE UNIQUE INDEX portfolios_user_default_idx ON portfolios (user_id) WHERE is_default;
+
+
+-- cost is the average cost of the coins in the source portfolio, carried
+-- over to the target portfolio
+CREATE TABLE portfolio_transfers (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    from_portfolio_id INTEGER NOT NULL REFERENCES portfolios (id),
+    to_portfolio_id INTEGER NOT NULL REFERENCES portfolios (id),
+    currency_id VARCHAR(100) NOT NULL,
+    count NUMERIC(20, 8) NOT NULL,
+    cost NUMERIC(20, 8) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX portfolio_transfers_user_id_idx ON portfolio_transfers (user_id);
+
+-- weight is the target share of the coin in the value of the portfolio, in
+-- percent, the weights of a portfolio add up to 100
+CREATE TABLE portfolio_targets (
+    portfolio_id INTEGER NOT NULL REFERENCES portfolios (id) ON DELETE CASCADE,
+    currency_id VARCHAR(100) NOT NULL,
+    weight NUMERIC(7, 4) NOT NULL CHECK (weight > 0 AND weight <= 100),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (portfolio_id, currency_id)
+);
+
+
 CREATE TABLE deals (
     id SERIAL PRIMARY KEY,
     user_id INTEGER NOT NULL,
-    currency_id VARCHAR(10) NOT NULL,
+    currency_id VARCHAR(100) NOT NULL,
     count NUMERIC(20, 8) NOT NULL,
     price NUMERIC(20, 8) NOT NULL,
+    fee NUMERIC(20, 8) NOT NULL DEFAULT 0,
+    fee_currency VARCHAR(100) NOT NULL DEFAULT 'usd',
+    portfolio_id INTEGER NOT NULL REFERENCES portfolios (id),
+    transfer_id INTEGER REFERENCES portfolio_transfers (id) ON DELETE CASCADE,
     created_at TIMESTAMP NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMP NOT NULL DEFAULT NOW()
 );
+
+CREATE INDEX deals_portfolio_id_idx ON deals (portfolio_id);
+
+
+CREATE TABLE currency_cache (
+    key VARCHAR(50) PRIMARY KEY,
+    data JSONB NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+
+CREATE TABLE rate_limits (
+    key VARCHAR(255) PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+
+CREATE TABLE price_alerts (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    coin_id VARCHAR(100) NOT NULL,
+    fiat VARCHAR(10) NOT NULL,
+    condition VARCHAR(20) NOT NULL,
+    threshold NUMERIC(30, 8) NOT NULL,
+    mode VARCHAR(20) NOT NULL DEFAULT 'once',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    armed BOOLEAN NOT NULL DEFAULT TRUE,
+    last_triggered_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX price_alerts_user_id_idx ON price_alerts (user_id);
+CREATE INDEX price_alerts_active_fiat_idx ON price_alerts (fiat) WHERE active;
+
+CREATE TABLE alert_triggers (
+    id SERIAL PRIMARY KEY,
+    alert_id INTEGER NOT NULL REFERENCES price_alerts (id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL,
+    coin_id VARCHAR(100) NOT NULL,
+    fiat VARCHAR(10) NOT NULL,
+    condition VARCHAR(20) NOT NULL,
+    threshold NUMERIC(30, 8) NOT NULL,
+    price NUMERIC(30, 8) NOT NULL,
+    change_24h NUMERIC(12, 4) NOT NULL,
+    triggered_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX alert_triggers_user_id_idx ON alert_triggers (user_id, triggered_at DESC);
+
+
+CREATE TABLE notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    event VARCHAR(50) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    data JSONB,
+    read_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX notifications_user_id_idx ON notifications (user_id, created_at DESC);
+CREATE INDEX notifications_unread_idx ON notifications (user_id) WHERE read_at IS NULL;
+
+CREATE TABLE notification_preferences (
+    user_id INTEGER NOT NULL,
+    event VARCHAR(50) NOT NULL,
+    channels TEXT[] NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, event)
+);
+
+CREATE TABLE notification_webhooks (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX notification_webhooks_user_id_idx ON notification_webhooks (user_id);
+
+CREATE TABLE webhook_deliveries (
+    id SERIAL PRIMARY KEY,
+    webhook_id INTEGER NOT NULL REFERENCES notification_webhooks (id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL,
+    event VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX webhook_deliveries_next_attempt_idx ON webhook_deliveries (next_attempt_at);
+
+CREATE TABLE webhook_dead_letters (
+    id SERIAL PRIMARY KEY,
+    webhook_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    event VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL,
+    last_error TEXT NOT NULL,
+    failed_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+
+CREATE TABLE watchlists (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    coins TEXT[] NOT NULL DEFAULT '{}',
+    share_token VARCHAR(64) UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+
+-- rate is the amount of currency for 1 USD at the end of date
+CREATE TABLE fx_rates (
+    currency VARCHAR(10) NOT NULL,
+    date DATE NOT NULL,
+    rate DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (currency, date)
+);
+
+-- price and market_cap are in USD at the end of date, market_cap is null for
+-- prices given without one
+CREATE TABLE price_history (
+    currency_id VARCHAR(100) NOT NULL,
+    date DATE NOT NULL,
+    price DOUBLE PRECISION NOT NULL,
+    market_cap DOUBLE PRECISION,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (currency_id, date)
+);
+
+CREATE INDEX idx_price_history_date_market_cap ON price_history (date, market_cap DESC) WHERE market_cap IS NOT NULL;
+
+-- A plan buys amount of fiat worth of the coin every interval from start_at,
+-- runs counts the purchases already scheduled
+CREATE TABLE dca_plans (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    portfolio_id INTEGER NOT NULL REFERENCES portfolios (id) ON DELETE CASCADE,
+    currency_id VARCHAR(100) NOT NULL,
+    amount NUMERIC(20, 2) NOT NULL,
+    fiat VARCHAR(10) NOT NULL DEFAULT 'usd',
+    interval VARCHAR(20) NOT NULL,
+    mode VARCHAR(20) NOT NULL DEFAULT 'confirm',
+    start_at TIMESTAMP NOT NULL,
+    next_run_at TIMESTAMP NOT NULL,
+    runs INTEGER NOT NULL DEFAULT 0,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX dca_plans_user_id_idx ON dca_plans (user_id);
+CREATE INDEX dca_plans_next_run_at_idx ON dca_plans (next_run_at) WHERE active;
+
+-- status is pending until the user confirms or dismisses the purchase,
+-- executed when the deal was created by the job and failed when it could not
+-- be. count and price are in USD at the time of the run.
+CREATE TABLE dca_executions (
+    id SERIAL PRIMARY KEY,
+    plan_id INTEGER NOT NULL REFERENCES dca_plans (id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL,
+    currency_id VARCHAR(100) NOT NULL,
+    scheduled_at TIMESTAMP NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    count NUMERIC(20, 8) NOT NULL DEFAULT 0,
+    price NUMERIC(20, 8) NOT NULL DEFAULT 0,
+    deal_id INTEGER REFERENCES deals (id) ON DELETE SET NULL,
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (plan_id, scheduled_at)
+);
+
+CREATE INDEX dca_executions_user_id_status_idx ON dca_executions (user_id, status);
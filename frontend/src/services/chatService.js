@@ -13,7 +13,7 @@ const sendMessageToAPI = async (allMessages) => {
                 'Authorization': `Bearer ${authToken}`
             },
             body: JSON.stringify({
-                system_prompt: "You should help the user with questions connected with crypto currency and etc. If there will be any topics like sexual/racism or etc. just say I will not answer for this, or I will not continue this this theme ",
+                template: "market_explainer",
                 messages: allMessages
             })
         });